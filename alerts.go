@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	webhookFlag     = flag.String("webhook", "", "URL to post a Slack-compatible message to when an opcode of --alert-ops regresses while scraping")
+	alertOpsFlag    = flag.String("alert-ops", "SLOAD,BALANCE,BLOCKHASH", "Comma-separated opcodes or groups to watch for regressions while scraping")
+	alertRatioFlag  = flag.Float64("alert-ratio", 1.5, "Alert when the ms/Mgas of an opcode over the recent scrapes is at least this many times that of the scrapes before")
+	alertWindowFlag = flag.Int("alert-window", 10, "Number of recent scrapes to compare against the scrapes before them")
+	chartURLFlag    = flag.String("chart-url", "", "URL the charts directory is served at, to link and show the charts in alerts")
+)
+
+// regression is an opcode whose ms/Mgas over the recent intervals exceeds that
+// of the intervals before them.
+type regression struct {
+	op               vm.OpCode
+	split, last      int     // Blocks of the recent intervals
+	baseline, recent float64 // ms/Mgas before and after split
+}
+
+func (r regression) String() string {
+	return fmt.Sprintf("%v regressed to %.2f ms/Mgas over blocks %d-%d, %.1fx the %.2f ms/Mgas before",
+		opName(r.op), r.recent, r.split, r.last, r.recent/r.baseline, r.baseline)
+}
+
+// detectRegressions compares the ms/Mgas of the ops over the last window
+// intervals with that over all intervals before, and returns those which grew
+// by at least ratio. Opcodes without gas in either period are skipped.
+func detectRegressions(stat statCollection, ops []vm.OpCode, window int, ratio float64) []regression {
+	numbers := stat.numbers()
+	if window < 1 || len(numbers) < window+2 {
+		return nil
+	}
+	var (
+		first = numbers[0]
+		split = numbers[len(numbers)-1-window]
+		last  = numbers[len(numbers)-1]
+		found []regression
+	)
+	for _, op := range ops {
+		before := stat.point(split, op).Sub(stat.point(first, op))
+		after := stat.point(last, op).Sub(stat.point(split, op))
+		if before.totalGas() == 0 || after.totalGas() == 0 {
+			continue
+		}
+		r := regression{op, split, last, before.MilliSecondsPerMgas(), after.MilliSecondsPerMgas()}
+		if r.baseline > 0 && r.recent >= ratio*r.baseline {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// alerter posts to a webhook when an opcode starts to regress. An opcode is
+// only alerted on again after it has recovered, so that a lasting regression
+// doesn't alert on every scrape.
+type alerter struct {
+	url      string
+	chartURL string
+	ops      []vm.OpCode
+	firing   map[vm.OpCode]bool
+}
+
+func newAlerter(url, chartURL string, ops []vm.OpCode) *alerter {
+	return &alerter{url: url, chartURL: chartURL, ops: ops, firing: make(map[vm.OpCode]bool)}
+}
+
+// check alerts on the opcodes which started to regress since the last check,
+// with a chart of their ms/Mgas.
+func (a *alerter) check(ctx context.Context, stat statCollection, run runMeta) error {
+	regressed := make(map[vm.OpCode]bool)
+	var fails failures
+	for _, r := range detectRegressions(stat, a.ops, *alertWindowFlag, *alertRatioFlag) {
+		regressed[r.op] = true
+		if a.firing[r.op] {
+			continue
+		}
+		log.Warn("Detected regression", "op", opName(r.op), "baseline", r.baseline, "recent", r.recent)
+		spec := chartSpec{
+			File:   "alert-{{.Op}}.png",
+			Title:  "Milliseconds per Mgas ({{.Op}}) - {{.Run}}",
+			Ops:    []string{opName(r.op)},
+			Metric: "timepergas",
+		}
+		paths, err := spec.render(ctx, stat, run)
+		if err != nil {
+			fails.add(err)
+		}
+		if err := a.post(ctx, r, paths); err != nil {
+			fails.add(fmt.Errorf("webhook for %v: %v", opName(r.op), err))
+			continue
+		}
+		a.firing[r.op] = true
+	}
+	for op := range a.firing {
+		if !regressed[op] {
+			log.Info("Regression recovered", "op", opName(op))
+			delete(a.firing, op)
+		}
+	}
+	return fails.err()
+}
+
+// post sends the regression to the webhook, as a Slack message. The chart is
+// attached as an image if its URL is known, and named in the text otherwise.
+func (a *alerter) post(ctx context.Context, r regression, charts []string) error {
+	type attachment struct {
+		Title     string `json:"title"`
+		TitleLink string `json:"title_link,omitempty"`
+		ImageURL  string `json:"image_url,omitempty"`
+	}
+	msg := struct {
+		Text        string       `json:"text"`
+		Attachments []attachment `json:"attachments,omitempty"`
+	}{Text: r.String()}
+	for _, path := range charts {
+		if a.chartURL == "" {
+			msg.Text += fmt.Sprintf("\nChart: %v", path)
+			continue
+		}
+		u := strings.TrimSuffix(a.chartURL, "/") + "/" + filepath.Base(path)
+		msg.Attachments = append(msg.Attachments, attachment{Title: filepath.Base(path), TitleLink: u, ImageURL: u})
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return nil
+}
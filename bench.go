@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var benchRunsFlag = flag.Int("bench-runs", 5, "Number of runs per opcode in bench, the fastest one counts")
+
+const (
+	benchGas    = 10000000 // Gas limit of every benchmark run
+	benchUnroll = 256      // Number of executions of the opcode per loop iteration
+	benchDepth  = 17       // Number of stack items below the loop, as SWAP16 needs 17
+)
+
+// benchArity is the number of stack items taken and returned by the opcodes
+// with a constant gas cost, apart from PUSH, DUP and SWAP.
+var benchArity = map[vm.OpCode][2]int{
+	vm.ADD: {2, 1}, vm.MUL: {2, 1}, vm.SUB: {2, 1}, vm.DIV: {2, 1}, vm.SDIV: {2, 1}, vm.MOD: {2, 1},
+	vm.SMOD: {2, 1}, vm.ADDMOD: {3, 1}, vm.MULMOD: {3, 1}, vm.SIGNEXTEND: {2, 1},
+	vm.LT: {2, 1}, vm.GT: {2, 1}, vm.SLT: {2, 1}, vm.SGT: {2, 1}, vm.EQ: {2, 1}, vm.ISZERO: {1, 1},
+	vm.AND: {2, 1}, vm.OR: {2, 1}, vm.XOR: {2, 1}, vm.NOT: {1, 1}, vm.BYTE: {2, 1},
+	vm.SHL: {2, 1}, vm.SHR: {2, 1}, vm.SAR: {2, 1},
+	vm.ADDRESS: {0, 1}, vm.BALANCE: {1, 1}, vm.ORIGIN: {0, 1}, vm.CALLER: {0, 1}, vm.CALLVALUE: {0, 1},
+	vm.CALLDATASIZE: {0, 1}, vm.CODESIZE: {0, 1}, vm.GASPRICE: {0, 1}, vm.EXTCODESIZE: {1, 1},
+	vm.RETURNDATASIZE: {0, 1}, vm.EXTCODEHASH: {1, 1},
+	vm.BLOCKHASH: {1, 1}, vm.COINBASE: {0, 1}, vm.TIMESTAMP: {0, 1}, vm.NUMBER: {0, 1},
+	vm.DIFFICULTY: {0, 1}, vm.GASLIMIT: {0, 1},
+	vm.POP: {1, 0}, vm.SLOAD: {1, 1}, vm.PC: {0, 1}, vm.MSIZE: {0, 1}, vm.GAS: {0, 1}, vm.JUMPDEST: {0, 0},
+}
+
+// arity returns the number of stack items taken and returned by op, and
+// whether it can be benchmarked.
+func arity(op vm.OpCode) (int, int, bool) {
+	switch {
+	case op >= vm.PUSH1 && op <= vm.PUSH32:
+		return 0, 1, true
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		return 0, 1, true
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		return 0, 0, true
+	}
+	a, ok := benchArity[op]
+	return a[0], a[1], ok
+}
+
+// benchCode returns a loop which executes op benchUnroll times per iteration,
+// each time pushing its arguments and popping its results, until it runs out
+// of gas. It also returns the gas used before the loop and per iteration.
+func benchCode(op vm.OpCode, in, out int, number uint64) ([]byte, uint64, uint64) {
+	var code []byte
+	for i := 0; i < benchDepth; i++ {
+		code = append(code, byte(vm.PUSH1), 1)
+	}
+	loop := len(code)
+	code = append(code, byte(vm.JUMPDEST))
+	for i := 0; i < benchUnroll; i++ {
+		for j := 0; j < in; j++ {
+			code = append(code, byte(vm.PUSH1), 1)
+		}
+		code = append(code, byte(op))
+		if op >= vm.PUSH1 && op <= vm.PUSH32 {
+			for j := vm.PUSH1; j <= op; j++ {
+				code = append(code, 1)
+			}
+		}
+		for j := 0; j < out; j++ {
+			code = append(code, byte(vm.POP))
+		}
+	}
+	code = append(code, byte(vm.PUSH1), byte(loop), byte(vm.JUMP))
+
+	var (
+		push    = gasCost(vm.PUSH1, number)
+		setup   = benchDepth * push
+		perIter = gasCost(vm.JUMPDEST, number) + push + gasCost(vm.JUMP, number) +
+			benchUnroll*(uint64(in)*push+gasCost(op, number)+uint64(out)*gasCost(vm.POP, number))
+	)
+	return code, setup, perIter
+}
+
+// benchLoop runs the loop of op, and returns the time per iteration of the
+// fastest run.
+func benchLoop(ctx context.Context, op vm.OpCode, in, out int, number uint64) (time.Duration, error) {
+	code, setup, perIter := benchCode(op, in, out, number)
+	cfg := &runtime.Config{
+		ChainConfig: params.MainnetChainConfig,
+		BlockNumber: new(big.Int).SetUint64(number),
+		GasLimit:    benchGas,
+	}
+	iterations := time.Duration((benchGas - setup) / perIter)
+	var fastest time.Duration
+	for i := 0; i < *benchRunsFlag; i++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		if _, _, err := runtime.Execute(code, nil, cfg); err != nil && err != vm.ErrOutOfGas {
+			return 0, fmt.Errorf("benchmark of %v: %v", opName(op), err)
+		}
+		if d := time.Since(start) / iterations; i == 0 || d < fastest {
+			fastest = d
+		}
+	}
+	return fastest, nil
+}
+
+// benchResult is the synthetic cost of an opcode.
+type benchResult struct {
+	op  vm.OpCode
+	gas uint64
+	ns  float64 // Per execution
+}
+
+// msPerMgas is the synthetic time per gas, in the unit of timepergas.
+func (r benchResult) msPerMgas() float64 {
+	return r.ns / float64(r.gas)
+}
+
+// benchmark measures the synthetic execution time of every opcode with a
+// constant gas cost at the given block. The PUSH1 and POP around each
+// execution are measured separately and subtracted, assuming they cost the
+// same.
+func benchmark(ctx context.Context, number uint64) ([]benchResult, error) {
+	base, err := benchLoop(ctx, vm.PUSH1, 0, 1, number)
+	if err != nil {
+		return nil, err
+	}
+	pushPop := float64(base) / benchUnroll // One PUSH1 and one POP
+	var results []benchResult
+	for i := 0; i < 256; i++ {
+		op := vm.OpCode(i)
+		in, out, ok := arity(op)
+		gas := gasCost(op, number)
+		if !ok || gas == 0 || excludedOps[op] {
+			continue
+		}
+		d, err := benchLoop(ctx, op, in, out, number)
+		if err != nil {
+			return nil, err
+		}
+		ns := float64(d)/benchUnroll - float64(in+out)*pushPop/2
+		if ns < 0 {
+			ns = 0
+		}
+		results = append(results, benchResult{op, gas, ns})
+	}
+	return results, nil
+}
+
+// printBench writes the synthetic costs to w, next to those observed in stat
+// if there are any. The ratio of the two is the share of the observed cost
+// which depends on the state, rather than on the opcode itself.
+func printBench(w io.Writer, results []benchResult, observed map[vm.OpCode]float64) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "OPCODE\tGAS\tNS/EXEC\tMS/MGAS\tOBSERVED\tRATIO\t\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%v\t%d\t%.1f\t%.2f\t", opName(r.op), r.gas, r.ns, r.msPerMgas())
+		if obs, ok := observed[r.op]; ok && r.msPerMgas() > 0 {
+			fmt.Fprintf(tw, "%.2f\t%.1fx\t\n", obs, obs/r.msPerMgas())
+		} else {
+			fmt.Fprintf(tw, "-\t-\t\n")
+		}
+	}
+	tw.Flush()
+}
+
+// benchChart renders the synthetic ms/Mgas of the opcodes next to the observed
+// one, for the n opcodes with the highest observed ms/Mgas. Without observed
+// numbers, the synthetic ones are charted alone.
+func benchChart(results []benchResult, observed map[vm.OpCode]float64, n int, filename string) (string, error) {
+	sort.Slice(results, func(i, j int) bool {
+		if len(observed) > 0 {
+			return observed[results[i].op] > observed[results[j].op]
+		}
+		return results[i].msPerMgas() > results[j].msPerMgas()
+	})
+	if len(results) > n {
+		results = results[:n]
+	}
+	var (
+		bars       []chart.Value
+		benchStyle = chart.Style{Show: true, FillColor: drawing.ColorBlue, StrokeColor: drawing.ColorBlue}
+		obsStyle   = chart.Style{Show: true, FillColor: drawing.ColorRed, StrokeColor: drawing.ColorRed}
+	)
+	for _, r := range results {
+		bars = append(bars, chart.Value{Value: r.msPerMgas(), Label: opName(r.op) + " bench", Style: benchStyle})
+		if obs, ok := observed[r.op]; ok {
+			bars = append(bars, chart.Value{Value: obs, Label: opName(r.op) + " observed", Style: obsStyle})
+		}
+	}
+	width, height := layout.size(1000, 0)
+	g := chart.BarChart{
+		Title:        "Milliseconds per Mgas - synthetic benchmark vs observed",
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		XAxis: chart.Style{
+			Show:                true,
+			TextRotationDegrees: 90.0,
+		},
+		Background: chart.Style{
+			Padding: layout.padding(chart.Box{Top: 40, Bottom: 100}),
+		},
+		BarWidth: layout.barWidth(20),
+		YAxis: chart.YAxis{
+			Style: chart.StyleShow(),
+		},
+		Bars: bars,
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := g.Render(chart.PNG, buffer); err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("./charts/%s", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return path, err
+	}
+	return path, writeSidecar(path, valuesSidecar(g.Title, "ms/Mgas", bars, nil))
+}
+
+// benchCmd implements "vmstats bench", which benchmarks the opcodes on the
+// local machine at the latest fork. With --dir, the results are compared to
+// the ms/Mgas observed over the whole run.
+func benchCmd(ctx context.Context) {
+	number := forks[len(forks)-1].block
+	observed := make(map[vm.OpCode]float64)
+	if *dir != "" {
+		stat := loadStats(ctx, *dir)
+		if numbers := stat.numbers(); len(numbers) > 0 {
+			for _, dp := range stat.delta(0, numbers[len(numbers)-1]) {
+				if dp.totalGas() > 0 {
+					observed[dp.op] = dp.MilliSecondsPerMgas()
+				}
+			}
+		}
+	}
+	log.Info("Benchmarking opcodes", "fork", forks[len(forks)-1].name, "runs", *benchRunsFlag)
+	results, err := benchmark(ctx, number)
+	if err != nil {
+		fatal(exitCode(err), "Benchmark failed", "err", err)
+	}
+	printBench(os.Stdout, results, observed)
+	path, err := benchChart(results, observed, 15, "bench.png")
+	if err != nil {
+		fatal(exitPartial, "Failed to render benchmark chart", "err", err)
+	}
+	fmt.Println(path)
+	if err := writeManifest(); err != nil {
+		fatal(exitPartial, "Failed to write manifest", "err", err)
+	}
+}
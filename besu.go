@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// besuHeader is the header of Besu's opcode export.
+var besuHeader = []string{"opcode", "count", "time_ns"}
+
+// parseBesu decodes Besu's opcode export, a CSV file with the cumulative count
+// and execution time of every opcode which was executed:
+//
+//	opcode,count,time_ns
+//	ADD,12,3400
+//	...
+//
+// The export has no block number, it is taken from the filename.
+func parseBesu(r io.Reader) ([256]opMeter, int, error) {
+	var m [256]opMeter
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(besuHeader)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return m, 0, fmt.Errorf("empty besu metrics")
+	} else if err != nil {
+		return m, 0, fmt.Errorf("invalid besu metrics: %v", err)
+	}
+	if strings.Join(header, ",") != strings.Join(besuHeader, ",") {
+		return m, 0, fmt.Errorf("invalid besu metrics: unexpected header %q", strings.Join(header, ","))
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return m, 0, nil
+		} else if err != nil {
+			return m, 0, fmt.Errorf("invalid besu metrics: %v", err)
+		}
+		count, err := strconv.ParseUint(rec[1], 10, 64)
+		if err != nil {
+			return m, 0, fmt.Errorf("invalid besu metrics: count of %v: %v", rec[0], err)
+		}
+		ns, err := strconv.ParseInt(rec[2], 10, 64)
+		if err != nil {
+			return m, 0, fmt.Errorf("invalid besu metrics: time of %v: %v", rec[0], err)
+		}
+		if om := meterOp(&m, rec[0]); om != nil {
+			om.Num = count
+			om.Time = time.Duration(ns)
+		}
+	}
+}
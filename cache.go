@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var cacheDir = flag.String("cache", defaultCacheDir(), "Directory for caching the parsed metrics (empty = no caching)")
+
+// cacheVersion is bumped whenever the cache format or the parsing changes,
+// which invalidates all existing cache files.
+const cacheVersion = 5
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "vmstats")
+}
+
+// cachedSnapshot is the raw meters at one block.
+type cachedSnapshot struct {
+	Block  int
+	Meters []opMeter
+}
+
+// cachedStats is a parsed collection, before resets are stitched.
+type cachedStats struct {
+	Snapshots []cachedSnapshot
+	Skipped   [][2]string          // Name and reason of the skipped files
+	Runtime   map[int]runtimeStats // Runtime metrics of the node, by block
+	Salvaged  []string             // Truncated files which were loaded, see loader.salvage
+	Conflicts []string             // Resolutions of conflicting snapshots
+}
+
+// cacheKey hashes the names, sizes and modification times of all files in the
+// given sources, along with the format and the pattern used to select them, and
+// whether invalid files abort the loading. Only local directories and archives
+// can be cached.
+func cacheKey(sources []string, format, pattern string, strict bool) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "v%d %q %q %v\n", cacheVersion, format, pattern, strict)
+	for _, src := range sources {
+		if isRemote(src) || isObjectStore(src) {
+			return "", fmt.Errorf("%v is not a local source", src)
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return "", err
+		}
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%q %d %d\n", abs, info.Size(), info.ModTime().UnixNano())
+		if !info.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(src)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			fmt.Fprintf(h, "%q %d %d\n", f.Name(), f.Size(), f.ModTime().UnixNano())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadCache reads the collection cached under key, and the salvaged files and
+// the conflicts of loading it into l, to be reported again.
+func loadCache(dir, key string, l *loader) (statCollection, error) {
+	stat := newStatCollection()
+	f, err := os.Open(filepath.Join(dir, key+".gob"))
+	if err != nil {
+		return stat, err
+	}
+	defer f.Close()
+	var cached cachedStats
+	if err := gob.NewDecoder(f).Decode(&cached); err != nil {
+		return stat, fmt.Errorf("corrupt cache file %v: %v", f.Name(), err)
+	}
+	for _, snap := range cached.Snapshots {
+		m, err := toMeters(snap.Meters)
+		if err != nil {
+			return stat, fmt.Errorf("corrupt cache file %v: %v", f.Name(), err)
+		}
+		stat.collectMeters(snap.Block, m)
+	}
+	for _, s := range cached.Skipped {
+		stat.skipped = append(stat.skipped, skippedFile{s[0], s[1]})
+	}
+	stat.runtime = cached.Runtime
+	l.salvaged, l.conflicts = cached.Salvaged, cached.Conflicts
+	return stat, nil
+}
+
+// saveCache writes the collection loaded by l to the cache under key. It must
+// be called before the resets are stitched, since the raw meters are cached.
+func saveCache(dir, key string, stat statCollection, l *loader) error {
+	cached := cachedStats{Runtime: stat.runtime, Salvaged: l.salvaged, Conflicts: l.conflicts}
+	for _, number := range stat.numbers() {
+		meters := make([]opMeter, 256)
+		for op, dp := range stat.data[number] {
+			meters[op] = dp.meter()
+		}
+		cached.Snapshots = append(cached.Snapshots, cachedSnapshot{number, meters})
+	}
+	for _, s := range stat.skipped {
+		cached.Skipped = append(cached.Skipped, [2]string{s.name, s.reason})
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that an interrupted write doesn't
+	// leave a corrupt cache behind
+	tmp, err := ioutil.TempFile(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(&cached); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, key+".gob"))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	var m [256]opMeter
+	m[vm.ADD] = opMeter{Num: 10, Time: time.Millisecond}
+	if _, err := writeMetrics(dir, 100, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	key := func(format, pattern string, strict bool) string {
+		k, err := cacheKey([]string{dir}, format, pattern, strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	base := key("geth", `^metrics_to_(\d+)`, false)
+	if key("geth", `^metrics_to_(\d+)`, false) != base {
+		t.Error("key is not stable")
+	}
+	for name, other := range map[string]string{
+		"format":  key("registry", `^metrics_to_(\d+)`, false),
+		"pattern": key("geth", `^metrics_(\d+)`, false),
+		"strict":  key("geth", `^metrics_to_(\d+)`, true),
+	} {
+		if other == base {
+			t.Errorf("key does not depend on the %v", name)
+		}
+	}
+	if _, err := writeMetrics(dir, 200, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if key("geth", `^metrics_to_(\d+)`, false) == base {
+		t.Error("key does not depend on the files")
+	}
+	if _, err := cacheKey([]string{"https://example.com/run"}, "geth", "", false); err == nil {
+		t.Error("remote source is cached")
+	}
+}
+
+// TestCacheReports checks that the salvaged files and the conflicts of a load
+// are cached along with the snapshots, to be reported again.
+func TestCacheReports(t *testing.T) {
+	dir := t.TempDir()
+	stat := newStatCollection()
+	var m [256]opMeter
+	m[vm.SLOAD] = opMeter{Num: 3, Time: 3 * time.Microsecond, Gas: 600}
+	stat.collectMeters(100, m)
+	stat.skipped = []skippedFile{{"metrics_to_x", "invalid block number"}}
+	saved := &loader{salvaged: []string{"metrics_to_200"}, conflicts: []string{"block 100: using a/metrics_to_100, ignoring older b/metrics_to_100"}}
+	if err := saveCache(dir, "key", stat, saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(loader)
+	cached, err := loadCache(dir, "key", loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.salvaged, saved.salvaged) || !reflect.DeepEqual(loaded.conflicts, saved.conflicts) {
+		t.Errorf("reports: %v %v, want %v %v", loaded.salvaged, loaded.conflicts, saved.salvaged, saved.conflicts)
+	}
+	if !reflect.DeepEqual(cached.skipped, stat.skipped) {
+		t.Errorf("skipped: %v, want %v", cached.skipped, stat.skipped)
+	}
+	if got := cached.data[100][vm.SLOAD].meter(); !reflect.DeepEqual(got, m[vm.SLOAD]) {
+		t.Errorf("meter: %+v, want %+v", got, m[vm.SLOAD])
+	}
+}
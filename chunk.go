@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var chunkFlag = flag.Int("chunk", 0,
+	"Process the input in chunks of this many blocks, spilled to disk, to bound the memory usage (0 = load everything at once)")
+
+// spill keeps parsed snapshots on disk, in one file per chunk of blocks. Like
+// buckets, a snapshot at block n belongs in chunk (n-1)/size.
+type spill struct {
+	dir    string
+	size   int          // Blocks per chunk
+	chunks map[int]bool // Chunks holding any snapshots
+}
+
+// spillRecord is the fixed-size part of a spilled snapshot, which is followed
+// by the name and source of the file, and the sub-meters.
+type spillRecord struct {
+	Block   int64
+	ModTime int64 // Unix nanoseconds, zero if unknown
+	Hash    [32]byte
+	Meters  [256]spillMeter
+}
+
+// spillMeter is an opMeter without its sub-meters, which binary.Write can't
+// encode as they are a map.
+type spillMeter struct {
+	Num    uint64
+	Time   time.Duration
+	Gas    uint64
+	Refund uint64
+}
+
+// spillSub is the header of a spilled sub-meter, which is followed by its name.
+type spillSub struct {
+	Op    uint8
+	Meter spillMeter
+}
+
+func newSpill(size int) (*spill, error) {
+	dir, err := ioutil.TempDir("", "vmstats-spill")
+	if err != nil {
+		return nil, err
+	}
+	return &spill{dir: dir, size: size, chunks: make(map[int]bool)}, nil
+}
+
+func (s *spill) path(chunk int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("chunk-%d", chunk))
+}
+
+// add appends the snapshot at blnum to the file of its chunk.
+func (s *spill) add(blnum int, f *parsedFile) error {
+	chunk := (blnum - 1) / s.size
+	out, err := os.OpenFile(s.path(chunk), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	rec := spillRecord{Block: int64(blnum), Hash: f.hash}
+	if !f.modTime.IsZero() {
+		rec.ModTime = f.modTime.UnixNano()
+	}
+	var subs int
+	for op, m := range f.meters {
+		rec.Meters[op] = spillMeter{m.Num, m.Time, m.Gas, m.Refund}
+		subs += len(m.Sub)
+	}
+	w := bufio.NewWriter(out)
+	if err := binary.Write(w, binary.LittleEndian, &rec); err != nil {
+		return err
+	}
+	if err := writeSpillString(w, f.name); err != nil {
+		return err
+	}
+	if err := writeSpillString(w, f.source); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(subs)); err != nil {
+		return err
+	}
+	for op, m := range f.meters {
+		for name, sub := range m.Sub {
+			hdr := spillSub{uint8(op), spillMeter{sub.Num, sub.Time, sub.Gas, sub.Refund}}
+			if err := binary.Write(w, binary.LittleEndian, &hdr); err != nil {
+				return err
+			}
+			if err := writeSpillString(w, name); err != nil {
+				return err
+			}
+		}
+	}
+	s.chunks[chunk] = true
+	return w.Flush()
+}
+
+// writeSpillString writes str, prefixed by its length.
+func writeSpillString(w *bufio.Writer, str string) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(str))); err != nil {
+		return err
+	}
+	_, err := w.WriteString(str)
+	return err
+}
+
+// readSpillString reads a string written by writeSpillString.
+func readSpillString(r io.Reader) (string, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// read calls fn with every snapshot in the chunk, in the order they were added.
+func (s *spill) read(chunk int, fn func(blnum int, f *parsedFile) error) error {
+	in, err := os.Open(s.path(chunk))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r := bufio.NewReader(in)
+	for {
+		var rec spillRecord
+		if err := binary.Read(r, binary.LittleEndian, &rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		f := &parsedFile{metricsFile: new(metricsFile), hash: rec.Hash}
+		for op, m := range rec.Meters {
+			f.meters[op] = opMeter{Num: m.Num, Time: m.Time, Gas: m.Gas, Refund: m.Refund}
+		}
+		if rec.ModTime != 0 {
+			f.modTime = time.Unix(0, rec.ModTime)
+		}
+		var err error
+		if f.name, err = readSpillString(r); err != nil {
+			return err
+		}
+		if f.source, err = readSpillString(r); err != nil {
+			return err
+		}
+		var subs uint32
+		if err := binary.Read(r, binary.LittleEndian, &subs); err != nil {
+			return err
+		}
+		for i := uint32(0); i < subs; i++ {
+			var hdr spillSub
+			if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+				return err
+			}
+			name, err := readSpillString(r)
+			if err != nil {
+				return err
+			}
+			m := &f.meters[hdr.Op]
+			if m.Sub == nil {
+				m.Sub = make(map[string]opMeter)
+			}
+			m.Sub[name] = opMeter{Num: hdr.Meter.Num, Time: hdr.Meter.Time, Gas: hdr.Meter.Gas, Refund: hdr.Meter.Refund}
+		}
+		if err := fn(int(rec.Block), f); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *spill) close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// loadChunked loads the files in chunks of the given number of blocks. The
+// parsed files are first spilled to disk, then the chunks are loaded one at a
+// time, checked, and reduced to their last snapshot. Only one chunk is held in
+// memory at any time, and the collection ends up with one snapshot per chunk.
+func (l *loader) loadChunked(ctx context.Context, sources []string, match func(name string) bool, size int) error {
+	s, err := newSpill(size)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	failed, err := parseFiles(ctx, sources, match, l.progress.track(func(f *parsedFile) error {
+		l.salvage(f)
+		blnum, ok, err := l.block(f)
+		if !ok {
+			return err
+		}
+		if f.err != nil {
+			return l.skip(f.name, f.err.Error())
+		}
+		// The runtime metrics are kept for all snapshots, not only the last of
+		// every chunk, as they are few
+		if f.runtime != nil {
+			l.stat.collectRuntime(blnum, *f.runtime)
+		}
+		return s.add(blnum, f)
+	}))
+	l.skipped = append(l.skipped, failed...)
+	if err != nil {
+		return err
+	}
+	var chunks []int
+	for chunk := range s.chunks {
+		chunks = append(chunks, chunk)
+	}
+	sort.Ints(chunks)
+
+	var (
+		result   = l.stat
+		st       stitcher
+		resets   []int
+		spanning []int // Last snapshots of the chunks with a reset
+		warnings []dataWarning
+		last     int // Block number of the last snapshot of the previous chunk
+	)
+	for _, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		part := newStatCollection()
+		part.resets = make(map[int]bool)
+		l.stat, l.loaded = &part, make(map[int]origin)
+		if err := s.read(chunk, l.addBlock); err != nil {
+			return fmt.Errorf("chunk %d: %v", chunk, err)
+		}
+		numbers := part.numbers()
+		if len(numbers) == 0 {
+			continue
+		}
+		var reset bool
+		for _, number := range numbers {
+			if st.stitch(&part, number) {
+				resets = append(resets, number)
+				part.resets[number] = true
+				reset = true
+			}
+		}
+		// Validate the interval from the previous chunk as well, the stitched
+		// snapshot ending it is left as it is.
+		if last != 0 {
+			part.data[last] = result.data[last]
+			part.index = append([]int{last}, part.index...)
+		}
+		warnings = append(warnings, part.validate(*minOpTimeFlag, *maxOpTimeFlag)...)
+
+		last = numbers[len(numbers)-1]
+		result.data[last] = part.data[last]
+		result.index = append(result.index, last)
+		if reset {
+			spanning = append(spanning, last)
+		}
+	}
+	l.stat = result
+	// Only the last snapshot of every chunk is kept, so the interval spanning a
+	// reset is the one ending at the last snapshot of its chunk. The resets
+	// themselves are kept as well, for the runtime metrics of all snapshots.
+	result.resets = make(map[int]bool, len(resets)+len(spanning))
+	for _, number := range append(resets, spanning...) {
+		result.resets[number] = true
+	}
+	reportChecks(resets, warnings)
+	return nil
+}
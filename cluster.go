@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var clustersFlag = flag.Int("clusters", 0, "Group the opcodes into this many clusters by the evolution of their ms/Mgas, and chart each (0 = none)")
+
+const (
+	trajectoryPoints = 100 // Number of samples of every trajectory
+	kmeansRestarts   = 10  // Number of random initializations, the best one is kept
+	kmeansIterations = 100
+)
+
+// trajectory returns the ms/Mgas of op resampled at the given blocks, and
+// standardized to zero mean and unit variance, so that opcodes are compared by
+// the shape of their cost evolution rather than its level. It returns nil if
+// op has too few intervals, or a constant cost.
+func trajectory(stat statCollection, op vm.OpCode, grid []float64) []float64 {
+	xvals, yvals := stat.series(op, 0, metrics["timepergas"])
+	if len(xvals) < minCommon {
+		return nil
+	}
+	var (
+		s    = &sysSeries{blocks: xvals, values: yvals}
+		traj = make([]float64, len(grid))
+		mean float64
+	)
+	for i, block := range grid {
+		v, ok := s.at(block)
+		if !ok {
+			// Before the first or after the last interval, hold the edge
+			if v = yvals[0]; block > xvals[len(xvals)-1] {
+				v = yvals[len(yvals)-1]
+			}
+		}
+		traj[i] = v
+		mean += v
+	}
+	mean /= float64(len(traj))
+	var variance float64
+	for _, v := range traj {
+		variance += (v - mean) * (v - mean)
+	}
+	if variance == 0 {
+		return nil
+	}
+	sd := math.Sqrt(variance / float64(len(traj)))
+	for i := range traj {
+		traj[i] = (traj[i] - mean) / sd
+	}
+	return traj
+}
+
+func sqDistance(a, b []float64) float64 {
+	var d float64
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d
+}
+
+// kmeans partitions the points into k clusters, returning the cluster of every
+// point. The initial centroids are chosen with k-means++, the best of several
+// restarts is kept. The seed is fixed, so the clustering is reproducible.
+func kmeans(points [][]float64, k int) []int {
+	var (
+		rnd     = rand.New(rand.NewSource(1))
+		best    []int
+		inertia = math.Inf(1)
+	)
+	for restart := 0; restart < kmeansRestarts; restart++ {
+		// k-means++: every next centroid is picked with a probability
+		// proportional to its squared distance to the nearest one so far
+		centroids := [][]float64{points[rnd.Intn(len(points))]}
+		for len(centroids) < k {
+			dists := make([]float64, len(points))
+			var total float64
+			for i, p := range points {
+				dists[i] = math.Inf(1)
+				for _, c := range centroids {
+					dists[i] = math.Min(dists[i], sqDistance(p, c))
+				}
+				total += dists[i]
+			}
+			pick, target := 0, rnd.Float64()*total
+			for ; pick < len(points)-1 && target > dists[pick]; pick++ {
+				target -= dists[pick]
+			}
+			centroids = append(centroids, points[pick])
+		}
+		assign := make([]int, len(points))
+		for iter := 0; iter < kmeansIterations; iter++ {
+			changed := iter == 0
+			for i, p := range points {
+				nearest := 0
+				for c := range centroids {
+					if sqDistance(p, centroids[c]) < sqDistance(p, centroids[nearest]) {
+						nearest = c
+					}
+				}
+				if assign[i] != nearest {
+					assign[i], changed = nearest, true
+				}
+			}
+			if !changed {
+				break
+			}
+			// Move the centroids to the means of their clusters, an empty
+			// cluster keeps its centroid
+			for c := range centroids {
+				mean := make([]float64, len(points[0]))
+				var members int
+				for i, p := range points {
+					if assign[i] != c {
+						continue
+					}
+					for j, v := range p {
+						mean[j] += v
+					}
+					members++
+				}
+				if members == 0 {
+					continue
+				}
+				for j := range mean {
+					mean[j] /= float64(members)
+				}
+				centroids[c] = mean
+			}
+		}
+		var sum float64
+		for i, p := range points {
+			sum += sqDistance(p, centroids[assign[i]])
+		}
+		if sum < inertia {
+			best, inertia = assign, sum
+		}
+	}
+	return best
+}
+
+// clusterOps groups the executed opcodes by the evolution of their ms/Mgas,
+// returning the non-empty clusters.
+func clusterOps(stat statCollection, k int) ([][]vm.OpCode, error) {
+	numbers := stat.numbers()
+	if len(numbers) < 2 {
+		return nil, fmt.Errorf("need at least two snapshots to cluster")
+	}
+	first, last := float64(numbers[0]), float64(numbers[len(numbers)-1])
+	grid := make([]float64, trajectoryPoints)
+	for i := range grid {
+		grid[i] = first + (last-first)*float64(i)/float64(trajectoryPoints-1)
+	}
+	var (
+		ops    []vm.OpCode
+		points [][]float64
+	)
+	for _, op := range withoutExcluded(allOps) {
+		if traj := trajectory(stat, op, grid); traj != nil {
+			ops = append(ops, op)
+			points = append(points, traj)
+		}
+	}
+	if len(ops) < k {
+		return nil, fmt.Errorf("only %d opcodes to cluster into %d clusters", len(ops), k)
+	}
+	clusters := make([][]vm.OpCode, k)
+	for i, c := range kmeans(points, k) {
+		clusters[c] = append(clusters[c], ops[i])
+	}
+	var result [][]vm.OpCode
+	for _, cluster := range clusters {
+		if len(cluster) > 0 {
+			result = append(result, cluster)
+		}
+	}
+	return result, nil
+}
+
+// chartClusters renders a ms/Mgas chart for every cluster of opcodes, and lists
+// the members of the clusters.
+func chartClusters(ctx context.Context, w io.Writer, stat statCollection, run runMeta) error {
+	clusters, err := clusterOps(stat, *clustersFlag)
+	if err != nil {
+		return err
+	}
+	var fails failures
+	fmt.Fprintf(w, "\nClusters of opcodes by ms/Mgas evolution\n")
+	for i, cluster := range clusters {
+		fmt.Fprintf(w, "%d: %v\n", i+1, strings.Join(opNames(cluster), ", "))
+	}
+	for i, cluster := range clusters {
+		if err := ctx.Err(); err != nil {
+			fails.add(err)
+			break
+		}
+		spec := chartSpec{
+			File:   fmt.Sprintf("cluster-%d.png", i+1),
+			Title:  fmt.Sprintf("Milliseconds per Mgas (cluster %d of %d) - {{.Run}}", i+1, len(clusters)),
+			Ops:    opNames(cluster),
+			Metric: "timepergas",
+		}
+		paths, err := spec.render(ctx, stat, run)
+		for _, path := range paths {
+			fmt.Fprintln(w, path)
+		}
+		fails.add(err)
+	}
+	return fails.err()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	rpcFlag   = flag.String("rpc", "http://localhost:8545", "HTTP RPC endpoint of the node to collect from, with the debug API enabled")
+	fromFlag  = flag.Int("from", 1, "First block to collect, re-execute or correlate")
+	toFlag    = flag.Int("to", 0, "Last block to collect, re-execute or correlate")
+	everyFlag = flag.Int("every", 1000, "Number of blocks between the snapshots of collect and --chaindata")
+	outFlag   = flag.String("out", ".", "Directory to write the collected metrics files to")
+)
+
+// countTracer is a JavaScript tracer which counts the executed opcodes of a
+// transaction, by executing contract and opcode value.
+const countTracer = `{
+	counts: {},
+	step: function(log) {
+		var addr = toHex(log.contract.getAddress());
+		var counts = this.counts[addr] || (this.counts[addr] = {});
+		var op = log.op.toNumber();
+		counts[op] = (counts[op] || 0) + 1;
+	},
+	fault: function() {},
+	result: function() { return this.counts; }
+}`
+
+// rpcClient is a minimal JSON-RPC client.
+type rpcClient struct {
+	url string
+	id  int
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %v", e.Code, e.Message)
+}
+
+// call invokes method with params and decodes its result into result.
+func (c *rpcClient) call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	c.id++
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %v", method, resp.Status)
+	}
+	var msg struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("%v: %v", method, err)
+	}
+	if msg.Error != nil {
+		return fmt.Errorf("%v: %v", method, msg.Error)
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// traceCounts traces all transactions of a block, and adds up the executed
+// opcodes. With withTxs, the counts of every transaction are returned as well.
+func (c *rpcClient) traceCounts(ctx context.Context, number int, m *[256]opMeter, withTxs bool) ([]txMeters, error) {
+	var traces []struct {
+		Result map[string]map[string]uint64 `json:"result"`
+		Error  string                       `json:"error"`
+	}
+	err := c.call(ctx, &traces, "debug_traceBlockByNumber", "0x"+strconv.FormatInt(int64(number), 16),
+		map[string]string{"tracer": countTracer})
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %v", number, err)
+	}
+	var (
+		hashes []string
+		txs    []txMeters
+	)
+	if withTxs {
+		var block struct {
+			Transactions []string `json:"transactions"`
+		}
+		err := c.call(ctx, &block, "eth_getBlockByNumber", "0x"+strconv.FormatInt(int64(number), 16), false)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", number, err)
+		}
+		hashes = block.Transactions
+	}
+	for i, trace := range traces {
+		if trace.Error != "" {
+			return nil, fmt.Errorf("block %d, transaction %d: %v", number, i, trace.Error)
+		}
+		tx := txMeters{
+			Block:     number,
+			Index:     i,
+			Meters:    make(map[string]opMeter),
+			Contracts: make(map[string]map[string]opMeter),
+		}
+		if i < len(hashes) {
+			tx.Hash = hashes[i]
+		}
+		for addr, counts := range trace.Result {
+			contract := make(map[string]opMeter)
+			for key, count := range counts {
+				op, err := strconv.Atoi(key)
+				if err != nil || op < 0 || op > 0xff {
+					return nil, fmt.Errorf("block %d, transaction %d: invalid opcode %q", number, i, key)
+				}
+				m[op].Num += count
+				name := vm.OpCode(op).String()
+				contract[name] = opMeter{Num: count}
+				sum := tx.Meters[name]
+				sum.Num += count
+				tx.Meters[name] = sum
+			}
+			tx.Contracts[addr] = contract
+		}
+		if withTxs {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+// writeMetrics writes the cumulative meters at the given block as a version 2
+// metrics file, or version 3 if there are transactions, named like the default
+// pattern expects. The file is written atomically, so an interrupted
+// collection leaves no partial files.
+func writeMetrics(dir string, number int, m [256]opMeter, txs []txMeters) (string, error) {
+	version := schemaV2
+	if txs != nil {
+		version = schemaV3
+	}
+	data, err := json.Marshal(struct {
+		Version int        `json:"version"`
+		Block   int        `json:"block"`
+		Meters  []opMeter  `json:"meters"`
+		Txs     []txMeters `json:"txs,omitempty"`
+	}{version, number, m[:], txs})
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("metrics_to_%d.json", number))
+	tmp, err := ioutil.TempFile(dir, ".metrics-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// collectCmd implements "vmstats collect", which traces a block range on a
+// node and writes metrics files for it. The RPC tracers have no timings, so
+// only the execution counts are collected, and the time based metrics of the
+// files are zero.
+func collectCmd(ctx context.Context) {
+	if *toFlag < *fromFlag {
+		fatal(exitUsage, "Invalid block range, see --from and --to", "from", *fromFlag, "to", *toFlag)
+	}
+	if *everyFlag <= 0 {
+		fatal(exitUsage, "Invalid interval, see --every", "every", *everyFlag)
+	}
+	if err := os.MkdirAll(*outFlag, 0755); err != nil {
+		fatal(exitFailure, "Failed to create output directory", "err", err)
+	}
+	var (
+		client = &rpcClient{url: *rpcFlag}
+		meters [256]opMeter
+		txs    []txMeters // Transactions since the last snapshot, with --per-tx
+	)
+	log.Info("Collecting metrics", "rpc", *rpcFlag, "from", *fromFlag, "to", *toFlag, "pertx", *perTxFlag)
+	for number := *fromFlag; number <= *toFlag; number++ {
+		blockTxs, err := client.traceCounts(ctx, number, &meters, *perTxFlag)
+		if err != nil {
+			fatal(exitCode(err), "Failed to trace block", "err", err)
+		}
+		txs = append(txs, blockTxs...)
+		if (number-*fromFlag+1)%*everyFlag != 0 && number != *toFlag {
+			continue
+		}
+		if *perTxFlag && txs == nil {
+			// An interval without transactions is still a v3 snapshot
+			txs = []txMeters{}
+		}
+		path, err := writeMetrics(*outFlag, number, meters, txs)
+		if err != nil {
+			fatal(exitFailure, "Failed to write metrics", "err", err)
+		}
+		txs = nil
+		log.Info("Wrote metrics", "block", number, "file", path)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+)
+
+var (
+	clientsFlag     = flag.String("clients", "", "Clients to compare, as comma-separated format=dir pairs, e.g. geth=./run1,nethermind=./run2")
+	compareOpsFlag  = flag.String("compare-ops", "SLOAD,BALANCE,BLOCKHASH", "Comma-separated opcodes or groups to chart in the comparison")
+	underpricedFlag = flag.Float64("underpriced", 2, "Report opcodes whose ms/Mgas is at least this many times the overall ms/Mgas of a client, or of a fork era with --attack-surface")
+)
+
+// client is the data of one client in a comparison.
+type client struct {
+	name string
+	stat statCollection
+}
+
+// loadClients loads the metrics of every client in the given list of
+// format=dir pairs, each in its own format.
+func loadClients(ctx context.Context, list string) ([]client, error) {
+	var clients []client
+	for _, entry := range strings.Split(list, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid client %q, expected format=dir", entry)
+		}
+		// Runs of the same client are told apart by the names in their metadata
+		kind, dir := parts[0], parts[1]
+		meta, err := dirRunMeta(dir, kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range clients {
+			if c.name == meta.Name {
+				return nil, fmt.Errorf("client %v is listed twice", meta.Name)
+			}
+		}
+		if err := setFormat(kind); err != nil {
+			return nil, err
+		}
+		if format.deltas && *chunkFlag > 0 {
+			return nil, fmt.Errorf("chunked loading needs cumulative meters, which %v doesn't have", kind)
+		}
+		stat := loadStats(ctx, dir)
+		if len(stat.numbers()) == 0 {
+			return nil, fmt.Errorf("no metrics loaded for %v from %v", meta.Name, dir)
+		}
+		if err := meta.normalize(&stat); err != nil {
+			return nil, err
+		}
+		clients = append(clients, client{meta.Name, stat})
+	}
+	if len(clients) < 2 {
+		return nil, fmt.Errorf("need at least two clients to compare")
+	}
+	return clients, nil
+}
+
+// compareClients charts the ms/Mgas of the selected opcodes of all clients on
+// top of each other, one chart per opcode, and reports the opcodes which are
+// underpriced in any of the clients.
+func compareClients(ctx context.Context, w io.Writer, clients []client) error {
+	ops, err := parseOps(strings.Split(*compareOpsFlag, ","))
+	if err != nil {
+		return err
+	}
+	var fails failures
+	for _, op := range withoutExcluded(ops) {
+		if err := ctx.Err(); err != nil {
+			fails.add(err)
+			break
+		}
+		path, err := plotComparison(op, clients, fmt.Sprintf("compare-%v.png", opName(op)))
+		if err == nil {
+			fmt.Fprintln(w, path)
+		}
+		fails.add(err)
+	}
+	printConsensus(w, clients, *underpricedFlag)
+	return fails.err()
+}
+
+// plotComparison renders the ms/Mgas of op of every client.
+func plotComparison(op vm.OpCode, clients []client, filename string) (string, error) {
+	var series []chart.Series
+	for _, c := range clients {
+		xvals, yvals := c.stat.series(op, 0, metrics["timepergas"])
+		if len(xvals) == 0 {
+			continue
+		}
+		if layout.MaxPoints > 0 {
+			xvals, yvals = lttb(xvals, yvals, layout.MaxPoints)
+		}
+		series = append(series, chart.ContinuousSeries{
+			Name:    c.name,
+			XValues: xvals,
+			YValues: yvals,
+		})
+	}
+	if len(series) == 0 {
+		return "", fmt.Errorf("%v: no client executed %v", filename, opName(op))
+	}
+	title := fmt.Sprintf("Milliseconds per Mgas (%v) - %d clients", opName(op), len(series))
+	if *normalizeFlag {
+		title += ", normalized"
+	}
+	width, height := layout.size(0, 0)
+	graph := chart.Chart{
+		Title:        title,
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		Background: chart.Style{
+			Padding: layout.padding(chart.Box{}),
+		},
+		XAxis: blockAxis("Blocknumber"),
+		YAxis: chart.YAxis{
+			Name:      metricLabel("timepergas"),
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		},
+		Series: series,
+	}
+	from, to := seriesRange(series)
+	addDateAxis(&graph, from, to)
+	toGasAxis(&graph)
+	var names []string
+	for _, c := range clients {
+		names = append(names, c.name)
+	}
+	return renderChart(&graph, layout, filename, map[string]interface{}{
+		"op": opName(op), "clients": names, "metric": "timepergas", "normalized": *normalizeFlag,
+	})
+}
+
+// renderChart adds the legend to graph and writes it to the charts directory,
+// along with its sidecar with the given parameters.
+func renderChart(graph *chart.Chart, l chartLayout, filename string, params interface{}) (string, error) {
+	legend, err := l.legend(graph)
+	if err != nil {
+		return "", err
+	}
+	graph.Elements = append(graph.Elements, legend...)
+	buffer := bytes.NewBuffer([]byte{})
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("./charts/%s", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return path, err
+	}
+	return path, writeSidecar(path, lineSidecar(*graph, params))
+}
+
+// printConsensus writes a table of the opcodes which are underpriced in at
+// least one client: those whose ms/Mgas is at least factor times the overall
+// ms/Mgas of the client. Relating every opcode to its own client cancels out
+// the differences in hardware and overall speed between the runs. Opcodes
+// which are underpriced in all clients are listed first.
+func printConsensus(w io.Writer, clients []client, factor float64) {
+	type verdict struct {
+		op     vm.OpCode
+		ratios []float64 // Per client, zero if not executed
+		in     []string  // Clients where the opcode is underpriced
+	}
+	ratios := make(map[vm.OpCode][]float64)
+	for i, c := range clients {
+		numbers := c.stat.numbers()
+		points := c.stat.delta(0, numbers[len(numbers)-1])
+		var time, gas float64
+		for _, dp := range points {
+			if dp.totalGas() > 0 {
+				time += float64(dp.execTime)
+				gas += float64(dp.totalGas())
+			}
+		}
+		if gas == 0 {
+			continue
+		}
+		overall := time / gas // Nanoseconds per gas, i.e. ms/Mgas
+		for _, dp := range points {
+			if dp.totalGas() == 0 {
+				continue
+			}
+			if ratios[dp.op] == nil {
+				ratios[dp.op] = make([]float64, len(clients))
+			}
+			ratios[dp.op][i] = dp.MilliSecondsPerMgas() / overall
+		}
+	}
+	var verdicts []verdict
+	for op, r := range ratios {
+		v := verdict{op: op, ratios: r}
+		for i, ratio := range r {
+			if ratio >= factor {
+				v.in = append(v.in, clients[i].name)
+			}
+		}
+		if len(v.in) > 0 {
+			verdicts = append(verdicts, v)
+		}
+	}
+	peak := func(v verdict) float64 {
+		var m float64
+		for _, r := range v.ratios {
+			if r > m {
+				m = r
+			}
+		}
+		return m
+	}
+	sort.Slice(verdicts, func(i, j int) bool {
+		if len(verdicts[i].in) != len(verdicts[j].in) {
+			return len(verdicts[i].in) > len(verdicts[j].in)
+		}
+		if a, b := peak(verdicts[i]), peak(verdicts[j]); a != b {
+			return a > b
+		}
+		return verdicts[i].op < verdicts[j].op
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nOpcodes at %.1fx or more of the overall ms/Mgas of a client\n", factor)
+	fmt.Fprintf(tw, "OPCODE\t")
+	for _, c := range clients {
+		fmt.Fprintf(tw, "%v\t", strings.ToUpper(c.name))
+	}
+	fmt.Fprintf(tw, "UNDERPRICED IN\t\n")
+	for _, v := range verdicts {
+		fmt.Fprintf(tw, "%v\t", opName(v.op))
+		for _, r := range v.ratios {
+			if r == 0 {
+				fmt.Fprintf(tw, "-\t")
+			} else {
+				fmt.Fprintf(tw, "%.2fx\t", r)
+			}
+		}
+		in := strings.Join(v.in, ", ")
+		if len(v.in) == len(clients) {
+			in = "all clients"
+		}
+		fmt.Fprintf(tw, "%v\t\n", in)
+	}
+	tw.Flush()
+}
+
+// compareCmd implements "vmstats compare".
+func compareCmd(ctx context.Context) {
+	if *clientsFlag == "" {
+		fatal(exitUsage, "No clients to compare, see --clients")
+	}
+	clients, err := loadClients(ctx, *clientsFlag)
+	if err != nil {
+		fatal(exitCode(err), "Failed to load clients", "err", err)
+	}
+	var fails failures
+	fails.add(compareClients(ctx, os.Stdout, clients))
+	fails.add(writeManifest())
+	fails.finish(statCollection{})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+)
+
+var profileFlag = flag.String("profile", "", "Comma-separated opcodes to render a count/time/ms-per-Mgas profile for")
+
+// profileMetrics are the panels of an opcode profile, top to bottom.
+var profileMetrics = []string{"count", "time", "timepergas"}
+
+// plotComposite renders one panel per metric for the given ops, and stacks them
+// vertically into a single image. The panels share the X axis, which is only
+// drawn on the bottom panel.
+func plotComposite(ops []vm.OpCode, stat statCollection, panels []string, yFuncs map[string]func(*dataPoint) float64,
+	title, filename string, opts plotOpts) (string, error) {
+
+	// Pin the X range so that the panels line up
+	var numbers []int
+	for _, n := range stat.numbers() {
+		if n >= opts.fromBlock {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) == 0 {
+		return "", fmt.Errorf("no data to plot for %v", filename)
+	}
+	xRange := &chart.ContinuousRange{
+		Min: float64(numbers[0]),
+		Max: float64(numbers[len(numbers)-1]),
+	}
+	// With --xaxis gas, the series of the panels are already on the gas axis
+	if gasAxis {
+		xRange.Min, xRange.Max = blockGas(xRange.Min), blockGas(xRange.Max)
+	}
+	var (
+		images []image.Image
+		sc     = sidecar{Title: title, Params: opts.params}
+	)
+	for i, metric := range panels {
+		panelTitle := metricLabel(metric)
+		if i == 0 {
+			panelTitle = fmt.Sprintf("%v - %v", title, panelTitle)
+		}
+		graph, err := lineChart(ops, stat, yFuncs[metric], panelTitle, "Blocknumber", metricLabel(metric), opts)
+		if err != nil {
+			return "", err
+		}
+		graph.XAxis.Range = xRange
+		for _, s := range lineSidecar(graph, nil).Series {
+			s.Name = fmt.Sprintf("%v: %v", metric, s.Name)
+			sc.Series = append(sc.Series, s)
+		}
+		if i < len(panels)-1 {
+			graph.XAxis.Name = ""
+			graph.XAxis.Style = chart.Style{}
+		}
+		buffer := bytes.NewBuffer([]byte{})
+		if err := graph.Render(chart.PNG, buffer); err != nil {
+			return "", err
+		}
+		img, err := png.Decode(buffer)
+		if err != nil {
+			return "", err
+		}
+		images = append(images, img)
+	}
+	// Stack the panels
+	var width, height int
+	for _, img := range images {
+		if w := img.Bounds().Dx(); w > width {
+			width = w
+		}
+		height += img.Bounds().Dy()
+	}
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	y := 0
+	for _, img := range images {
+		b := img.Bounds()
+		draw.Draw(out, image.Rect(0, y, b.Dx(), y+b.Dy()), img, b.Min, draw.Src)
+		y += b.Dy()
+	}
+	path := fmt.Sprintf("./charts/%s", filename)
+	f, err := os.Create(path)
+	if err != nil {
+		return path, err
+	}
+	defer f.Close()
+	if err := png.Encode(f, out); err != nil {
+		return path, err
+	}
+	return path, writeSidecar(path, sc)
+}
+
+// plotProfiles renders a composite count/time/ms-per-Mgas chart for each
+// of the comma-separated opcodes.
+func plotProfiles(ctx context.Context, stat statCollection, run runMeta, opnames string) error {
+	spec := chartSpec{
+		File:   "profile-{{.Op}}.png",
+		Title:  "Profile of {{.Op}} - {{.Run}}",
+		Ops:    strings.Split(opnames, ","),
+		PerOp:  true,
+		Panels: profileMetrics,
+	}
+	paths, err := spec.render(ctx, stat, run)
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return err
+}
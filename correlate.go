@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var correlateFlag = flag.String("correlate", "", "Comma-separated opcodes or groups to render a ms/Mgas correlation matrix of, e.g. storage,context")
+
+// minCommon is the number of intervals two opcodes must have in common for
+// their correlation to be computed.
+const minCommon = 3
+
+// corrMatrix holds the pairwise correlations of the ms/Mgas of a set of
+// opcodes. Pairs with too few common intervals are NaN.
+type corrMatrix struct {
+	ops []vm.OpCode
+	r   [][]float64
+}
+
+// correlations computes the pairwise correlation of the ms/Mgas series of the
+// ops, over the intervals ending in the block range in which both were
+// executed. Opcodes which were never executed in the range are left out.
+func correlations(stat statCollection, ops []vm.OpCode, from, to int) corrMatrix {
+	var (
+		m      corrMatrix
+		series []map[float64]float64
+		blocks [][]float64 // Of every series in order, so the sums are reproducible
+	)
+	for _, op := range ops {
+		xvals, yvals := stat.series(op, from, metrics["timepergas"])
+		var (
+			points = make(map[float64]float64)
+			xs     []float64
+		)
+		for i, x := range xvals {
+			if to == 0 || x <= float64(to) {
+				points[x] = yvals[i]
+				xs = append(xs, x)
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+		m.ops = append(m.ops, op)
+		series = append(series, points)
+		blocks = append(blocks, xs)
+	}
+	m.r = make([][]float64, len(m.ops))
+	for i := range m.ops {
+		m.r[i] = make([]float64, len(m.ops))
+		for j := 0; j <= i; j++ {
+			var xs, ys []float64
+			for _, block := range blocks[i] {
+				y := series[i][block]
+				if x, ok := series[j][block]; ok {
+					xs = append(xs, x)
+					ys = append(ys, y)
+				}
+			}
+			r := math.NaN()
+			if len(xs) >= minCommon {
+				r = pearson(xs, ys)
+			}
+			m.r[i][j], m.r[j][i] = r, r
+		}
+	}
+	return m
+}
+
+// printCorrelations lists the n most strongly correlated pairs of opcodes,
+// positively or negatively.
+func printCorrelations(w io.Writer, m corrMatrix, n int) {
+	type pair struct {
+		a, b vm.OpCode
+		r    float64
+	}
+	var pairs []pair
+	for i := range m.ops {
+		for j := 0; j < i; j++ {
+			if !math.IsNaN(m.r[i][j]) {
+				pairs = append(pairs, pair{m.ops[j], m.ops[i], m.r[i][j]})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return math.Abs(pairs[i].r) > math.Abs(pairs[j].r)
+	})
+	if len(pairs) > n {
+		pairs = pairs[:n]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nMost correlated ms/Mgas\n")
+	fmt.Fprintf(tw, "OPCODE\tOPCODE\tCORRELATION\t\n")
+	for _, p := range pairs {
+		fmt.Fprintf(tw, "%v\t%v\t%.3f\t\n", opName(p.a), opName(p.b), p.r)
+	}
+	tw.Flush()
+}
+
+// corrColor maps a correlation to a diverging scale, from blue at -1 over the
+// background at 0 to red at 1. Missing correlations are grey.
+func corrColor(r float64) drawing.Color {
+	if math.IsNaN(r) {
+		return drawing.Color{R: 128, G: 128, B: 128, A: 255}
+	}
+	fade := uint8(255 * (1 - math.Min(math.Abs(r), 1)))
+	if r > 0 {
+		return drawing.Color{R: 255, G: fade, B: fade, A: 255}
+	}
+	return drawing.Color{R: fade, G: fade, B: 255, A: 255}
+}
+
+// plotCorrelations renders the matrix as a heatmap, with the opcode names along
+// both axes and the correlation in the cells which are large enough to hold it.
+func plotCorrelations(m corrMatrix, title, filename string) (string, error) {
+	n := len(m.ops)
+	if n < 2 {
+		return "", fmt.Errorf("%v: need at least two executed opcodes to correlate", filename)
+	}
+	const (
+		margin = 90 // Room for the opcode names
+		top    = 40 // Room for the title
+		scale  = 20 // Width of the color scale
+	)
+	cell := 600 / n
+	if cell > 40 {
+		cell = 40
+	} else if cell < 12 {
+		cell = 12
+	}
+	var (
+		width  = margin + n*cell + 3*scale + 40
+		height = top + margin + n*cell + 20
+	)
+	r, err := chart.PNG(width, height)
+	if err != nil {
+		return "", err
+	}
+	if layout.DPI > 0 {
+		r.SetDPI(layout.DPI)
+	}
+	font, err := chart.GetDefaultFont()
+	if err != nil {
+		return "", err
+	}
+	background := drawing.ColorWhite
+	if colors != nil {
+		background = colors.BackgroundColor()
+	}
+	text := chart.Style{Font: font, FontColor: foreground, FontSize: 10}
+	chart.Draw.Box(r, chart.Box{Right: width, Bottom: height}, chart.Style{FillColor: background})
+	chart.Draw.Text(r, title, margin, top/2+5, chart.Style{Font: font, FontColor: foreground, FontSize: 12})
+
+	x0, y0 := margin, top+margin
+	for i, op := range m.ops {
+		// Row names on the left, column names rotated on top
+		chart.Draw.Text(r, opName(op), 5, y0+i*cell+cell/2+4, text)
+		rotated := text
+		rotated.TextRotationDegrees = 270
+		chart.Draw.Text(r, opName(op), x0+i*cell+cell/2+4, y0-5, rotated)
+		for j := range m.ops {
+			box := chart.Box{Left: x0 + j*cell, Top: y0 + i*cell, Right: x0 + (j+1)*cell, Bottom: y0 + (i+1)*cell}
+			chart.Draw.Box(r, box, chart.Style{FillColor: corrColor(m.r[i][j]), StrokeColor: background, StrokeWidth: 1})
+			if cell >= 32 && !math.IsNaN(m.r[i][j]) {
+				value := text
+				value.FontSize = 7
+				value.FontColor = drawing.ColorBlack
+				chart.Draw.Text(r, fmt.Sprintf("%.2f", m.r[i][j]), box.Left+3, box.Top+cell/2+3, value)
+			}
+		}
+	}
+	// The color scale, from 1 at the top to -1 at the bottom
+	sx, steps := x0+n*cell+scale, n*cell
+	for k := 0; k < steps; k++ {
+		v := 1 - 2*float64(k)/float64(steps)
+		chart.Draw.Box(r, chart.Box{Left: sx, Top: y0 + k, Right: sx + scale, Bottom: y0 + k + 1}, chart.Style{FillColor: corrColor(v)})
+	}
+	chart.Draw.Text(r, "1", sx+scale+4, y0+8, text)
+	chart.Draw.Text(r, "0", sx+scale+4, y0+steps/2+4, text)
+	chart.Draw.Text(r, "-1", sx+scale+4, y0+steps, text)
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := r.Save(buffer); err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("./charts/%s", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return path, err
+	}
+	// One series per row of the matrix, labelled by the columns
+	sc := sidecar{Title: title, Params: map[string]interface{}{"metric": "timepergas", "minCommon": minCommon}}
+	for i, op := range m.ops {
+		sc.Series = append(sc.Series, sidecarSeries{Name: opName(op), Labels: opNames(m.ops), Y: jsonFloats(m.r[i])})
+	}
+	return path, writeSidecar(path, sc)
+}
+
+// correlateOps renders the correlation matrix of the opcodes given with
+// --correlate, over the blocks from --from to --to, and prints the most
+// correlated pairs.
+func correlateOps(w io.Writer, stat statCollection) error {
+	ops, err := parseOps(strings.Split(*correlateFlag, ","))
+	if err != nil {
+		return err
+	}
+	m := correlations(stat, withoutExcluded(ops), *fromFlag, *toFlag)
+	title := fmt.Sprintf("Correlation of ms/Mgas - %d opcodes", len(m.ops))
+	if *toFlag > 0 {
+		title += fmt.Sprintf(", blocks %d-%d", *fromFlag, *toFlag)
+	}
+	path, err := plotCorrelations(m, title, "correlation.png")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, path)
+	printCorrelations(w, m, *top)
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	reportsFlag     = flag.String("reports", "./reports", "Directory the daemon publishes its reports to, one subdirectory per report")
+	reportEveryFlag = flag.Duration("report-every", 24*time.Hour, "Interval between the reports of the daemon, aligned to UTC midnight")
+	keepFlag        = flag.Int("keep", 7, "Number of reports the daemon keeps, older ones are deleted (0 = keep all)")
+)
+
+// reportStamp is the layout of the names of the report directories, which
+// sort by time.
+const reportStamp = "20060102-1504"
+
+// daemonCmd implements "vmstats daemon", which reloads the metrics of --dir on
+// a schedule, as it grows, and publishes the full report of the run to a new
+// directory under --reports. The latest report is linked as "latest", and only
+// the --keep latest reports are kept. The first report is made right away, the
+// next ones every --report-every, at multiples of it since UTC midnight, e.g.
+// nightly with the default of 24h. A report which fails, e.g. as a dump is
+// half-written, is retried at the next one. The daemon runs until interrupted.
+func daemonCmd(ctx context.Context, suite chartSuite) {
+	if *dir == "" {
+		fatal(exitUsage, "No metrics directory to report on, see --dir")
+	}
+	if *reportEveryFlag <= 0 || *keepFlag < 0 {
+		fatal(exitUsage, "Invalid report schedule", "every", *reportEveryFlag, "keep", *keepFlag)
+	}
+	if err := os.MkdirAll(*reportsFlag, 0755); err != nil {
+		fatal(exitFailure, "Failed to create reports directory", "err", err)
+	}
+	// The manifest is what lists the charts of a report
+	*manifestFlag = true
+	for {
+		now := time.Now().UTC()
+		if err := publishReport(ctx, suite, now); err != nil {
+			log.Error("Failed to publish report", "err", err)
+		}
+		if err := rotateReports(*reportsFlag, *keepFlag); err != nil {
+			log.Warn("Failed to delete old reports", "err", err)
+		}
+		next := now.Truncate(*reportEveryFlag).Add(*reportEveryFlag)
+		log.Info("Waiting for the next report", "at", next)
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			log.Info("Stopped reporting")
+			return
+		}
+	}
+}
+
+// publishReport renders the report of --dir as it is now, and copies the
+// charts, their sidecars, the manifest and the summary into a new report
+// directory. A report with failed charts is published all the same, with the
+// charts which did render.
+func publishReport(ctx context.Context, suite chartSuite, now time.Time) error {
+	stat, err := readStats(ctx, *dir)
+	if err != nil {
+		return fmt.Errorf("failed to load metrics: %v", err)
+	}
+	if len(stat.numbers()) == 0 {
+		return fmt.Errorf("no metrics loaded from %v", *dir)
+	}
+	meta, err := loadRunMeta(*dir, filepath.Base(*dir))
+	if err != nil {
+		return err
+	}
+	if *run != "" {
+		meta.Name = *run
+	}
+	if err := meta.normalize(&stat); err != nil {
+		return err
+	}
+	if err := addRuntimeMetrics(stat); err != nil {
+		return err
+	}
+	if err := addChainGasLimit(meta); err != nil {
+		return err
+	}
+	out := filepath.Join(*reportsFlag, now.Format(reportStamp))
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	summary, err := os.Create(filepath.Join(out, "summary.txt"))
+	if err != nil {
+		return err
+	}
+	defer summary.Close()
+
+	artifacts = make(map[string]manifestEntry)
+	fails := renderRun(ctx, summary, suite, stat, meta)
+	if err := writeManifest(); err != nil {
+		return err
+	}
+	files := []string{manifestPath}
+	for path, entry := range artifacts {
+		files = append(files, path)
+		if entry.Sidecar != nil {
+			files = append(files, filepath.Join(filepath.Dir(path), entry.Sidecar.File))
+		}
+	}
+	for _, path := range files {
+		if err := copyFile(path, filepath.Join(out, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	latest := filepath.Join(*reportsFlag, "latest")
+	os.Remove(latest)
+	if err := os.Symlink(filepath.Base(out), latest); err != nil {
+		log.Warn("Failed to link the latest report", "err", err)
+	}
+	log.Info("Published report", "dir", out, "charts", len(artifacts), "failed", len(fails))
+	for _, err := range fails {
+		log.Error("Failed", "err", err)
+	}
+	return nil
+}
+
+// rotateReports deletes all but the keep latest report directories. Entries
+// which aren't named like a report are left alone.
+func rotateReports(dir string, keep int) error {
+	if keep == 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var reports []string
+	for _, e := range entries {
+		if _, err := time.Parse(reportStamp, e.Name()); err == nil && e.IsDir() {
+			reports = append(reports, e.Name())
+		}
+	}
+	sort.Strings(reports)
+	for len(reports) > keep {
+		log.Info("Deleting old report", "report", reports[0])
+		if err := os.RemoveAll(filepath.Join(dir, reports[0])); err != nil {
+			return err
+		}
+		reports = reports[1:]
+	}
+	return nil
+}
+
+// copyFile copies the file at src to dst, replacing it.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
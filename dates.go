@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+var (
+	xAxisFlag      = flag.String("xaxis", "block", "X axis of block charts: block, date, both, or gas to plot against the cumulative gas of --gas-used")
+	timestampsFlag = flag.String("timestamps", "", "CSV file with a timestamp column of unix times by block (defaults to an estimate for mainnet)")
+)
+
+// mainnetTimes are the timestamps of the mainnet fork blocks, from which the
+// time of other blocks is estimated if no timestamps are given.
+var mainnetTimes = &sysSeries{
+	blocks: []float64{0, 1150000, 1920000, 2463000, 2675000, 4370000, 7280000},
+	values: []float64{1438269973, 1457981393, 1469020840, 1476796771, 1479831344, 1508131331, 1551383524},
+}
+
+// blockInterval is the average number of seconds between blocks, used outside
+// the range of known timestamps.
+const blockInterval = 13.3
+
+var (
+	dateAxis   bool       // Whether block axes are labelled with dates
+	dualAxis   bool       // Whether block axes get a secondary axis with dates
+	blockTimes *sysSeries // Timestamps of blocks, interpolated in between
+	estimated  bool       // Whether blockTimes is the mainnet estimate
+)
+
+// setXAxis configures the labels of block axes. Dates are derived from the
+// timestamps file if given, or estimated from the mainnet forks. A gas axis
+// needs the gas used by block, see setGasUsed.
+func setXAxis(kind, timestamps string) error {
+	switch kind {
+	case "block":
+	case "date":
+		dateAxis = true
+	case "both":
+		dualAxis = true
+	case "gas":
+		if cumulativeGas == nil {
+			return fmt.Errorf("X axis %q needs the gas used by block, see --gas-used", kind)
+		}
+		gasAxis = true
+	default:
+		return fmt.Errorf("unknown X axis %q", kind)
+	}
+	if timestamps == "" {
+		blockTimes, estimated = mainnetTimes, true
+		return nil
+	}
+	metrics, err := loadSysMetrics(timestamps)
+	if err != nil {
+		return err
+	}
+	s, ok := metrics["timestamp"]
+	if !ok || len(s.blocks) == 0 {
+		return fmt.Errorf("no timestamps in %v", timestamps)
+	}
+	blockTimes, estimated = s, false
+	return nil
+}
+
+// blockTime returns the time of the given block. Outside the known range, it
+// is extrapolated from the nearest known block.
+func blockTime(block float64) time.Time {
+	t, ok := blockTimes.at(block)
+	if !ok {
+		first, last := 0, len(blockTimes.blocks)-1
+		if block < blockTimes.blocks[first] {
+			t = blockTimes.values[first] - (blockTimes.blocks[first]-block)*blockInterval
+		} else {
+			t = blockTimes.values[last] + (block-blockTimes.blocks[last])*blockInterval
+		}
+	}
+	return time.Unix(int64(t), 0).UTC()
+}
+
+// blockAxis returns an X axis over block numbers with the given name, which is
+// labelled with the dates of the blocks if --xaxis is date. The values stay
+// block numbers, so the fork annotations and repricings still line up. With a
+// gas axis, the values are moved by toGasAxis.
+func blockAxis(name string) chart.XAxis {
+	axis := chart.XAxis{
+		Name:      name,
+		NameStyle: chart.StyleShow(),
+		Style:     chart.StyleShow(),
+	}
+	if gasAxis {
+		axis.Name = "Cumulative gas"
+		axis.ValueFormatter = formatGas
+	}
+	if dateAxis {
+		axis.Name = "Date"
+		if estimated {
+			axis.Name = "Date (estimated)"
+		}
+		axis.ValueFormatter = func(v interface{}) string {
+			if block, ok := v.(float64); ok {
+				return blockTime(block).Format("2006-01-02")
+			}
+			return fmt.Sprint(v)
+		}
+	}
+	return axis
+}
+
+// dateTicks is the number of dates on the secondary X axis.
+const dateTicks = 6
+
+// addDateAxis adds a secondary X axis with the approximate dates of the blocks
+// above the chart, if --xaxis is both. The block axis keeps its granularity,
+// and is pinned to the given range so that the dates line up with it.
+func addDateAxis(graph *chart.Chart, from, to float64) {
+	if !dualAxis || from >= to {
+		return
+	}
+	graph.XAxis.Range = &chart.ContinuousRange{Min: from, Max: to}
+	// Make room for the dates between the title and the canvas
+	if graph.Background.Padding.Top == 0 {
+		graph.Background.Padding.Top = 20
+	}
+	graph.Background.Padding.Top += 20
+
+	graph.Elements = append(graph.Elements, func(r chart.Renderer, canvas chart.Box, defaults chart.Style) {
+		style := chart.Style{Font: defaults.Font, FontColor: foreground, FontSize: 8}
+		for i := 0; i <= dateTicks; i++ {
+			var (
+				block = from + (to-from)*float64(i)/dateTicks
+				x     = canvas.Left + int(float64(canvas.Right-canvas.Left)*float64(i)/dateTicks)
+				label = blockTime(block).Format("2006-01-02")
+				box   = chart.Draw.MeasureText(r, label, style)
+			)
+			chart.Draw.Box(r, chart.Box{Left: x, Top: canvas.Top - 4, Right: x + 1, Bottom: canvas.Top}, chart.Style{FillColor: foreground})
+			chart.Draw.Text(r, label, x-(box.Right-box.Left)/2, canvas.Top-6, style)
+		}
+	})
+}
+
+// seriesRange returns the range of the X values of the continuous series.
+func seriesRange(series []chart.Series) (float64, float64) {
+	from, to := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		if cs, ok := s.(chart.ContinuousSeries); ok {
+			for _, x := range cs.XValues {
+				from, to = math.Min(from, x), math.Max(to, x)
+			}
+		}
+	}
+	return from, to
+}
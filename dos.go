@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+)
+
+var (
+	dosTimeFlag = flag.Float64("dos-time", 0, "Flag the intervals where one opcode took more than this percentage of the EVM time while charged less than --dos-gas (0 = off)")
+	dosGasFlag  = flag.Float64("dos-gas", 5, "Percentage of the gas below which an opcode taking more than --dos-time of the EVM time is flagged")
+)
+
+// shareInterval holds the share of every opcode in the EVM time and the gas
+// of one interval, in percent.
+type shareInterval struct {
+	from, to int
+	time     [256]float64
+	gas      [256]float64
+}
+
+// intervalShares computes the shares of the opcodes in every interval between
+// two snapshots. Intervals without time or gas are left out.
+func intervalShares(stat statCollection) []shareInterval {
+	var (
+		numbers   = stat.numbers()
+		intervals []shareInterval
+	)
+	for i := 1; i < len(numbers); i++ {
+		var (
+			points          = stat.delta(numbers[i-1], numbers[i])
+			totTime, totGas float64
+		)
+		for _, dp := range points {
+			totTime += float64(dp.execTime)
+			totGas += float64(dp.totalGas())
+		}
+		if totTime == 0 || totGas == 0 {
+			continue
+		}
+		si := shareInterval{from: numbers[i-1], to: numbers[i]}
+		for _, dp := range points {
+			si.time[dp.op] = 100 * float64(dp.execTime) / totTime
+			si.gas[dp.op] = 100 * float64(dp.totalGas()) / totGas
+		}
+		intervals = append(intervals, si)
+	}
+	return intervals
+}
+
+// exposure is an interval in which an opcode took a large share of the time
+// for a small share of the gas.
+type exposure struct {
+	from, to            int
+	timeShare, gasShare float64
+}
+
+// ratio is how much larger the share of the time is than that of the gas.
+func (e exposure) ratio() float64 {
+	if e.gasShare == 0 {
+		return math.Inf(1)
+	}
+	return e.timeShare / e.gasShare
+}
+
+// dosVector is an opcode which was flagged in at least one interval.
+type dosVector struct {
+	op        vm.OpCode
+	intervals []exposure
+	worst     exposure // The interval with the highest ratio
+}
+
+// dosVectors flags the intervals where an opcode took more than timePct of the
+// EVM time, while being charged less than gasPct of the gas. The opcodes are
+// ranked by their worst interval, the most underpriced first.
+func dosVectors(intervals []shareInterval, timePct, gasPct float64) []dosVector {
+	var (
+		byOp    = make(map[vm.OpCode]*dosVector)
+		vectors []dosVector
+	)
+	for _, si := range intervals {
+		for op := 0; op < 256; op++ {
+			if si.time[op] <= timePct || si.gas[op] >= gasPct {
+				continue
+			}
+			e := exposure{si.from, si.to, si.time[op], si.gas[op]}
+			v := byOp[vm.OpCode(op)]
+			if v == nil {
+				v = &dosVector{op: vm.OpCode(op), worst: e}
+				byOp[vm.OpCode(op)] = v
+			}
+			v.intervals = append(v.intervals, e)
+			if e.ratio() > v.worst.ratio() {
+				v.worst = e
+			}
+		}
+	}
+	for _, v := range byOp {
+		vectors = append(vectors, *v)
+	}
+	sort.Slice(vectors, func(i, j int) bool {
+		a, b := vectors[i].worst, vectors[j].worst
+		if a.ratio() != b.ratio() {
+			return a.ratio() > b.ratio()
+		}
+		return vectors[i].op < vectors[j].op
+	})
+	return vectors
+}
+
+// printDosVectors writes the ranked list of potential DoS vectors.
+func printDosVectors(w io.Writer, vectors []dosVector, timePct, gasPct float64) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nPotential DoS vectors: over %v%% of the EVM time for under %v%% of the gas\n", timePct, gasPct)
+	fmt.Fprintf(tw, "OPCODE\tINTERVALS\tWORST BLOCKS\tTIME%%\tGAS%%\tRATIO\t\n")
+	for _, v := range vectors {
+		fmt.Fprintf(tw, "%v\t%d\t%d-%d\t%.1f\t%.2f\t%.1f\t\n", opName(v.op), len(v.intervals),
+			v.worst.from, v.worst.to, v.worst.timeShare, v.worst.gasShare, v.worst.ratio())
+	}
+	tw.Flush()
+}
+
+// plotExposure renders the share of op in the EVM time and in the gas over
+// all intervals, with the thresholds as dashed lines. The thresholds are named,
+// so the sidecar doesn't take them for segments of the shares.
+func plotExposure(op vm.OpCode, intervals []shareInterval, timePct, gasPct float64, run runMeta, filename string) (string, error) {
+	var xvals, times, gases []float64
+	for _, si := range intervals {
+		xvals = append(xvals, float64(si.to))
+		times = append(times, si.time[op])
+		gases = append(gases, si.gas[op])
+	}
+	if len(xvals) == 0 {
+		return "", fmt.Errorf("%v: no intervals to plot", filename)
+	}
+	var (
+		from, to = xvals[0], xvals[len(xvals)-1]
+		dashed   = chart.Style{Show: true, StrokeColor: foreground, StrokeDashArray: []float64{5, 5}}
+		series   = []chart.Series{
+			chart.ContinuousSeries{Name: "% of EVM time", XValues: xvals, YValues: times},
+			chart.ContinuousSeries{Name: "% of gas", XValues: xvals, YValues: gases},
+			chart.ContinuousSeries{Name: "Time threshold", XValues: []float64{from, to}, YValues: []float64{timePct, timePct}, Style: dashed},
+			chart.ContinuousSeries{Name: "Gas threshold", XValues: []float64{from, to}, YValues: []float64{gasPct, gasPct}, Style: dashed},
+		}
+		title = fmt.Sprintf("Share of EVM time and gas (%v) - %v", opName(op), run.Name)
+	)
+	if stamp := run.stamp(); stamp != "" {
+		title += "\n" + stamp
+	}
+	width, height := layout.size(0, 0)
+	graph := chart.Chart{
+		Title:        title,
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		Background: chart.Style{
+			Padding: layout.padding(chart.Box{}),
+		},
+		XAxis: blockAxis("Blocknumber"),
+		YAxis: chart.YAxis{
+			Name:      "Percent",
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		},
+		Series: series,
+	}
+	addDateAxis(&graph, from, to)
+	toGasAxis(&graph)
+	return renderChart(&graph, layout, filename, map[string]interface{}{
+		"op": opName(op), "timePct": timePct, "gasPct": gasPct,
+	})
+}
+
+// dosAnalysis lists the potential DoS vectors of the run, and charts the
+// shares of the top ones.
+func dosAnalysis(ctx context.Context, w io.Writer, stat statCollection, run runMeta) error {
+	var (
+		intervals = intervalShares(stat)
+		vectors   = dosVectors(intervals, *dosTimeFlag, *dosGasFlag)
+	)
+	printDosVectors(w, vectors, *dosTimeFlag, *dosGasFlag)
+	if len(vectors) > *top {
+		vectors = vectors[:*top]
+	}
+	var fails failures
+	for _, v := range vectors {
+		if err := ctx.Err(); err != nil {
+			fails.add(err)
+			break
+		}
+		path, err := plotExposure(v.op, intervals, *dosTimeFlag, *dosGasFlag, run, fmt.Sprintf("dos-%v.png", opName(v.op)))
+		if err == nil {
+			fmt.Fprintln(w, path)
+		}
+		fails.add(err)
+	}
+	return fails.err()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+var barErasFlag = flag.Bool("bar-eras", false, "Bucket the bar charts by fork era (frontier, homestead, ...) instead of by a million blocks")
+
+// era is a range of blocks charted in one bar chart.
+type era struct {
+	name     string // Used in the file name
+	fork     string // Of the fork starting the era, if it is a fork era
+	from, to int
+}
+
+// millionEras returns n eras of a million blocks each, starting at genesis.
+func millionEras(n int) []era {
+	eras := make([]era, n)
+	for i := range eras {
+		eras[i] = era{name: fmt.Sprintf("total-bars-%d", i), from: i * 1000000, to: (i + 1) * 1000000}
+	}
+	return eras
+}
+
+// forkEras returns the eras between the mainnet forks, up to the last snapshot.
+// Since the fork blocks rarely have a snapshot of their own, the boundaries are
+// moved back to the nearest snapshot. Eras without any interval, e.g. the one
+// between Constantinople and Petersburg, are left out.
+func forkEras(stat statCollection) []era {
+	numbers := stat.numbers()
+	if len(numbers) == 0 {
+		return nil
+	}
+	last := numbers[len(numbers)-1]
+	var eras []era
+	for i, f := range forks {
+		// Unscheduled forks are at MaxUint64, which is beyond any block
+		if f.block >= uint64(last) {
+			break
+		}
+		end := last
+		if i+1 < len(forks) && forks[i+1].block < uint64(last) {
+			end = int(forks[i+1].block)
+		}
+		from, to := stat.snapshotAt(int(f.block)), stat.snapshotAt(end)
+		if to <= from {
+			continue
+		}
+		eras = append(eras, era{name: fmt.Sprintf("era-%d-%v", i, f.name), fork: f.name, from: from, to: to})
+	}
+	return eras
+}
+
+// snapshotAt returns the number of the last snapshot at or before the given
+// block, or zero if there is none, where the cumulative meters are all zero.
+func (stats *statCollection) snapshotAt(block int) int {
+	numbers := stats.numbers()
+	i := sort.SearchInts(numbers, block+1)
+	if i == 0 {
+		return 0
+	}
+	return numbers[i-1]
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// erigonDump is a dump of Erigon's execution-stage opcode statistics. Unlike
+// the other clients, the counters cover only the blocks of one stage batch,
+// and start over with the next one:
+//
+//	{"from": 4750001, "to": 4760000, "opcodes": {"ADD": {"count": 12, "duration": 3400}, ...}}
+//
+// The durations are in nanoseconds.
+type erigonDump struct {
+	From    int `json:"from"`
+	To      int `json:"to"`
+	Opcodes map[string]struct {
+		Count    uint64 `json:"count"`
+		Duration int64  `json:"duration"`
+	} `json:"opcodes"`
+}
+
+// parseErigon decodes an Erigon dump. The meters are those of the batch, the
+// block number that of its last block.
+func parseErigon(r io.Reader) ([256]opMeter, int, error) {
+	var (
+		m    [256]opMeter
+		dump erigonDump
+	)
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return m, 0, fmt.Errorf("invalid erigon metrics: %v", err)
+	}
+	if dump.To == 0 || dump.From > dump.To {
+		return m, 0, fmt.Errorf("invalid erigon metrics: block range %d-%d", dump.From, dump.To)
+	}
+	for name, meter := range dump.Opcodes {
+		if om := meterOp(&m, name); om != nil {
+			om.Num = meter.Count
+			om.Time = time.Duration(meter.Duration)
+		}
+	}
+	return m, dump.To, nil
+}
+
+// accumulate turns snapshots which hold the meters of their interval only into
+// cumulative ones, like those of geth. It must be called once all snapshots
+// are loaded.
+func (stats *statCollection) accumulate() {
+	totals := make(map[vm.OpCode]*dataPoint)
+	for _, number := range stats.index {
+		points := stats.data[number]
+		for op, dp := range points {
+			total := totals[op]
+			if total == nil {
+				total = &dataPoint{op: op}
+				totals[op] = total
+			}
+			total.add(dp)
+		}
+		// Opcodes which were not executed in this interval keep their totals
+		for op, total := range totals {
+			dp := &dataPoint{op: op, blockNumber: uint64(number)}
+			dp.add(total)
+			points[op] = dp
+		}
+	}
+}
+
+// merge adds the meters to the snapshot at the given block, for formats with
+// deltas. See accumulate.
+func (stats *statCollection) merge(blnum int, m [256]opMeter) {
+	points, exists := stats.data[blnum]
+	if !exists {
+		stats.collectMeters(blnum, m)
+		return
+	}
+	for i, meter := range m {
+		if meter.Num == 0 && meter.Time == 0 && meter.Gas == 0 {
+			continue
+		}
+		op := vm.OpCode(i)
+		dp := points[op]
+		if dp == nil {
+			dp = &dataPoint{op: op, blockNumber: uint64(blnum)}
+			points[op] = dp
+		}
+		dp.add(meterPoint(op, blnum, meter))
+	}
+}
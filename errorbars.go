@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+)
+
+var errorBarsFlag = flag.String("errorbars", "", "Error bars on the bar charts, over the intervals of every bar: stddev or minmax (default none)")
+
+// spread is the range of an error bar, in the units of the bar.
+type spread struct {
+	low, high float64
+}
+
+// checkErrorBars validates the kind of error bars.
+func checkErrorBars(kind string) error {
+	switch kind {
+	case "", "stddev", "minmax":
+		return nil
+	}
+	return fmt.Errorf("unknown error bars %q, expected stddev or minmax", kind)
+}
+
+// intervalSpread returns the spread of the ms/Mgas of op over the intervals
+// from start to end, around the value of the bar: one standard deviation of
+// the intervals to either side of it, or the lowest and highest interval. It
+// returns false if there are fewer than two intervals.
+func intervalSpread(stat statCollection, op vm.OpCode, start, end int, value float64, kind string) (spread, bool) {
+	xvals, yvals := stat.series(op, start, metrics["timepergas"])
+	var samples []float64
+	for i, x := range xvals {
+		if x <= float64(end) {
+			samples = append(samples, yvals[i])
+		}
+	}
+	if len(samples) < 2 {
+		return spread{}, false
+	}
+	if kind == "minmax" {
+		s := spread{math.Inf(1), math.Inf(-1)}
+		for _, v := range samples {
+			s.low, s.high = math.Min(s.low, v), math.Max(s.high, v)
+		}
+		return s, true
+	}
+	var mean, variance float64
+	for _, v := range samples {
+		mean += v
+	}
+	mean /= float64(len(samples))
+	for _, v := range samples {
+		variance += (v - mean) * (v - mean)
+	}
+	sd := math.Sqrt(variance / float64(len(samples)-1))
+	return spread{value - sd, value + sd}, true
+}
+
+// barCenters returns the horizontal centers of the n bars of g on the canvas,
+// laid out like BarChart does: every bar takes its width plus the spacing,
+// from the left of the canvas, with half the spacing before the bar. If they
+// don't fit, the bars share the canvas without any spacing.
+func barCenters(g chart.BarChart, n int, canvas chart.Box) []int {
+	if n == 0 {
+		return nil
+	}
+	width, spacing := g.GetBarWidth(), g.GetBarSpacing()
+	if n*(width+spacing) > canvas.Width() {
+		width, spacing = int(math.Ceil(float64(canvas.Width())/float64(n))), 0
+	}
+	centers := make([]int, n)
+	for i := range centers {
+		centers[i] = canvas.Left + i*(width+spacing) + spacing>>1 + width/2
+	}
+	return centers
+}
+
+// errorBars draws the spreads onto the bars of the bar chart g, whose Y axis
+// must be pinned to [0, top]. Bars without a spread have none drawn.
+func errorBars(g chart.BarChart, spreads []*spread, top float64) chart.Renderable {
+	return func(r chart.Renderer, canvas chart.Box, defaults chart.Style) {
+		if len(spreads) == 0 || top <= 0 {
+			return
+		}
+		var (
+			style   = chart.Style{FillColor: foreground}
+			centers = barCenters(g, len(spreads), canvas)
+			y       = func(v float64) int {
+				v = math.Max(0, math.Min(v, top))
+				return canvas.Bottom - int(v/top*float64(canvas.Bottom-canvas.Top))
+			}
+		)
+		for i, s := range spreads {
+			if s == nil {
+				continue
+			}
+			x := centers[i]
+			low, high := y(s.low), y(s.high)
+			chart.Draw.Box(r, chart.Box{Left: x, Top: high, Right: x + 1, Bottom: low}, style)
+			chart.Draw.Box(r, chart.Box{Left: x - 4, Top: high, Right: x + 5, Bottom: high + 1}, style)
+			chart.Draw.Box(r, chart.Box{Left: x - 4, Top: low, Right: x + 5, Bottom: low + 1}, style)
+		}
+	}
+}
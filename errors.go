@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Exit codes. The flag package exits with exitUsage on invalid flags.
+const (
+	exitFailure = 1 // Nothing could be done, e.g. the metrics could not be loaded
+	exitUsage   = 2 // Invalid flags or configuration
+	exitPartial = 3 // Some charts failed, the others were rendered
+
+	exitInterrupted = 130 // Stopped by SIGINT or SIGTERM, as with shells
+)
+
+// exitCode returns the code to exit with, after the given error.
+func exitCode(err error) int {
+	if err == context.Canceled {
+		return exitInterrupted
+	}
+	return exitFailure
+}
+
+// interruptible returns a context which is cancelled on SIGINT or SIGTERM, so
+// that the work in progress can be wound down cleanly. A second signal exits
+// right away.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigc:
+			log.Warn("Interrupted, stopping (interrupt again to exit immediately)")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		<-sigc
+		os.Exit(exitInterrupted)
+	}()
+	return ctx, cancel
+}
+
+// failures collects the errors of steps which can fail independently, such as
+// rendering one chart, so that one failure doesn't stop the others.
+type failures []error
+
+// add appends err, unless it is nil. Nested failures are flattened.
+func (f *failures) add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case failures:
+		*f = append(*f, err...)
+	default:
+		*f = append(*f, err)
+	}
+}
+
+func (f failures) Error() string {
+	msgs := make([]string, len(f))
+	for i, err := range f {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// err returns the failures as an error, or nil if there are none.
+func (f failures) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return f
+}
+
+// fatal logs the error and exits with the given code.
+func fatal(code int, msg string, ctx ...interface{}) {
+	log.Error(msg, ctx...)
+	os.Exit(code)
+}
+
+// finish logs a summary of everything that went wrong during the run, and
+// exits with exitPartial if any step failed, or exitInterrupted if the run was
+// interrupted.
+func (f failures) finish(stat statCollection) {
+	if len(f) == 0 && len(stat.skipped) == 0 {
+		return
+	}
+	log.Warn("Completed with errors", "failed", len(f), "skipped", len(stat.skipped))
+	for _, err := range f {
+		log.Error("Failed", "err", err)
+	}
+	for _, err := range f {
+		if err == context.Canceled {
+			os.Exit(exitInterrupted)
+		}
+	}
+	if len(f) > 0 {
+		os.Exit(exitPartial)
+	}
+}
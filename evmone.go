@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseEvmone decodes the output of evmone's histogram tracer, which writes a
+// histogram of the executed opcodes for every call:
+//
+//	--- # HISTOGRAM depth=0
+//	opcode,count
+//	PUSH1,4
+//	...
+//
+// Instrumented builds add the execution time in nanoseconds as a third column,
+// "opcode,count,time_ns". The histograms of all calls in the file are summed
+// up. The file has no block number, it is taken from the filename.
+func parseEvmone(r io.Reader) ([256]opMeter, int, error) {
+	var (
+		m          [256]opMeter
+		histograms int
+		columns    int // Columns of the current histogram, zero before its header
+	)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "--- # HISTOGRAM"):
+			histograms++
+			columns = 0
+			continue
+		case histograms == 0:
+			return m, 0, fmt.Errorf("invalid evmone histogram: line %d: expected a histogram", line)
+		case columns == 0:
+			switch text {
+			case "opcode,count":
+				columns = 2
+			case "opcode,count,time_ns":
+				columns = 3
+			default:
+				return m, 0, fmt.Errorf("invalid evmone histogram: line %d: unexpected header %q", line, text)
+			}
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != columns {
+			return m, 0, fmt.Errorf("invalid evmone histogram: line %d: expected %d fields, got %d", line, columns, len(fields))
+		}
+		count, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return m, 0, fmt.Errorf("invalid evmone histogram: line %d: %v", line, err)
+		}
+		var ns int64
+		if columns == 3 {
+			if ns, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+				return m, 0, fmt.Errorf("invalid evmone histogram: line %d: %v", line, err)
+			}
+		}
+		if om := meterOp(&m, fields[0]); om != nil {
+			om.Num += count
+			om.Time += time.Duration(ns)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, 0, fmt.Errorf("invalid evmone histogram: %v", err)
+	}
+	if histograms == 0 {
+		return m, 0, fmt.Errorf("empty evmone histogram")
+	}
+	return m, 0, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metricVars are the variables available in metric expressions, evaluated for
+// the data point of one opcode over one interval.
+var metricVars = map[string]func(dp *dataPoint) float64{
+	"time":     func(dp *dataPoint) float64 { return float64(dp.execTime) }, // Nanoseconds
+	"count":    func(dp *dataPoint) float64 { return float64(dp.count) },
+	"gas":      func(dp *dataPoint) float64 { return float64(dp.gas()) }, // Per execution
+	"totalgas": func(dp *dataPoint) float64 { return float64(dp.totalGas()) },
+	"refund":   func(dp *dataPoint) float64 { return float64(dp.refund) },
+	"block":    func(dp *dataPoint) float64 { return float64(dp.blockNumber) },
+	"blocks":   func(dp *dataPoint) float64 { return float64(dp.blocks()) }, // Length of the interval
+	"blockgas": intervalGas,                                                 // Gas used by the blocks of the interval
+}
+
+// metricVarNames returns the names of the metricVars, sorted.
+func metricVarNames() []string {
+	var names []string
+	for name := range metricVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseMetric compiles an arithmetic expression over the metricVars, such as
+// "time/count" or "time*1e3/(count*gas)", into a y-function. Division by zero
+// yields zero, like for the built-in metrics.
+func parseMetric(expr string) (func(dp *dataPoint) float64, error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric expression %q: %v", expr, err)
+	}
+	fn, err := compileMetric(e)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric expression %q: %v", expr, err)
+	}
+	return fn, nil
+}
+
+func compileMetric(e ast.Expr) (func(dp *dataPoint) float64, error) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return nil, fmt.Errorf("unsupported literal %v", e.Value)
+		}
+		v, err := strconv.ParseFloat(e.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(*dataPoint) float64 { return v }, nil
+	case *ast.Ident:
+		if fn, ok := metricVars[e.Name]; ok {
+			return fn, nil
+		}
+		return nil, fmt.Errorf("unknown variable %q (available: %s)", e.Name, strings.Join(metricVarNames(), ", "))
+	case *ast.ParenExpr:
+		return compileMetric(e.X)
+	case *ast.UnaryExpr:
+		x, err := compileMetric(e.X)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x, nil
+		case token.SUB:
+			return func(dp *dataPoint) float64 { return -x(dp) }, nil
+		}
+		return nil, fmt.Errorf("unsupported operator %v", e.Op)
+	case *ast.BinaryExpr:
+		x, err := compileMetric(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := compileMetric(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return func(dp *dataPoint) float64 { return x(dp) + y(dp) }, nil
+		case token.SUB:
+			return func(dp *dataPoint) float64 { return x(dp) - y(dp) }, nil
+		case token.MUL:
+			return func(dp *dataPoint) float64 { return x(dp) * y(dp) }, nil
+		case token.QUO:
+			return func(dp *dataPoint) float64 {
+				if d := y(dp); d != 0 {
+					return x(dp) / d
+				}
+				return 0
+			}, nil
+		}
+		return nil, fmt.Errorf("unsupported operator %v", e.Op)
+	}
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+// lookupMetric returns the y-function of a named metric, or compiles the name
+// as an expression if there is no such metric.
+func lookupMetric(name string) (func(dp *dataPoint) float64, error) {
+	if fn, ok := metrics[name]; ok {
+		return fn, nil
+	}
+	return parseMetric(name)
+}
+
+// metricLabel returns the Y axis label of a metric. Expressions are their own
+// label.
+func metricLabel(name string) string {
+	if label, ok := metricLabels[name]; ok {
+		return label
+	}
+	return name
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMetric(t *testing.T) {
+	dp := &dataPoint{blockNumber: 1000, span: 100, count: 4, execTime: 200, gasUsed: 12, refund: 3}
+	tests := []struct {
+		expr string
+		want float64
+		err  string
+	}{
+		{expr: "time", want: 200},
+		{expr: "time/count", want: 50},
+		{expr: "time*1e3/(count*gas)", want: 200 * 1e3 / (4 * 3)},
+		{expr: "-count+10", want: 6},
+		{expr: "refund", want: 3},
+		{expr: "blocks", want: 100},
+		{expr: "time/0", want: 0},
+		{expr: "time/(count-4)", want: 0},
+		{expr: "nanos", err: `unknown variable "nanos" (available: block, blockgas, blocks, count, gas, refund, time, totalgas)`},
+		{expr: "time%count", err: "unsupported operator %"},
+		{expr: `"time"`, err: "unsupported literal"},
+		{expr: "time(", err: "invalid metric expression"},
+		{expr: "count.time", err: "unsupported expression"},
+	}
+	for _, tt := range tests {
+		fn, err := parseMetric(tt.expr)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.expr, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := fn(dp); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
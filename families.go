@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// opFamily is a range of opcode values which belong together, following the
+// layout of the instruction set.
+type opFamily struct {
+	name     string
+	from, to vm.OpCode // Inclusive
+}
+
+var families = []opFamily{
+	{"arithmetic", 0x00, 0x0f},
+	{"comparison", 0x10, 0x1a}, // Including the bitwise ops up to BYTE
+	{"shift", 0x1b, 0x1f},
+	{"crypto", 0x20, 0x2f},
+	{"context", 0x30, 0x3f},
+	{"block", 0x40, 0x4f},
+	{"storage", 0x50, 0x5f}, // Storage, memory and flow
+	{"stack", 0x60, 0x9f},   // Push, dup and swap
+	{"logging", 0xa0, 0xaf},
+	{"system", 0xf0, 0xff},
+}
+
+// familyOps maps the family names to the opcodes which are defined in each
+// family, so opcodes added to go-ethereum end up in the right family without
+// any changes here.
+var familyOps = make(map[string][]vm.OpCode)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		op := vm.OpCode(i)
+		if !definedOp(op) {
+			continue
+		}
+		if name := familyOf(op); name != "" {
+			familyOps[name] = append(familyOps[name], op)
+		}
+	}
+}
+
+// definedOp reports whether op is known to go-ethereum.
+func definedOp(op vm.OpCode) bool {
+	return vm.StringToOp(op.String()) == op
+}
+
+// familyOf returns the name of the family of op, or an empty string if the
+// opcode is in a range without a family. STOP halts execution, so it is
+// grouped with the other halting opcodes instead of the arithmetic.
+func familyOf(op vm.OpCode) string {
+	if op == vm.STOP {
+		return "system"
+	}
+	for _, f := range families {
+		if op >= f.from && op <= f.to {
+			return f.name
+		}
+	}
+	return ""
+}
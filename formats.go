@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var formatFlag = flag.String("format", "geth", "Format of the metrics files: geth, registry, nethermind, besu, erigon, evmone, reth, goevmlab or structlog")
+
+// inputFormat is a format of metrics files, as written by the instrumentation
+// of a client.
+type inputFormat struct {
+	pattern string // Default filename pattern, see --pattern
+	parse   func(r io.Reader) ([256]opMeter, int, error)
+	// parseDump also decodes what else the files hold, the runtime metrics of
+	// the node, and with withTxs, the meters of the transactions. It is nil if
+	// the files of the format hold nothing else.
+	parseDump func(r io.Reader, withTxs bool) ([256]opMeter, int, dumpExtras, error)
+	txs       bool // The files may hold the meters of transactions
+	deltas    bool // The meters cover the interval since the previous file, rather than all blocks
+}
+
+// inputFormats are the supported formats, by name.
+var inputFormats = map[string]*inputFormat{
+	"geth":       {pattern: `^metrics_to_(\d+)(?:_(?P<hash>(?:0x)?[0-9a-fA-F]+))?`, parse: parseMeters, parseDump: parseSnapshot, txs: true},
+	"registry":   {pattern: `^registry_(\d+)\.json`, parse: parseRegistry, parseDump: parseRegistryDump},
+	"nethermind": {pattern: `^opcodes_(\d+)\.json`, parse: parseNethermind},
+	"besu":       {pattern: `^besu-opcodes-(\d+)\.csv`, parse: parseBesu},
+	"erigon":     {pattern: `^opstats_\d+-(?P<block>\d+)\.json`, parse: parseErigon, deltas: true},
+	"evmone":     {pattern: `^histogram_(\d+)\.csv`, parse: parseEvmone, deltas: true},
+	"reth":       {pattern: `^revm_stats_(\d+)\.json`, parse: parseReth},
+	"goevmlab":   {pattern: `^(\d+)[^.]*\.jsonl?$`, parse: parseTrace, deltas: true},
+	"structlog":  {pattern: `^(\d+)-[^.]*\.json`, parse: parseStructLogs, deltas: true},
+}
+
+// format is the format of the metrics files being loaded.
+var format = inputFormats["geth"]
+
+// setFormat selects the format of the metrics files.
+func setFormat(name string) error {
+	f, ok := inputFormats[name]
+	if !ok {
+		var names []string
+		for name := range inputFormats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown format %q (available: %v)", name, strings.Join(names, ", "))
+	}
+	format = f
+	return nil
+}
+
+// patternExpr returns the filename pattern: the one given with --pattern, or
+// the default of the format.
+func patternExpr() string {
+	expr := format.pattern
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "pattern" {
+			expr = *patternFlag
+		}
+	})
+	return expr
+}
+
+// meterOp returns a named opcode to its meter. Opcodes which are unknown to
+// go-ethereum, e.g. those of later forks, are ignored, since there is no gas
+// cost to chart them with anyway.
+func meterOp(m *[256]opMeter, name string) *opMeter {
+	op, ok := lookupOp(strings.ToUpper(name))
+	if !ok {
+		return nil
+	}
+	return &m[op]
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestParseClients(t *testing.T) {
+	type parser func(r io.Reader) ([256]opMeter, int, error)
+	tests := []struct {
+		name  string
+		parse parser
+		input string
+		want  map[vm.OpCode]opMeter
+		block int
+		err   string
+	}{
+		{
+			name:  "nethermind",
+			parse: parseNethermind,
+			input: `{"BlockNumber": 100, "Opcodes": {"ADD": {"Count": 3, "Ticks": 5}, "NOSUCHOP": {"Count": 1, "Ticks": 1}}}`,
+			want:  map[vm.OpCode]opMeter{vm.ADD: {Num: 3, Time: 500 * time.Nanosecond}},
+			block: 100,
+		},
+		{name: "nethermind no opcodes", parse: parseNethermind, input: `{"BlockNumber": 100}`, err: "no opcodes"},
+		{name: "nethermind invalid", parse: parseNethermind, input: `[]`, err: "invalid nethermind metrics"},
+		{
+			name:  "besu",
+			parse: parseBesu,
+			input: "opcode,count,time_ns\nADD,3,500\nSLOAD,2,900\n",
+			want:  map[vm.OpCode]opMeter{vm.ADD: {Num: 3, Time: 500}, vm.SLOAD: {Num: 2, Time: 900}},
+		},
+		{name: "besu empty", parse: parseBesu, input: "", err: "empty besu metrics"},
+		{name: "besu header", parse: parseBesu, input: "op,count,time\nADD,3,500\n", err: "unexpected header"},
+		{name: "besu count", parse: parseBesu, input: "opcode,count,time_ns\nADD,x,500\n", err: "count of ADD"},
+		{name: "besu fields", parse: parseBesu, input: "opcode,count,time_ns\nADD,3\n", err: "invalid besu metrics"},
+		{
+			name:  "erigon",
+			parse: parseErigon,
+			input: `{"from": 1, "to": 100, "opcodes": {"add": {"count": 3, "duration": 500}}}`,
+			want:  map[vm.OpCode]opMeter{vm.ADD: {Num: 3, Time: 500}},
+			block: 100,
+		},
+		{name: "erigon range", parse: parseErigon, input: `{"from": 200, "to": 100, "opcodes": {}}`, err: "block range 200-100"},
+		{
+			name:  "reth",
+			parse: parseReth,
+			input: `{"block": 100, "opcodes": [{"opcode": 1, "name": "ADD", "count": 3, "time_ns": 500}, {"opcode": 12, "name": "?", "count": 1, "time_ns": 1}]}`,
+			want:  map[vm.OpCode]opMeter{vm.ADD: {Num: 3, Time: 500}},
+			block: 100,
+		},
+		{name: "reth range", parse: parseReth, input: `{"block": 100, "opcodes": [{"opcode": 256}]}`, err: "opcode 256 out of range"},
+		{
+			name:  "evmone",
+			parse: parseEvmone,
+			input: "--- # HISTOGRAM depth=0\nopcode,count\nPUSH1,4\nADD,1\n\n--- # HISTOGRAM depth=1\nopcode,count,time_ns\nADD,2,300\n",
+			want:  map[vm.OpCode]opMeter{vm.PUSH1: {Num: 4}, vm.ADD: {Num: 3, Time: 300}},
+		},
+		{name: "evmone empty", parse: parseEvmone, input: "", err: "empty evmone histogram"},
+		{name: "evmone header", parse: parseEvmone, input: "--- # HISTOGRAM depth=0\nop,n\n", err: "line 2: unexpected header"},
+		{name: "evmone fields", parse: parseEvmone, input: "--- # HISTOGRAM depth=0\nopcode,count\nADD,1,2\n", err: "line 3: expected 2 fields, got 3"},
+		{
+			name:  "goevmlab",
+			parse: parseTrace,
+			input: `{"pc":0,"op":96,"gas":"0x2540be400","gasCost":"0x3","opName":"PUSH1"}` + "\n" +
+				`{"pc":2,"op":96,"opName":"PUSH1"}` + "\n" + `{"pc":4,"op":1,"opName":"ADD"}` + "\n" +
+				`{"output":"","gasUsed":"0x9","time":350}` + "\n",
+			want: map[vm.OpCode]opMeter{vm.PUSH1: {Num: 2}, vm.ADD: {Num: 1}},
+		},
+		{name: "goevmlab no steps", parse: parseTrace, input: `{"output":"","gasUsed":"0x0"}`, err: "no steps"},
+		{name: "goevmlab range", parse: parseTrace, input: `{"pc":0,"op":300}`, err: "line 1: opcode 300 out of range"},
+		{name: "goevmlab invalid", parse: parseTrace, input: `{"pc":0,"op":1}` + "\n" + `{"pc":`, err: "line 2"},
+		{
+			name:  "structlog",
+			parse: parseStructLogs,
+			input: `{"gas": 1003, "failed": false, "returnValue": "", "structLogs": [{"pc": 0, "op": "PUSH1", "gasCost": 3, "stack": []}, {"op": "SLOAD", "gasCost": 200}, {"op": "SLOAD", "gasCost": 800}]}`,
+			want:  map[vm.OpCode]opMeter{vm.PUSH1: {Num: 1, Gas: 3}, vm.SLOAD: {Num: 2, Gas: 1000}},
+		},
+		{
+			name:  "structlog rpc",
+			parse: parseStructLogs,
+			input: `{"jsonrpc": "2.0", "id": 1, "result": {"gas": 3, "structLogs": [{"op": "ADD", "gasCost": 3}]}}`,
+			want:  map[vm.OpCode]opMeter{vm.ADD: {Num: 1, Gas: 3}},
+		},
+		{name: "structlog none", parse: parseStructLogs, input: `{"gas": 3}`, err: "no structLogs"},
+		{name: "structlog array", parse: parseStructLogs, input: `[]`, err: "expected an object"},
+	}
+	for _, tt := range tests {
+		m, block, err := tt.parse(strings.NewReader(tt.input))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if block != tt.block {
+			t.Errorf("%s: block %d, want %d", tt.name, block, tt.block)
+		}
+		for op := range m {
+			if want := tt.want[vm.OpCode(op)]; m[op].Num != want.Num || m[op].Time != want.Time || m[op].Gas != want.Gas {
+				t.Errorf("%s: %v meter %+v, want %+v", tt.name, vm.OpCode(op), m[op], want)
+			}
+		}
+	}
+}
+
+// TestAccumulate checks that the deltas of erigon batches are added up into
+// cumulative snapshots, also for opcodes missing from a batch.
+func TestAccumulate(t *testing.T) {
+	stat := newStatCollection()
+	for i, count := range []uint64{3, 0, 5} {
+		var m [256]opMeter
+		m[vm.ADD] = opMeter{Num: count, Time: time.Duration(count * 100)}
+		m[vm.SLOAD] = opMeter{Num: 1}
+		stat.merge(100*(i+1), m)
+	}
+	var extra [256]opMeter
+	extra[vm.ADD] = opMeter{Num: 1, Time: 10}
+	stat.merge(300, extra)
+	stat.accumulate()
+	for _, tt := range []struct {
+		block      int
+		add, sload uint64
+		addTime    time.Duration
+	}{
+		{100, 3, 1, 300}, {200, 3, 2, 300}, {300, 9, 3, 810},
+	} {
+		add, sload := stat.data[tt.block][vm.ADD], stat.data[tt.block][vm.SLOAD]
+		if add.count != tt.add || add.execTime != tt.addTime || sload.count != tt.sload {
+			t.Errorf("block %d: ADD %d in %v, SLOAD %d, want ADD %d in %v, SLOAD %d",
+				tt.block, add.count, add.execTime, sload.count, tt.add, tt.addTime, tt.sload)
+		}
+	}
+}
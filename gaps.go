@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var maxIntervalFlag = flag.Int("max-interval", 0, "Treat snapshot intervals longer than this many blocks as gaps (0 = twice the usual interval)")
+
+// gap is a range of blocks between two consecutive snapshots, for which the
+// data is missing.
+type gap struct {
+	from, to int
+}
+
+// interval returns the most common number of blocks between two snapshots.
+func (stats *statCollection) interval() int {
+	var (
+		numbers = stats.numbers()
+		counts  = make(map[int]int)
+		best    int
+	)
+	for i := 1; i < len(numbers); i++ {
+		d := numbers[i] - numbers[i-1]
+		counts[d]++
+		if counts[d] > counts[best] || (counts[d] == counts[best] && d < best) {
+			best = d
+		}
+	}
+	return best
+}
+
+// gaps returns the intervals which are longer than maxInterval blocks, or twice
+// the usual interval if maxInterval is zero. Intervals spanning a counter reset
+// are also gaps, since they are left out of the series.
+func (stats *statCollection) gaps(maxInterval int) []gap {
+	if maxInterval == 0 {
+		maxInterval = 2 * stats.interval()
+	}
+	var (
+		gaps    []gap
+		numbers = stats.numbers()
+	)
+	for i := 1; i < len(numbers); i++ {
+		if numbers[i]-numbers[i-1] > maxInterval || stats.resets[numbers[i]] {
+			gaps = append(gaps, gap{numbers[i-1], numbers[i]})
+		}
+	}
+	return gaps
+}
+
+// seriesColor returns the color that go-chart assigns to the series at the given index.
+func seriesColor(index int) drawing.Color {
+	if colors != nil {
+		return colors.GetSeriesColor(index)
+	}
+	return chart.GetDefaultColor(index)
+}
+
+// splitGaps breaks up the continuous series wherever they span a gap, so no
+// line is drawn across it. The segments after the first have no name, and are
+// left out of the legend. Since the split shifts the series indices, all
+// series are given the color they would have had without the split.
+func splitGaps(series []chart.Series, gaps []gap) []chart.Series {
+	if len(gaps) == 0 {
+		return series
+	}
+	// spans returns true if a gap lies between the two blocks
+	spans := func(a, b float64) bool {
+		i := sort.Search(len(gaps), func(i int) bool {
+			return float64(gaps[i].from) >= a
+		})
+		return i < len(gaps) && float64(gaps[i].to) <= b
+	}
+	var result []chart.Series
+	for i, s := range series {
+		cs, ok := s.(chart.ContinuousSeries)
+		if !ok {
+			result = append(result, s)
+			continue
+		}
+		if cs.Style.StrokeColor.IsZero() {
+			cs.Style = chart.Style{Show: true, StrokeColor: seriesColor(i)}
+		}
+		start := 0
+		for j := 1; j <= len(cs.XValues); j++ {
+			if j < len(cs.XValues) && !spans(cs.XValues[j-1], cs.XValues[j]) {
+				continue
+			}
+			segment := cs
+			segment.XValues = cs.XValues[start:j]
+			segment.YValues = cs.YValues[start:j]
+			if start > 0 {
+				segment.Name = ""
+			}
+			result = append(result, segment)
+			start = j
+		}
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+)
+
+func TestGaps(t *testing.T) {
+	stat := newStatCollection()
+	for _, number := range []int{100, 200, 300, 600, 700, 800} {
+		var m [256]opMeter
+		m[vm.ADD] = opMeter{Num: uint64(number)}
+		stat.collectMeters(number, m)
+	}
+	stat.resets = map[int]bool{700: true}
+	if got := stat.interval(); got != 100 {
+		t.Errorf("interval %d, want 100", got)
+	}
+	tests := []struct {
+		maxInterval int
+		want        []gap
+	}{
+		{0, []gap{{300, 600}, {600, 700}}},
+		{300, []gap{{600, 700}}},
+	}
+	for _, tt := range tests {
+		if got := stat.gaps(tt.maxInterval); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("max interval %d: gaps %v, want %v", tt.maxInterval, got, tt.want)
+		}
+	}
+}
+
+func TestSplitGaps(t *testing.T) {
+	gaps := []gap{{300, 600}, {600, 700}}
+	series := []chart.Series{
+		chart.ContinuousSeries{
+			Name:    "ADD",
+			XValues: []float64{100, 200, 300, 600, 700, 800},
+			YValues: []float64{1, 2, 3, 6, 7, 8},
+		},
+		chart.ContinuousSeries{Name: "SLOAD", XValues: []float64{100, 200}, YValues: []float64{1, 2}},
+	}
+	got := splitGaps(series, gaps)
+	want := []struct {
+		name string
+		xs   []float64
+	}{
+		{"ADD", []float64{100, 200, 300}},
+		{"", []float64{600}},
+		{"", []float64{700, 800}},
+		{"SLOAD", []float64{100, 200}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d series, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		cs := got[i].(chart.ContinuousSeries)
+		if cs.Name != w.name || !reflect.DeepEqual(cs.XValues, w.xs) || len(cs.YValues) != len(w.xs) {
+			t.Errorf("series %d: %q %v, want %q %v", i, cs.Name, cs.XValues, w.name, w.xs)
+		}
+	}
+	// The segments keep the color of the series they were split from
+	for i, index := range []int{0, 0, 0, 1} {
+		if c := got[i].(chart.ContinuousSeries).Style.StrokeColor; c != seriesColor(index) {
+			t.Errorf("series %d: color %v, want that of series %d", i, c, index)
+		}
+	}
+	if got := splitGaps(series, nil); !reflect.DeepEqual(got, series) {
+		t.Error("series without gaps were changed")
+	}
+}
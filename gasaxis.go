@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+var gasUsedFlag = flag.String("gas-used", "", "CSV file with a gasUsed (and optionally gasLimit) column by block, as written by vmstats gasused")
+
+var (
+	gasAxis       bool       // Whether block axes are replaced by the cumulative gas
+	blockGasUsed  *sysSeries // Gas used by blocks, as loaded
+	blockGasLimit *sysSeries // Gas limit of blocks, if loaded
+	cumulativeGas *sysSeries // Gas used up to and including blocks, interpolated in between
+)
+
+// setGasUsed loads the gas used by block from a CSV file like those of
+// --sysmetrics, with a gasUsed column and optionally a gasLimit one:
+//
+//	block,gasUsed,gasLimit
+//	4000000,6712340,6718946
+//	...
+//
+// The gas of a row stands for every block since the previous row, so sampled
+// data gives an estimate of the cumulative gas, and data of every block the
+// exact one.
+func setGasUsed(path string) error {
+	metrics, err := loadSysMetrics(path)
+	if err != nil {
+		return err
+	}
+	s, ok := metrics["gasUsed"]
+	if !ok || len(s.blocks) == 0 {
+		return fmt.Errorf("no gasUsed in %v", path)
+	}
+	setBlockGas(s)
+	if limit, ok := metrics["gasLimit"]; ok && len(limit.blocks) > 0 {
+		blockGasLimit = limit
+	}
+	return nil
+}
+
+// setBlockGas sets the gas used by block, and accumulates it.
+func setBlockGas(s *sysSeries) {
+	cum := &sysSeries{blocks: s.blocks, values: make([]float64, len(s.values))}
+	total, prev := 0.0, s.blocks[0]-1
+	for i, block := range s.blocks {
+		total += s.values[i] * (block - prev)
+		cum.values[i], prev = total, block
+	}
+	blockGasUsed, cumulativeGas = s, cum
+}
+
+// blockGas returns the gas used up to and including the given block. Outside
+// the known range, it is extrapolated with the gas of the nearest known block.
+func blockGas(block float64) float64 {
+	if v, ok := cumulativeGas.at(block); ok {
+		return v
+	}
+	first, last := 0, len(cumulativeGas.blocks)-1
+	if block < cumulativeGas.blocks[first] {
+		v := cumulativeGas.values[first] - (cumulativeGas.blocks[first]-block)*blockGasUsed.values[first]
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	return cumulativeGas.values[last] + (block-cumulativeGas.blocks[last])*blockGasUsed.values[last]
+}
+
+// formatGas renders an amount of gas on the X axis.
+func formatGas(v interface{}) string {
+	gas, ok := v.(float64)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	switch {
+	case gas >= 1e12:
+		return fmt.Sprintf("%.1f Tgas", gas/1e12)
+	case gas >= 1e9:
+		return fmt.Sprintf("%.0f Ggas", gas/1e9)
+	}
+	return fmt.Sprintf("%.0f Mgas", gas/1e6)
+}
+
+// toGasAxis moves the series of a block chart onto the cumulative gas, if
+// --xaxis is gas. It must be called once all series are added, as they are
+// built over block numbers, like the gaps and the annotations.
+func toGasAxis(graph *chart.Chart) {
+	if !gasAxis {
+		return
+	}
+	mapped := func(blocks []float64) []float64 {
+		xs := make([]float64, len(blocks))
+		for i, block := range blocks {
+			xs[i] = blockGas(block)
+		}
+		return xs
+	}
+	inner := func(vp chart.ValuesProvider) chart.ValuesProvider {
+		if cs, ok := vp.(chart.ContinuousSeries); ok {
+			cs.XValues = mapped(cs.XValues)
+			return cs
+		}
+		return vp
+	}
+	for i, s := range graph.Series {
+		switch s := s.(type) {
+		case chart.ContinuousSeries:
+			s.XValues = mapped(s.XValues)
+			graph.Series[i] = s
+		case chart.SMASeries:
+			s.InnerSeries = inner(s.InnerSeries)
+			graph.Series[i] = s
+		case *chart.EMASeries:
+			s.InnerSeries = inner(s.InnerSeries)
+		case *chart.BollingerBandsSeries:
+			s.InnerSeries = inner(s.InnerSeries)
+		case chart.AnnotationSeries:
+			annotations := make([]chart.Value2, len(s.Annotations))
+			for j, a := range s.Annotations {
+				a.XValue = blockGas(a.XValue)
+				annotations[j] = a
+			}
+			s.Annotations = annotations
+			graph.Series[i] = s
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// gasChange is a block at which the gas cost of an opcode changed.
+type gasChange struct {
+	block    uint64
+	old, gas uint64
+}
+
+// gasChanges returns the changes of the gas cost of op at the mainnet forks,
+// starting with the cost at genesis.
+func gasChanges(op vm.OpCode) []gasChange {
+	changes := []gasChange{{block: 0, gas: gasCost(op, 0)}}
+	for _, f := range forks {
+		prev := changes[len(changes)-1].gas
+		if gas := gasCost(op, f.block); gas != prev {
+			changes = append(changes, gasChange{block: f.block, old: prev, gas: gas})
+		}
+	}
+	return changes
+}
+
+// gasSteps returns the gas cost of op as a step function over the given block
+// range.
+func gasSteps(op vm.OpCode, from, to int) ([]float64, []float64) {
+	var (
+		gas   = gasCost(op, uint64(from))
+		xvals = []float64{float64(from)}
+		yvals = []float64{float64(gas)}
+	)
+	for _, c := range gasChanges(op) {
+		if c.block <= uint64(from) || c.block > uint64(to) {
+			continue
+		}
+		xvals = append(xvals, float64(c.block), float64(c.block))
+		yvals = append(yvals, float64(c.old), float64(c.gas))
+		gas = c.gas
+	}
+	xvals = append(xvals, float64(to))
+	yvals = append(yvals, float64(gas))
+	return xvals, yvals
+}
+
+// gasStepSeries returns the step series of the gas cost of every op, over the
+// blocks in stat from fromBlock on.
+func gasStepSeries(ops []vm.OpCode, stat statCollection, fromBlock int, yAxis chart.YAxisType) ([]chart.Series, error) {
+	numbers := stat.numbers()
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no data to plot")
+	}
+	from, to := numbers[0], numbers[len(numbers)-1]
+	if fromBlock > from {
+		from = fromBlock
+	}
+	var series []chart.Series
+	for _, op := range ops {
+		xvals, yvals := gasSteps(op, from, to)
+		s := chart.ContinuousSeries{
+			Name:    fmt.Sprintf("Gas %v", opName(op)),
+			XValues: xvals,
+			YValues: yvals,
+			YAxis:   yAxis,
+		}
+		if yAxis == chart.YAxisSecondary {
+			s.Style = chart.Style{Show: true, StrokeColor: drawing.ColorRed}
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// repricings returns a vertical marker for every change of the gas cost of the
+// ops within the block range, spanning the Y range, and an annotation with the
+// old and new cost at the top of each marker. Opcodes which were introduced by
+// a fork were not repriced, so the introduction is not marked.
+func repricings(ops []vm.OpCode, from, to int, yMin, yMax float64) ([]chart.Series, []chart.Value2) {
+	var (
+		markers []chart.Series
+		labels  []chart.Value2
+		style   = chart.Style{Show: true, StrokeColor: foreground, StrokeDashArray: []float64{5, 5}}
+	)
+	for _, op := range ops {
+		for _, c := range gasChanges(op)[1:] {
+			if c.old == 0 || c.block < uint64(from) || c.block > uint64(to) {
+				continue
+			}
+			x := float64(c.block)
+			markers = append(markers, chart.ContinuousSeries{
+				Style:   style,
+				XValues: []float64{x, x},
+				YValues: []float64{yMin, yMax},
+			})
+			labels = append(labels, chart.Value2{
+				XValue: x,
+				YValue: yMax,
+				Label:  fmt.Sprintf("%v %d -> %d", opName(op), c.old, c.gas),
+			})
+		}
+	}
+	return markers, labels
+}
+
+// plotGasCost renders the scheduled gas cost of the ops over the blocks in stat.
+func plotGasCost(ops []vm.OpCode, stat statCollection, title, filename string, opts plotOpts) (string, error) {
+	series, err := gasStepSeries(ops, stat, opts.fromBlock, chart.YAxisPrimary)
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", filename, err)
+	}
+	width, height := opts.layout.size(0, 0)
+	graph := chart.Chart{
+		Title:        title,
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          opts.layout.DPI,
+		ColorPalette: colors,
+		Background: chart.Style{
+			Padding: opts.layout.padding(chart.Box{}),
+		},
+		XAxis: blockAxis("Blocknumber"),
+		YAxis: chart.YAxis{
+			Name:      "Gas",
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		},
+		Series: series,
+	}
+	from, to := seriesRange(series)
+	addDateAxis(&graph, from, to)
+	toGasAxis(&graph)
+	return renderChart(&graph, opts.layout, filename, opts.params)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// forks are the mainnet forks accepted by the gastable subcommand, in order.
+var forks = []struct {
+	name  string
+	block uint64
+}{
+	{"frontier", 0},
+	{"homestead", forkBlock(params.MainnetChainConfig.HomesteadBlock)},
+	{"tangerinewhistle", eip150Block},
+	{"spuriousdragon", eip158Block},
+	{"byzantium", forkBlock(params.MainnetChainConfig.ByzantiumBlock)},
+	{"constantinople", constantinopleBlock},
+	{"petersburg", forkBlock(params.MainnetChainConfig.PetersburgBlock)},
+}
+
+// gastableCmd implements "vmstats gastable", which prints the constant gas cost
+// assumed for every opcode at a fork or block, i.e. the denominators of the
+// per-gas metrics.
+func gastableCmd(args []string) error {
+	fs := flag.NewFlagSet("gastable", flag.ExitOnError)
+	var (
+		fork  = fs.String("fork", "", "Fork to print the gas costs of (defaults to the latest)")
+		block = fs.Uint64("block", 0, "Block to print the gas costs at, instead of a fork")
+	)
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", strings.Join(fs.Args(), " "))
+	}
+	var (
+		name   string
+		number uint64
+	)
+	switch {
+	case *fork != "" && *block != 0:
+		return fmt.Errorf("--fork and --block are mutually exclusive")
+	case *block != 0:
+		name, number = fmt.Sprintf("block %d", *block), *block
+	default:
+		var err error
+		if name, number, err = lookupFork(*fork); err != nil {
+			return err
+		}
+	}
+	if number == math.MaxUint64 {
+		return fmt.Errorf("fork %v is not scheduled on mainnet", name)
+	}
+	printGasTable(os.Stdout, name, number)
+	return nil
+}
+
+// lookupFork returns the name and activation block of the given fork, or of
+// the latest fork if the name is empty.
+func lookupFork(name string) (string, uint64, error) {
+	if name == "" {
+		latest := forks[len(forks)-1]
+		return latest.name, latest.block, nil
+	}
+	var names []string
+	for _, f := range forks {
+		if f.name == strings.ToLower(name) {
+			return f.name, f.block, nil
+		}
+		names = append(names, f.name)
+	}
+	return "", 0, fmt.Errorf("unknown fork %q (available: %v)", name, strings.Join(names, ", "))
+}
+
+// printGasTable writes the gas cost of every defined opcode at the given
+// block. Opcodes without a constant cost have no time per gas either, and are
+// marked as such.
+func printGasTable(w io.Writer, name string, number uint64) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Gas costs at %v (block %d)\n", name, number)
+	fmt.Fprintf(tw, "OPCODE\tVALUE\tGAS\t\n")
+	for i := 0; i < 256; i++ {
+		op := vm.OpCode(i)
+		if !definedOp(op) {
+			continue
+		}
+		gas := "-"
+		if cost := gasCost(op, number); cost > 0 {
+			gas = fmt.Sprint(cost)
+		}
+		fmt.Fprintf(tw, "%v\t0x%02x\t%v\t\n", opName(op), i, gas)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// mainnetGasLimits are the plateaus of the gas limit of mainnet, which the
+// miners move by voting, and London doubled. The blocks are approximate, for
+// the exact limit load a gasLimit column with --gas-used.
+var mainnetGasLimits = &sysSeries{
+	blocks: []float64{0, 50000, 1000000, 2500000, 3900000, 4800000, 8570000, 10500000, 12200000, 12965000},
+	values: []float64{5000, 3141592, 4712388, 5500000, 6700000, 8000000, 10000000, 12500000, 15000000, 30000000},
+	steps:  true,
+}
+
+// addGasUsedMetrics makes the gas used available as system metrics, to be
+// overlaid on the line charts: gasUsed, and with the gas limit, gasLimit and
+// fullness, the percentage of the gas limit used.
+func addGasUsedMetrics() error {
+	if sysMetrics == nil {
+		sysMetrics = make(map[string]*sysSeries)
+	}
+	add := func(name string, s *sysSeries) error {
+		if sysMetrics[name] != nil {
+			return fmt.Errorf("system metric %q is defined twice", name)
+		}
+		sysMetrics[name] = s
+		return nil
+	}
+	if blockGasLimit != nil {
+		blockGasLimit.steps = true
+		if err := add("gasLimit", blockGasLimit); err != nil {
+			return err
+		}
+	}
+	if blockGasUsed == nil {
+		return nil
+	}
+	if err := add("gasUsed", blockGasUsed); err != nil {
+		return err
+	}
+	if blockGasLimit == nil {
+		return nil
+	}
+	fullness := new(sysSeries)
+	for i, block := range blockGasUsed.blocks {
+		if limit, ok := blockGasLimit.at(block); ok && limit > 0 {
+			fullness.blocks = append(fullness.blocks, block)
+			fullness.values = append(fullness.values, 100*blockGasUsed.values[i]/limit)
+		}
+	}
+	return add("fullness", fullness)
+}
+
+// addChainGasLimit makes the gas limit of mainnet available as the gasLimit
+// system metric, unless another chain is declared in the metadata of the run,
+// or a gas limit was loaded. The runs of other chains need a gasLimit column,
+// see --gas-used, or a system metric of that name, for --gas-limit.
+func addChainGasLimit(meta runMeta) error {
+	if sysMetrics == nil {
+		sysMetrics = make(map[string]*sysSeries)
+	}
+	if sysMetrics["gasLimit"] == nil && (meta.Chain == "" || meta.Chain == "mainnet") {
+		sysMetrics["gasLimit"] = mainnetGasLimits
+	}
+	if *gasLimitFlag && sysMetrics["gasLimit"] == nil {
+		return fmt.Errorf("no gas limit of run %v on chain %v, see --gas-used or --sysmetrics", meta.Name, meta.Chain)
+	}
+	return nil
+}
+
+// stepped returns the samples of a stepwise series from from to to, with a
+// vertical step at every change, and the value before from carried over.
+func (s *sysSeries) stepped(from, to float64) ([]float64, []float64) {
+	var xvals, yvals []float64
+	for i, block := range s.blocks {
+		switch {
+		case block <= from:
+			xvals, yvals = []float64{from}, []float64{s.values[i]}
+		case block <= to:
+			if len(yvals) > 0 {
+				if yvals[len(yvals)-1] == s.values[i] {
+					continue
+				}
+				xvals, yvals = append(xvals, block), append(yvals, yvals[len(yvals)-1])
+			}
+			xvals, yvals = append(xvals, block), append(yvals, s.values[i])
+		}
+	}
+	if len(yvals) > 0 && xvals[len(xvals)-1] < to {
+		xvals, yvals = append(xvals, to), append(yvals, yvals[len(yvals)-1])
+	}
+	return xvals, yvals
+}
+
+// intervalGas returns the gas used by the blocks of the interval of the data
+// point, or zero if the gas used is not loaded.
+func intervalGas(dp *dataPoint) float64 {
+	if cumulativeGas == nil {
+		return 0
+	}
+	end := float64(dp.blockNumber)
+	return blockGas(end) - blockGas(end-float64(dp.blocks()))
+}
+
+// gasUsed returns the gas used and the gas limit of a block.
+func (c *rpcClient) gasUsed(ctx context.Context, number int) (uint64, uint64, error) {
+	var block struct {
+		GasUsed  string `json:"gasUsed"`
+		GasLimit string `json:"gasLimit"`
+	}
+	err := c.call(ctx, &block, "eth_getBlockByNumber", "0x"+strconv.FormatInt(int64(number), 16), false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("block %d: %v", number, err)
+	}
+	used, err := strconv.ParseUint(strings.TrimPrefix(block.GasUsed, "0x"), 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("block %d: gas used %q: %v", number, block.GasUsed, err)
+	}
+	limit, err := strconv.ParseUint(strings.TrimPrefix(block.GasLimit, "0x"), 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("block %d: gas limit %q: %v", number, block.GasLimit, err)
+	}
+	return used, limit, nil
+}
+
+// exportGasUsed writes the gas used and the gas limit of the blocks from
+// from to to as gasused.csv in dir. The file is written atomically, like the
+// metrics files.
+func exportGasUsed(ctx context.Context, c *rpcClient, from, to int, dir string) (string, error) {
+	tmp, err := ioutil.TempFile(dir, ".gasused-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := csv.NewWriter(tmp)
+	w.Write([]string{"block", "gasUsed", "gasLimit"})
+	for number := from; number <= to; number++ {
+		used, limit, err := c.gasUsed(ctx, number)
+		if err != nil {
+			return "", err
+		}
+		w.Write([]string{strconv.Itoa(number), strconv.FormatUint(used, 10), strconv.FormatUint(limit, 10)})
+		if (number-from+1)%*everyFlag == 0 {
+			log.Info("Exported gas used", "block", number)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "gasused.csv")
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// gasUsedCmd implements "vmstats gasused", which exports the gas used and the
+// gas limit of every block from --from to --to of a node to gasused.csv in
+// --out, for --gas-used.
+func gasUsedCmd(ctx context.Context) {
+	if *toFlag < *fromFlag {
+		fatal(exitUsage, "Invalid block range, see --from and --to", "from", *fromFlag, "to", *toFlag)
+	}
+	if *everyFlag <= 0 {
+		fatal(exitUsage, "Invalid interval, see --every", "every", *everyFlag)
+	}
+	if err := os.MkdirAll(*outFlag, 0755); err != nil {
+		fatal(exitFailure, "Failed to create output directory", "err", err)
+	}
+	log.Info("Exporting gas used", "rpc", *rpcFlag, "from", *fromFlag, "to", *toFlag)
+	path, err := exportGasUsed(ctx, &rpcClient{url: *rpcFlag}, *fromFlag, *toFlag, *outFlag)
+	if err != nil {
+		fatal(exitCode(err), "Failed to export gas used", "err", err)
+	}
+	fmt.Println(path)
+}
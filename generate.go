@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	genMixFlag   = flag.String("gen-mix", "PUSH1=5000:15,ADD=2000:20,MSTORE=800:40,SHA3=100:600,SLOAD=150:2500,SSTORE=40:6000,BALANCE=20:4000,CALL=30:8000", "Opcode mix of vmstats generate: comma-separated OP=EXECUTIONS:NANOS, executions per block and nanoseconds per execution")
+	genNoiseFlag = flag.Float64("gen-noise", 0.1, "Relative standard deviation of the executions and the time of every interval generated")
+	genForkFlag  = flag.String("gen-fork", "", "Fork effects of vmstats generate: comma-separated OP@FORK=FACTOR, scaling the time per execution of OP from FORK on, e.g. SLOAD@tangerinewhistle=0.5")
+	genSeedFlag  = flag.Int64("gen-seed", 1, "Seed of the noise of vmstats generate, the same seed gives the same files")
+)
+
+// genOp is the cost of an opcode in a generated run.
+type genOp struct {
+	op       vm.OpCode
+	perBlock float64 // Executions per block
+	nanos    float64 // Time per execution, before any fork effects
+}
+
+// forkEffect scales the time per execution of an opcode from a fork on.
+type forkEffect struct {
+	op     vm.OpCode
+	block  uint64
+	factor float64
+}
+
+// parseMix parses an opcode mix like "SLOAD=150:2500,ADD=2000:20".
+func parseMix(spec string) ([]genOp, error) {
+	var mix []genOp
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected OP=EXECUTIONS:NANOS", entry)
+		}
+		op, err := parseOp(strings.ToUpper(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		cost := strings.SplitN(parts[1], ":", 2)
+		if len(cost) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected OP=EXECUTIONS:NANOS", entry)
+		}
+		perBlock, err := strconv.ParseFloat(cost[0], 64)
+		if err != nil || perBlock < 0 {
+			return nil, fmt.Errorf("invalid executions of %v: %q", parts[0], cost[0])
+		}
+		nanos, err := strconv.ParseFloat(cost[1], 64)
+		if err != nil || nanos < 0 {
+			return nil, fmt.Errorf("invalid nanoseconds of %v: %q", parts[0], cost[1])
+		}
+		mix = append(mix, genOp{op, perBlock, nanos})
+	}
+	return mix, nil
+}
+
+// parseForkEffects parses fork effects like "SLOAD@tangerinewhistle=0.5".
+func parseForkEffects(spec string) ([]forkEffect, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var effects []forkEffect
+	for _, entry := range strings.Split(spec, ",") {
+		var (
+			at  = strings.SplitN(strings.TrimSpace(entry), "@", 2)
+			eff forkEffect
+		)
+		if len(at) != 2 {
+			return nil, fmt.Errorf("invalid fork effect %q, expected OP@FORK=FACTOR", entry)
+		}
+		op, err := parseOp(strings.ToUpper(at[0]))
+		if err != nil {
+			return nil, err
+		}
+		eff.op = op
+		parts := strings.SplitN(at[1], "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid fork effect %q, expected OP@FORK=FACTOR", entry)
+		}
+		found := false
+		for _, f := range forks {
+			if f.name == strings.ToLower(parts[0]) {
+				eff.block, found = f.block, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown fork %q", parts[0])
+		}
+		if eff.factor, err = strconv.ParseFloat(parts[1], 64); err != nil || eff.factor < 0 {
+			return nil, fmt.Errorf("invalid factor of fork effect %q", entry)
+		}
+		effects = append(effects, eff)
+	}
+	return effects, nil
+}
+
+// generator produces the meters of a synthetic run.
+type generator struct {
+	mix     []genOp
+	effects []forkEffect
+	noise   float64
+	rnd     *rand.Rand
+}
+
+// jitter returns a random factor around 1 with the relative deviation of the
+// noise. It is never negative.
+func (g *generator) jitter() float64 {
+	return math.Max(0, 1+g.noise*g.rnd.NormFloat64())
+}
+
+// slowdown returns the factor of the time per execution of op at block.
+func (g *generator) slowdown(op vm.OpCode, block uint64) float64 {
+	factor := 1.0
+	for _, eff := range g.effects {
+		if eff.op == op && block >= eff.block {
+			factor *= eff.factor
+		}
+	}
+	return factor
+}
+
+// interval adds the executions of the blocks from to to, both included, to
+// the meters. The noise is drawn once per interval and opcode, while the gas
+// and the fork effects apply per block, so an interval may span a fork.
+func (g *generator) interval(m *[256]opMeter, from, to int) {
+	for _, gop := range g.mix {
+		var (
+			rate            = gop.perBlock * g.jitter()
+			speed           = g.jitter()
+			count, gas, dur float64
+		)
+		for number := from; number <= to; number++ {
+			count += rate
+			gas += rate * float64(gasCost(gop.op, uint64(number)))
+			dur += rate * gop.nanos * speed * g.slowdown(gop.op, uint64(number))
+		}
+		meter := &m[gop.op]
+		meter.Num += uint64(math.Round(count))
+		meter.Gas += uint64(math.Round(gas))
+		meter.Time += time.Duration(math.Round(dur))
+	}
+}
+
+// newGenerator returns the generator of the flags.
+func newGenerator() (*generator, error) {
+	if *genNoiseFlag < 0 {
+		return nil, fmt.Errorf("invalid noise %v, see --gen-noise", *genNoiseFlag)
+	}
+	mix, err := parseMix(*genMixFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opcode mix: %v", err)
+	}
+	effects, err := parseForkEffects(*genForkFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fork effects: %v", err)
+	}
+	return &generator{mix: mix, effects: effects, noise: *genNoiseFlag, rnd: rand.New(rand.NewSource(*genSeedFlag))}, nil
+}
+
+// write writes the metrics files of the run to dir, with a snapshot every
+// every blocks from from to to, and returns the number of files written.
+func (g *generator) write(ctx context.Context, dir string, from, to, every int) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	var (
+		meters [256]opMeter
+		files  int
+	)
+	for start := from; start <= to; start += every {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		end := start + every - 1
+		if end > to {
+			end = to
+		}
+		g.interval(&meters, start, end)
+		if _, err := writeMetrics(dir, end, meters, nil); err != nil {
+			return files, err
+		}
+		files++
+	}
+	return files, nil
+}
+
+// generateCmd implements "vmstats generate", which writes the metrics files of
+// a synthetic run to --out, with a snapshot every --every blocks from --from
+// to --to. The run executes the --gen-mix of opcodes in every block, with
+// --gen-noise, and the time of opcodes changes at forks per --gen-fork. The
+// gas follows the schedule of the forks. The files are the same for the same
+// flags, so they can back golden charts, see --golden.
+func generateCmd(ctx context.Context) {
+	if *toFlag < *fromFlag {
+		fatal(exitUsage, "Invalid block range, see --from and --to", "from", *fromFlag, "to", *toFlag)
+	}
+	if *everyFlag <= 0 {
+		fatal(exitUsage, "Invalid interval, see --every", "every", *everyFlag)
+	}
+	g, err := newGenerator()
+	if err != nil {
+		fatal(exitUsage, "Invalid generator", "err", err)
+	}
+	log.Info("Generating metrics", "from", *fromFlag, "to", *toFlag, "every", *everyFlag, "ops", len(g.mix))
+	files, err := g.write(ctx, *outFlag, *fromFlag, *toFlag, *everyFlag)
+	if err != nil {
+		fatal(exitCode(err), "Failed to generate metrics", "files", files, "err", err)
+	}
+	log.Info("Generated metrics", "dir", *outFlag, "files", files)
+}
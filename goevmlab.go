@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// traceStep is a line of an EIP-3155 trace, as written by the evm tools which
+// goevmlab runs its fuzzing corpus through. Only the opcode is used, the trace
+// has no timings:
+//
+//	{"pc":0,"op":96,"gas":"0x2540be400","gasCost":"0x3","memSize":0,"stack":[],"depth":1,"refund":0,"opName":"PUSH1"}
+//
+// The summary line at the end of a trace has no opcode, and is skipped.
+type traceStep struct {
+	Op *int `json:"op"`
+}
+
+// parseTrace decodes an EIP-3155 trace, counting the executed opcodes. The
+// trace has no block number, it is taken from the filename, which for a
+// fuzzing corpus is the number of the test.
+func parseTrace(r io.Reader) ([256]opMeter, int, error) {
+	var (
+		m     [256]opMeter
+		steps int
+	)
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var step traceStep
+		if err := dec.Decode(&step); err == io.EOF {
+			break
+		} else if err != nil {
+			return m, 0, fmt.Errorf("invalid trace: line %d: %v", line, err)
+		}
+		if step.Op == nil {
+			continue
+		}
+		if *step.Op < 0 || *step.Op > 0xff {
+			return m, 0, fmt.Errorf("invalid trace: line %d: opcode %d out of range", line, *step.Op)
+		}
+		if op := vm.OpCode(*step.Op); definedOp(op) {
+			m[op].Num++
+		}
+		steps++
+	}
+	if steps == 0 {
+		return m, 0, fmt.Errorf("invalid trace: no steps")
+	}
+	return m, 0, nil
+}
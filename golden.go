@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	goldenFlag       = flag.String("golden", "", "Compare the rendered charts and sidecars with the hashes in this manifest, and fail on any difference")
+	updateGoldenFlag = flag.Bool("update-golden", false, "Write the hashes of the rendered charts to the --golden manifest, instead of comparing with it")
+	goldenDataFlag   = flag.Bool("golden-data", false, "Compare only the sidecars with the --golden manifest, not the images, whose bytes depend on the fonts and the version of go-chart")
+)
+
+// checkGolden compares the charts rendered so far with those listed in the
+// golden manifest at path. Every chart which is missing, new, or differs from
+// its golden hash, or whose sidecar does, is a failure. The golden manifest is
+// a manifest as written by --manifest, of which only the charts are compared.
+// With --golden-data, only the sidecars are, which hold the plotted points, and
+// every chart must have one.
+func checkGolden(path string) error {
+	charts := manifestCharts()
+	if *goldenDataFlag {
+		for i := range charts {
+			charts[i].SHA256 = ""
+		}
+	}
+	if *updateGoldenFlag {
+		data, err := json.MarshalIndent(manifest{Charts: charts}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		log.Info("Updated golden manifest", "file", path, "charts", len(charts))
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("golden manifest: %v", err)
+	}
+	var golden manifest
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return fmt.Errorf("invalid golden manifest %v: %v", path, err)
+	}
+	want := make(map[string]manifestEntry)
+	for _, entry := range golden.Charts {
+		want[entry.File] = entry
+	}
+	var fails failures
+	for _, entry := range charts {
+		g, ok := want[entry.File]
+		delete(want, entry.File)
+		switch {
+		case !ok:
+			fails.add(fmt.Errorf("golden: %v is not in %v", entry.File, path))
+		case *goldenDataFlag && entry.Sidecar == nil:
+			fails.add(fmt.Errorf("golden: %v has no sidecar to compare, see --sidecar", entry.File))
+		case g.SHA256 != entry.SHA256:
+			fails.add(fmt.Errorf("golden: %v differs", entry.File))
+		case (g.Sidecar == nil) != (entry.Sidecar == nil):
+			fails.add(fmt.Errorf("golden: %v has a sidecar in only one of the runs", entry.File))
+		case g.Sidecar != nil && g.Sidecar.SHA256 != entry.Sidecar.SHA256:
+			fails.add(fmt.Errorf("golden: %v differs", entry.Sidecar.File))
+		}
+	}
+	for _, g := range golden.Charts {
+		if _, missing := want[g.File]; missing {
+			fails.add(fmt.Errorf("golden: %v was not rendered", g.File))
+		}
+	}
+	if len(fails) == 0 {
+		log.Info("Charts match the golden manifest", "file", path, "charts", len(charts))
+	}
+	return fails.err()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGolden generates a synthetic run with a fixed seed, charts it with the
+// default suite, and compares the sidecars of the charts with those listed in
+// testdata/golden.json. The images are not compared, as their bytes depend on
+// the fonts and the version of go-chart. After an intended change of the
+// charts, the golden manifest is rewritten with
+//
+//	go test -run TestGolden -update-golden
+func TestGolden(t *testing.T) {
+	golden, err := filepath.Abs(filepath.Join("testdata", "golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The charts are rendered to ./charts, so work in a scratch directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := t.TempDir()
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("charts", 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Span Homestead and Tangerine Whistle, with an effect at the latter
+	setFlags(t, map[string]string{
+		"gen-seed":     "1",
+		"gen-fork":     "SLOAD@tangerinewhistle=0.5",
+		"cache":        "",
+		"manifest":     "true",
+		"reproducible": "true",
+		"sidecar":      "json",
+		"golden-data":  "true",
+	})
+	ctx := context.Background()
+	g, err := newGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsDir := filepath.Join(work, "metrics")
+	if _, err := g.write(ctx, metricsDir, 1, 3000000, 50000); err != nil {
+		t.Fatal(err)
+	}
+
+	suite, err := loadSuite("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := suite.registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	if err := suite.registerGroups(); err != nil {
+		t.Fatal(err)
+	}
+	if err := setOpNames(suite.OpNames); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFormat("geth"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setExcluded(); err != nil {
+		t.Fatal(err)
+	}
+	flagLayout, err := layoutFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout = suite.Layout.merge(flagLayout)
+	if err := setColors(suite.Theme, suite.Palette, suite.Palettes); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := readStats(ctx, metricsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts = make(map[string]manifestEntry)
+	if fails := renderRun(ctx, ioutil.Discard, suite, stat, runMeta{Name: "golden"}); len(fails) > 0 {
+		t.Fatalf("rendering failed: %v", fails.err())
+	}
+	if err := checkGolden(golden); err != nil {
+		t.Fatal(err)
+	}
+}
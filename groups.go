@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var (
+	opsMatchFlag = flag.String("ops-match", "", "Only chart the opcodes whose name matches this regex, e.g. 'PUSH.*|DUP.*'")
+	excludeFlag  = flag.String("exclude", "", "Comma-separated opcodes or groups to leave out of all charts, e.g. SLOAD,CALL")
+)
+
+// excludedOps are the opcodes left out of all charts, see --exclude.
+var excludedOps = make(map[vm.OpCode]bool)
+
+// opGroups are the user-defined groups of opcodes, which can be used in place
+// of opcode names in chart specs, like the opcode families.
+var opGroups = make(map[string][]vm.OpCode)
+
+// parseOp returns the opcode with the given name.
+func parseOp(name string) (vm.OpCode, error) {
+	op, ok := lookupOp(name)
+	if !ok {
+		return op, fmt.Errorf("unknown opcode %q", name)
+	}
+	return op, nil
+}
+
+// parseOps resolves a list of opcode and group names. Opcodes which are
+// listed more than once, e.g. in two groups, are only returned once.
+func parseOps(names []string) ([]vm.OpCode, error) {
+	var (
+		ops  []vm.OpCode
+		seen = make(map[vm.OpCode]bool)
+	)
+	for _, name := range names {
+		group, ok := opGroups[name]
+		if !ok {
+			group, ok = familyOps[name]
+		}
+		if !ok {
+			op, err := parseOp(name)
+			if err != nil {
+				return nil, err
+			}
+			group = []vm.OpCode{op}
+		}
+		for _, op := range group {
+			if !seen[op] {
+				seen[op] = true
+				ops = append(ops, op)
+			}
+		}
+	}
+	return ops, nil
+}
+
+// registerGroups adds the user-defined opcode groups of the suite.
+func (suite chartSuite) registerGroups() error {
+	// In order of their names, so that the same error is reported every time
+	names := make([]string, 0, len(suite.Groups))
+	for name := range suite.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		members := suite.Groups[name]
+		if _, err := parseOp(name); err == nil {
+			return fmt.Errorf("group %q has the name of an opcode", name)
+		}
+		var ops []vm.OpCode
+		for _, member := range members {
+			op, err := parseOp(member)
+			if err != nil {
+				return fmt.Errorf("group %q: %v", name, err)
+			}
+			ops = append(ops, op)
+		}
+		opGroups[name] = ops
+	}
+	return nil
+}
+
+// compileOpsMatch compiles a regex for matching opcode names. The regex must
+// match the whole name, so "PUSH1" does not select PUSH16.
+func compileOpsMatch(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid opcode regex %q: %v", expr, err)
+	}
+	return re, nil
+}
+
+// matchOps returns the opcodes whose name matches re.
+func matchOps(ops []vm.OpCode, re *regexp.Regexp) []vm.OpCode {
+	var matched []vm.OpCode
+	for _, op := range ops {
+		if re.MatchString(op.String()) || re.MatchString(opName(op)) {
+			matched = append(matched, op)
+		}
+	}
+	return matched
+}
+
+// setExcluded resolves the opcodes and groups of --exclude. It must be called
+// after the groups are registered.
+func setExcluded() error {
+	if *excludeFlag == "" {
+		return nil
+	}
+	ops, err := parseOps(strings.Split(*excludeFlag, ","))
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		excludedOps[op] = true
+	}
+	return nil
+}
+
+// withoutExcluded returns the opcodes which are not excluded from the charts.
+func withoutExcluded(ops []vm.OpCode) []vm.OpCode {
+	if len(excludedOps) == 0 {
+		return ops
+	}
+	var included []vm.OpCode
+	for _, op := range ops {
+		if !excludedOps[op] {
+			included = append(included, op)
+		}
+	}
+	return included
+}
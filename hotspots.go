@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var hotspotOpFlag = flag.String("hotspot-op", "", "Rank the contracts by the cost of this opcode, e.g. SLOAD, instead of their total cost")
+
+// hotspotBreakdown is the number of opcodes listed per contract.
+const hotspotBreakdown = 5
+
+// hotspot is the cost of the opcodes executed by one contract, summed over all
+// transactions.
+type hotspot struct {
+	addr   string
+	txs    int
+	meters map[vm.OpCode]opMeter
+}
+
+// hasContracts reports whether any of the transactions is broken down by the
+// executing contract.
+func hasContracts(txs []txStat) bool {
+	for _, tx := range txs {
+		if len(tx.contracts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hotspots sums up the meters of every contract over the transactions.
+func hotspots(txs []txStat) []*hotspot {
+	byAddr := make(map[string]*hotspot)
+	for _, tx := range txs {
+		for addr, meters := range tx.contracts {
+			h := byAddr[addr]
+			if h == nil {
+				h = &hotspot{addr: addr, meters: make(map[vm.OpCode]opMeter)}
+				byAddr[addr] = h
+			}
+			h.txs++
+			for op, m := range meters {
+				sum := h.meters[op]
+				sum.Num += m.Num
+				sum.Time += m.Time
+				sum.Gas += m.Gas
+				h.meters[op] = sum
+			}
+		}
+	}
+	list := make([]*hotspot, 0, len(byAddr))
+	for _, h := range byAddr {
+		list = append(list, h)
+	}
+	return list
+}
+
+// breakdown lists the costliest opcodes of the contract with their share of its
+// total cost, e.g. "SLOAD 45.2%, SSTORE 20.1%".
+func (h *hotspot) breakdown(cost txCost, total float64) string {
+	ops := make([]vm.OpCode, 0, len(h.meters))
+	for op := range h.meters {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if a, b := cost.of(h.meters[ops[i]]), cost.of(h.meters[ops[j]]); a != b {
+			return a > b
+		}
+		return ops[i] < ops[j]
+	})
+	if len(ops) > hotspotBreakdown {
+		ops = ops[:hotspotBreakdown]
+	}
+	var parts []string
+	for _, op := range ops {
+		share := float64(0)
+		if total > 0 {
+			share = 100 * cost.of(h.meters[op]) / total
+		}
+		parts = append(parts, fmt.Sprintf("%v %.1f%%", opName(op), share))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printHotspots writes a table of the n costliest contracts, with the opcodes
+// they spend their cost on. With --hotspot-op, the contracts are ranked by the
+// cost of that opcode, answering which contracts drive e.g. the SLOAD load.
+func printHotspots(w io.Writer, txs []txStat, n int) error {
+	cost := txCostOf(txs)
+	total := func(h *hotspot) float64 {
+		var sum float64
+		for _, m := range h.meters {
+			sum += cost.of(m)
+		}
+		return sum
+	}
+	rank, title := total, fmt.Sprintf("Costliest contracts by %v", cost)
+	if *hotspotOpFlag != "" {
+		op, err := parseOp(*hotspotOpFlag)
+		if err != nil {
+			return err
+		}
+		rank = func(h *hotspot) float64 { return cost.of(h.meters[op]) }
+		title = fmt.Sprintf("Costliest contracts by %v of %v", cost, opName(op))
+	}
+	list := hotspots(txs)
+	var overall float64
+	for _, h := range list {
+		overall += rank(h)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if a, b := rank(list[i]), rank(list[j]); a != b {
+			return a > b
+		}
+		return list[i].addr < list[j].addr
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\n%v\n", title)
+	fmt.Fprintf(tw, "CONTRACT\tTXS\t%v\tSHARE%%\tOPCODES\t\n", strings.ToUpper(cost.String()))
+	for _, h := range list {
+		share := float64(0)
+		if overall > 0 {
+			share = 100 * rank(h) / overall
+		}
+		fmt.Fprintf(tw, "%v\t%d\t%v\t%.1f\t%v\t\n", h.addr, h.txs, cost.format(rank(h)), share, h.breakdown(cost, total(h)))
+	}
+	return tw.Flush()
+}
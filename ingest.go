@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// parsedFile is a metrics file, decoded by one of the parse workers.
+type parsedFile struct {
+	*metricsFile
+	meters  [256]opMeter
+	block   int           // Block number embedded in the dump, zero if none
+	txs     []txMeters    // Meters of the transactions, with --per-tx
+	runtime *runtimeStats // Runtime metrics of the node, if dumped
+	hash    [32]byte      // Hash of the raw contents
+	err     error         // Decoding error, if any
+}
+
+type parseJob struct {
+	file *metricsFile
+	out  chan *parsedFile
+}
+
+// parseFile decodes f, hashing its contents along the way.
+func parseFile(f *metricsFile) *parsedFile {
+	p := &parsedFile{metricsFile: f}
+	r, err := f.open()
+	if err != nil {
+		p.err = err
+		return p
+	}
+	defer r.Close()
+	h := sha256.New()
+	tee := io.TeeReader(r, h)
+	if format.parseDump != nil {
+		var x dumpExtras
+		p.meters, p.block, x, p.err = format.parseDump(tee, *perTxFlag)
+		p.txs, p.runtime = x.txs, x.runtime
+	} else {
+		p.meters, p.block, p.err = format.parse(tee)
+	}
+	// The decoder may stop short of the end, the hash covers the whole file
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil && p.err == nil {
+		p.err = err
+	}
+	copy(p.hash[:], h.Sum(nil))
+	f.open = nil
+	return p
+}
+
+var errAborted = errors.New("aborted")
+
+// parseFiles reads the matching files from all sources, and decodes them in a
+// pool of workers sized to GOMAXPROCS. The results are passed to fn one at a
+// time, in the order the files were read, so fn needs no locking. Loading
+// stops at the first error from fn, or when ctx is cancelled. A source which
+// cannot be read is skipped, and returned among the failed ones, unless in
+// strict mode.
+func parseFiles(ctx context.Context, sources []string, match func(name string) bool, fn func(f *parsedFile) error) (failed []skippedFile, err error) {
+	var (
+		workers = runtime.GOMAXPROCS(0)
+		jobs    = make(chan parseJob, workers)
+		results = make(chan chan *parsedFile, 2*workers)
+		abort   = make(chan struct{})
+		readErr error
+	)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				job.out <- parseFile(job.file)
+			}
+		}()
+	}
+	go func() {
+		defer close(results)
+		defer close(jobs)
+		for _, src := range sources {
+			err := forEachFile(ctx, src, match, func(f *metricsFile) error {
+				// The result channel is queued before the job is handed out,
+				// which keeps the results in order
+				out := make(chan *parsedFile, 1)
+				select {
+				case results <- out:
+				case <-abort:
+					return errAborted
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				jobs <- parseJob{f, out}
+				return nil
+			})
+			switch {
+			case err == errAborted:
+				return
+			case ctx.Err() != nil:
+				readErr = ctx.Err()
+				return
+			case err != nil && *strictFlag:
+				readErr = err
+				return
+			case err != nil:
+				// Keep what was read, and carry on with the other sources
+				failed = append(failed, skippedFile{src, err.Error()})
+			}
+		}
+	}()
+	for out := range results {
+		f := <-out
+		if err != nil {
+			continue // Drain the queue, so the reader can stop
+		}
+		if err = fn(f); err != nil {
+			close(abort)
+		}
+	}
+	if err != nil {
+		return failed, err
+	}
+	return failed, readErr
+}
+
+// loader adds parsed files to a collection, skipping invalid files and
+// resolving duplicate snapshots in favour of the most recently modified file,
+// or of the canonical block if their filenames hold different block hashes.
+type loader struct {
+	stat      *statCollection
+	pattern   *filePattern
+	progress  *progress // Optional, reports the files loaded
+	loaded    map[int]origin
+	merged    map[[32]byte]bool // Hashes of the files merged, for formats with deltas
+	skipped   []skippedFile
+	salvaged  []string // Truncated files whose meters were complete
+	conflicts []string
+	canonical *canonicalHashes // Optional, see --canonical
+}
+
+// origin is the file a snapshot was loaded from.
+type origin struct {
+	file  *metricsFile
+	hash  [32]byte
+	block string // Block hash from the filename, if it has one
+}
+
+func newLoader(stat *statCollection, pattern *filePattern) *loader {
+	return &loader{stat: stat, pattern: pattern, loaded: make(map[int]origin), merged: make(map[[32]byte]bool)}
+}
+
+// skip records a matching file which could not be loaded, and aborts the
+// loading in strict mode.
+func (l *loader) skip(name, reason string) error {
+	l.skipped = append(l.skipped, skippedFile{name, reason})
+	if *strictFlag {
+		return fmt.Errorf("%v: %v", name, reason)
+	}
+	return nil
+}
+
+// block returns the block number of the file. If it has none, the file is
+// skipped and ok is false.
+func (l *loader) block(f *parsedFile) (blnum int, ok bool, err error) {
+	blnum, err = l.pattern.block(f.name)
+	if err != nil {
+		return 0, false, l.skip(f.name, fmt.Sprintf("invalid block number: %v", err))
+	}
+	if blnum <= 0 {
+		return 0, false, l.skip(f.name, fmt.Sprintf("invalid block number %d", blnum))
+	}
+	return blnum, true, nil
+}
+
+// salvage clears the error of a truncated file which holds all meters, such as
+// the last dump written before a node crashed, so that it is loaded. In strict
+// mode, truncated files are skipped like any other invalid file.
+func (l *loader) salvage(f *parsedFile) {
+	if cut, ok := f.err.(*truncatedError); ok && cut.complete && !*strictFlag {
+		l.salvaged = append(l.salvaged, f.name)
+		f.err = nil
+	}
+}
+
+func (l *loader) add(f *parsedFile) error {
+	l.salvage(f)
+	blnum, ok, err := l.block(f)
+	if !ok {
+		return err
+	}
+	return l.addBlock(blnum, f)
+}
+
+// addBlock adds the file as the snapshot at blnum, unless an identical or a
+// more recent snapshot of that block was already loaded. With --canonical, a
+// snapshot of the canonical block is preferred over one of a block which was
+// reorged out, whichever was written last. For formats with
+// deltas, the files of the same block cover different parts of it, e.g. its
+// transactions, so they are merged instead.
+func (l *loader) addBlock(blnum int, f *parsedFile) error {
+	if format.deltas {
+		if !l.merged[f.hash] {
+			l.merged[f.hash] = true
+			l.stat.merge(blnum, f.meters)
+		}
+		return nil
+	}
+	var (
+		block    = l.pattern.hash(f.name)
+		resolved string
+	)
+	if prev, exists := l.loaded[blnum]; exists {
+		if prev.hash == f.hash {
+			return nil
+		}
+		useNew, canonical, err := l.preferCanonical(blnum, prev.block, block)
+		if err != nil {
+			return fmt.Errorf("canonical hash: %v", err)
+		}
+		ignored := "older"
+		if canonical {
+			ignored = "non-canonical"
+		} else {
+			useNew = f.modTime.After(prev.file.modTime)
+		}
+		if !useNew {
+			l.conflicts = append(l.conflicts, fmt.Sprintf("block %d: using %v/%v, ignoring %v %v/%v",
+				blnum, prev.file.source, prev.file.name, ignored, f.source, f.name))
+			return nil
+		}
+		resolved = fmt.Sprintf("block %d: using %v/%v, ignoring %v %v/%v",
+			blnum, f.source, f.name, ignored, prev.file.source, prev.file.name)
+	}
+	if err := l.stat.collect(blnum, f); err != nil {
+		return l.skip(f.name, err.Error())
+	}
+	if resolved != "" {
+		l.conflicts = append(l.conflicts, resolved)
+	}
+	l.loaded[blnum] = origin{f.metricsFile, f.hash, block}
+	return nil
+}
+
+func (l *loader) reportConflicts() {
+	if len(l.salvaged) > 0 {
+		log.Warn("Salvaged truncated files", "count", len(l.salvaged))
+		for i, name := range l.salvaged {
+			listed(i)("Salvaged file", "file", name)
+		}
+	}
+	if len(l.conflicts) > 0 {
+		log.Warn("Resolved conflicting snapshots", "count", len(l.conflicts))
+		for i, c := range l.conflicts {
+			listed(i)("Conflicting snapshot", "resolution", c)
+		}
+	}
+}
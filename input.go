@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var patternFlag = flag.String("pattern", `^metrics_to_(\d+)(?:_(?P<hash>(?:0x)?[0-9a-fA-F]+))?`,
+	"Regexp matching the metrics filenames, capturing the block number in the first group (or a group named 'block') and optionally the block hash in a group named 'hash', defaults to that of the format")
+
+// filePattern matches metrics filenames and extracts the block number, and the
+// block hash if the filenames have one.
+type filePattern struct {
+	re        *regexp.Regexp
+	group     int // Index of the capture group holding the block number
+	hashGroup int // Index of the capture group holding the block hash, zero if none
+}
+
+func newFilePattern(expr string) (*filePattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("pattern %q has no capture group for the block number", expr)
+	}
+	group := 1
+	if i := re.SubexpIndex("block"); i > 0 {
+		group = i
+	}
+	return &filePattern{re: re, group: group, hashGroup: re.SubexpIndex("hash")}, nil
+}
+
+func (p *filePattern) match(name string) bool {
+	return p.re.MatchString(name)
+}
+
+// block returns the block number captured from the filename.
+func (p *filePattern) block(name string) (int, error) {
+	m := p.re.FindStringSubmatch(name)
+	if m == nil {
+		return 0, fmt.Errorf("filename %q does not match %v", name, p.re)
+	}
+	return strconv.Atoi(m[p.group])
+}
+
+// hash returns the block hash captured from the filename, or "" if it has none.
+func (p *filePattern) hash(name string) string {
+	if p.hashGroup <= 0 {
+		return ""
+	}
+	m := p.re.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	return m[p.hashGroup]
+}
+
+// decompress wraps r in a decompressor, based on the file extension.
+func decompress(name string, r io.Reader) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(name, ".zst"):
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+// fileReader decompresses a file, and closes both on Close.
+type fileReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *fileReader) Close() error {
+	r.ReadCloser.Close()
+	return r.file.Close()
+}
+
+// openMetricsFile opens a metrics file, transparently decompressing .gz and .zst files.
+func openMetricsFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompress(path, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileReader{r, f}, nil
+}
+
+// buffered returns an opener for contents which have already been read.
+func buffered(data []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// metricsFile is an input file. Plain files are only opened once they are
+// parsed, files from archives and remote sources are read up front.
+type metricsFile struct {
+	name    string    // Base name of the file
+	source  string    // Directory, archive or URL the file was read from
+	modTime time.Time // Last modification time, zero if unknown
+	open    func() (io.ReadCloser, error)
+}
+
+type fileFn func(f *metricsFile) error
+
+// isArchive returns true if the path names a tar or zip archive.
+func isArchive(name string) bool {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.zst"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachFile calls fn with the name and the decompressed contents of every file
+// in the given directory or archive for which match returns true. Only the base
+// name of archive entries is passed on. The source may also be an http(s) URL,
+// or an s3:// or gs:// bucket path, downloads are aborted when ctx is cancelled.
+func forEachFile(ctx context.Context, src string, match func(name string) bool, fn fileFn) error {
+	switch {
+	case isRemote(src):
+		return forEachRemoteFile(ctx, src, match, fn)
+	case isObjectStore(src):
+		return forEachObject(ctx, src, match, fn)
+	case strings.HasSuffix(src, ".zip"):
+		return forEachZipFile(src, match, fn)
+	case isArchive(src):
+		return forEachTarFile(src, match, fn)
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fStat := range files {
+		if fStat.IsDir() || !match(fStat.Name()) {
+			continue
+		}
+		path := filepath.Join(src, fStat.Name())
+		open := func() (io.ReadCloser, error) {
+			return openMetricsFile(path)
+		}
+		if err := fn(&metricsFile{fStat.Name(), src, fStat.ModTime(), open}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forEachZipFile(src string, match func(name string) bool, fn fileFn) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || !match(name) {
+			continue
+		}
+		data, err := readEntry(f.Open, name)
+		if err != nil {
+			return err
+		}
+		if err := fn(&metricsFile{name, src, f.Modified, buffered(data)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forEachTarFile(src string, match func(name string) bool, fn fileFn) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// The archive itself may be compressed
+	outer := src
+	if strings.HasSuffix(src, ".tgz") {
+		outer += ".gz"
+	}
+	r, err := decompress(outer, f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !match(name) {
+			continue
+		}
+		data, err := readEntry(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(tr), nil
+		}, name)
+		if err != nil {
+			return err
+		}
+		if err := fn(&metricsFile{name, src, hdr.ModTime, buffered(data)}); err != nil {
+			return err
+		}
+	}
+}
+
+// readEntry reads an archive entry, decompressing it if needed.
+func readEntry(open func() (io.ReadCloser, error), name string) ([]byte, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	r, err := decompress(name, rc)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
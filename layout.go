@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+var (
+	widthFlag    = flag.Int("width", 0, "Width of rendered charts in pixels (0 = chart default)")
+	heightFlag   = flag.Int("height", 0, "Height of rendered charts in pixels (0 = chart default)")
+	dpiFlag      = flag.Float64("dpi", 0, "DPI of rendered charts (0 = chart default)")
+	barWidthFlag = flag.Int("barwidth", 0, "Width of the bars in bar charts (0 = chart default)")
+	paddingFlag  = flag.String("padding", "", "Chart padding as 'top,right,bottom,left' pixels")
+
+	legendFlag     = flag.String("legend", "", "Legend placement: left, bottom, thin (bottom, compact) or none")
+	legendSortFlag = flag.Bool("legend-sort", false, "Order the series and legend entries by their final value")
+	legendMaxFlag  = flag.Int("legend-max", 0, "Maximum number of legend entries (0 = no limit)")
+	maxSeriesFlag  = flag.Int("max-series", 0, "Split charts with more opcodes than this into several charts (0 = never split)")
+	maxPointsFlag  = flag.Int("max-points", 0, "Downsample series to this many points before rendering (0 = no downsampling)")
+)
+
+// chartLayout holds the dimensions of rendered charts. Zero values mean that
+// the default for the respective chart type is used.
+type chartLayout struct {
+	Width    int        `json:"width,omitempty"`
+	Height   int        `json:"height,omitempty"`
+	DPI      float64    `json:"dpi,omitempty"`
+	BarWidth int        `json:"barwidth,omitempty"`
+	Padding  *chart.Box `json:"padding,omitempty"`
+
+	Legend     string `json:"legend,omitempty"`     // Legend placement: left, bottom, thin or none
+	LegendSort bool   `json:"legendsort,omitempty"` // Order series by their final value
+	LegendMax  int    `json:"legendmax,omitempty"`  // Maximum number of legend entries
+
+	MaxSeries int `json:"maxseries,omitempty"` // Split charts with more opcodes than this
+	MaxPoints int `json:"maxpoints,omitempty"` // Downsample series to this many points (LTTB)
+}
+
+// layout is the effective layout for this invocation: the suite layout with
+// the command line flags applied on top.
+var layout chartLayout
+
+// merge returns a copy of l, with the non-zero fields of o applied on top.
+func (l chartLayout) merge(o chartLayout) chartLayout {
+	if o.Width != 0 {
+		l.Width = o.Width
+	}
+	if o.Height != 0 {
+		l.Height = o.Height
+	}
+	if o.DPI != 0 {
+		l.DPI = o.DPI
+	}
+	if o.BarWidth != 0 {
+		l.BarWidth = o.BarWidth
+	}
+	if o.Padding != nil {
+		l.Padding = o.Padding
+	}
+	if o.Legend != "" {
+		l.Legend = o.Legend
+	}
+	if o.LegendSort {
+		l.LegendSort = true
+	}
+	if o.LegendMax != 0 {
+		l.LegendMax = o.LegendMax
+	}
+	if o.MaxSeries != 0 {
+		l.MaxSeries = o.MaxSeries
+	}
+	if o.MaxPoints != 0 {
+		l.MaxPoints = o.MaxPoints
+	}
+	return l
+}
+
+// size returns the chart dimensions, falling back to the given defaults.
+func (l chartLayout) size(width, height int) (int, int) {
+	if l.Width != 0 {
+		width = l.Width
+	}
+	if l.Height != 0 {
+		height = l.Height
+	}
+	return width, height
+}
+
+// padding returns the configured padding, or def if none is configured.
+func (l chartLayout) padding(def chart.Box) chart.Box {
+	if l.Padding != nil {
+		return *l.Padding
+	}
+	return def
+}
+
+// barWidth returns the configured bar width, or def if none is configured.
+func (l chartLayout) barWidth(def int) int {
+	if l.BarWidth != 0 {
+		return l.BarWidth
+	}
+	return def
+}
+
+func parsePadding(s string) (*chart.Box, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid padding %q, want 'top,right,bottom,left'", s)
+	}
+	var vals [4]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("invalid padding %q: %v", s, err)
+		}
+		vals[i] = v
+	}
+	return &chart.Box{Top: vals[0], Right: vals[1], Bottom: vals[2], Left: vals[3]}, nil
+}
+
+// legend returns the legend renderables for the given chart. The legend lists
+// the series in chart order, so with LegendMax set, only the first entries
+// are shown.
+func (l chartLayout) legend(graph *chart.Chart) ([]chart.Renderable, error) {
+	// The legend is rendered from a shallow copy of the chart, so the
+	// entries can be truncated without removing the series themselves.
+	legendChart := *graph
+	legendChart.Series = nil
+	for _, s := range graph.Series {
+		// Unnamed series are continuations of a series split at a gap
+		if s.GetName() != "" {
+			legendChart.Series = append(legendChart.Series, s)
+		}
+	}
+	if l.LegendMax > 0 && len(legendChart.Series) > l.LegendMax {
+		legendChart.Series = legendChart.Series[:l.LegendMax]
+	}
+	switch l.Legend {
+	case "", "left":
+		return []chart.Renderable{chart.LegendLeft(&legendChart, overlay)}, nil
+	case "bottom":
+		return []chart.Renderable{chart.Legend(&legendChart, overlay)}, nil
+	case "thin":
+		return []chart.Renderable{chart.LegendThin(&legendChart, overlay)}, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown legend placement %q", l.Legend)
+}
+
+// layoutFromFlags returns the layout given on the command line.
+func layoutFromFlags() (chartLayout, error) {
+	l := chartLayout{
+		Width:      *widthFlag,
+		Height:     *heightFlag,
+		DPI:        *dpiFlag,
+		BarWidth:   *barWidthFlag,
+		Legend:     *legendFlag,
+		LegendSort: *legendSortFlag,
+		LegendMax:  *legendMaxFlag,
+		MaxSeries:  *maxSeriesFlag,
+		MaxPoints:  *maxPointsFlag,
+	}
+	if *paddingFlag != "" {
+		box, err := parsePadding(*paddingFlag)
+		if err != nil {
+			return l, err
+		}
+		l.Padding = box
+	}
+	return l, nil
+}
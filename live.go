@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// liveCollection is a statCollection which can be added to while charts are
+// rendered from it, e.g. by a collector which ingests and serves at the same
+// time. The charts are rendered from snapshots, which later additions don't
+// modify.
+//
+// The snapshots share the data points with the live collection, which is safe
+// since the points are never modified once added: the snapshots must arrive in
+// block order, so counter resets are stitched as they come in.
+type liveCollection struct {
+	mu       sync.RWMutex
+	stats    statCollection
+	stitcher stitcher
+	snap     *statCollection // Cached snapshot, nil after a change
+}
+
+func newLiveCollection() *liveCollection {
+	stats := newStatCollection()
+	stats.resets = make(map[int]bool)
+	return &liveCollection{stats: stats}
+}
+
+// collect adds the meters at the given block, which must be later than all
+// blocks added before.
+func (lc *liveCollection) collect(blnum int, m [256]opMeter) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if numbers := lc.stats.numbers(); len(numbers) > 0 && blnum <= numbers[len(numbers)-1] {
+		return fmt.Errorf("block %d is not after the last block %d", blnum, numbers[len(numbers)-1])
+	}
+	lc.stats.collectMeters(blnum, m)
+	if lc.stitcher.stitch(&lc.stats, blnum) {
+		lc.stats.resets[blnum] = true
+	}
+	lc.snap = nil
+	return nil
+}
+
+// snapshot returns the collection as it is now. It is safe for concurrent use,
+// and is not modified by later calls to collect.
+func (lc *liveCollection) snapshot() statCollection {
+	lc.mu.RLock()
+	snap := lc.snap
+	lc.mu.RUnlock()
+	if snap != nil {
+		return *snap
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.snap == nil {
+		stats := lc.stats
+		stats.data = make(map[int]map[vm.OpCode]*dataPoint, len(lc.stats.data))
+		for number, points := range lc.stats.data {
+			stats.data[number] = points
+		}
+		stats.index = append([]int(nil), lc.stats.index...)
+		stats.resets = make(map[int]bool, len(lc.stats.resets))
+		for number := range lc.stats.resets {
+			stats.resets[number] = true
+		}
+		stats.skipped = append([]skippedFile(nil), lc.stats.skipped...)
+		lc.snap = &stats
+	}
+	return *lc.snap
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	verboseFlag   = flag.Bool("verbose", false, "Log debug messages, and list every skipped file and inconsistency")
+	logFormatFlag = flag.String("log-format", "terminal", "Log format: terminal, logfmt or json")
+)
+
+// maxListed is the number of skipped files, conflicts and inconsistencies that
+// are logged as warnings. The rest are logged at debug level.
+const maxListed = 20
+
+// setupLogging directs the root logger to stderr, in the configured format.
+func setupLogging() error {
+	var format log.Format
+	switch *logFormatFlag {
+	case "terminal":
+		format = log.TerminalFormat(false)
+	case "logfmt":
+		format = log.LogfmtFormat()
+	case "json":
+		format = log.JSONFormat()
+	default:
+		return fmt.Errorf("unknown log format %q (supported: terminal, logfmt, json)", *logFormatFlag)
+	}
+	level := log.LvlInfo
+	if *verboseFlag {
+		level = log.LvlDebug
+	}
+	log.Root().SetHandler(log.LvlFilterHandler(level, log.StreamHandler(os.Stderr, format)))
+	return nil
+}
+
+// listed returns the log function for the i:th item of a list, which is a
+// warning for the first maxListed items.
+func listed(i int) func(msg string, ctx ...interface{}) {
+	if i < maxListed {
+		return log.Warn
+	}
+	return log.Debug
+}
@@ -0,0 +1,56 @@
+package main
+
+import "math"
+
+// lttb downsamples the series to the given number of points, using the
+// Largest-Triangle-Three-Buckets algorithm by Sveinn Steinarsson. The first
+// and last points are always retained. Series with fewer points than the
+// threshold are returned as is.
+func lttb(xs, ys []float64, threshold int) ([]float64, []float64) {
+	n := len(xs)
+	if threshold >= n || threshold < 3 {
+		return xs, ys
+	}
+	var (
+		outX = make([]float64, 0, threshold)
+		outY = make([]float64, 0, threshold)
+		// Bucket size, excluding the first and last points
+		every = float64(n-2) / float64(threshold-2)
+		a     = 0
+	)
+	outX, outY = append(outX, xs[0]), append(outY, ys[0])
+	for i := 0; i < threshold-2; i++ {
+		// Average of the next bucket, which is the third corner of the triangle
+		avgStart := int(float64(i+1)*every) + 1
+		avgEnd := int(float64(i+2)*every) + 1
+		if avgEnd > n {
+			avgEnd = n
+		}
+		var avgX, avgY float64
+		for j := avgStart; j < avgEnd; j++ {
+			avgX += xs[j]
+			avgY += ys[j]
+		}
+		if count := float64(avgEnd - avgStart); count > 0 {
+			avgX /= count
+			avgY /= count
+		}
+		// Pick the point in the current bucket which forms the largest
+		// triangle with the previously selected point and the average
+		var (
+			start   = int(float64(i)*every) + 1
+			end     = int(float64(i+1)*every) + 1
+			maxArea = -1.0
+			next    = start
+		)
+		for j := start; j < end; j++ {
+			area := math.Abs((xs[a]-avgX)*(ys[j]-ys[a]) - (xs[a]-xs[j])*(avgY-ys[a]))
+			if area > maxArea {
+				maxArea, next = area, j
+			}
+		}
+		outX, outY = append(outX, xs[next]), append(outY, ys[next])
+		a = next
+	}
+	return append(outX, xs[n-1]), append(outY, ys[n-1])
+}
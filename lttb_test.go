@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestLTTB(t *testing.T) {
+	var xs, ys []float64
+	for i := 0; i < 100; i++ {
+		xs, ys = append(xs, float64(i)), append(ys, 0)
+	}
+	ys[50] = 100 // A spike, which must survive the downsampling
+
+	outX, outY := lttb(xs, ys, 10)
+	if len(outX) != 10 || len(outY) != 10 {
+		t.Fatalf("got %d points, want 10", len(outX))
+	}
+	if outX[0] != 0 || outX[9] != 99 {
+		t.Errorf("first and last points %v and %v, want 0 and 99", outX[0], outX[9])
+	}
+	var spike bool
+	for i := range outX {
+		if i > 0 && outX[i] <= outX[i-1] {
+			t.Errorf("points out of order at %d: %v", i, outX)
+		}
+		spike = spike || (outX[i] == 50 && outY[i] == 100)
+	}
+	if !spike {
+		t.Errorf("spike lost: %v %v", outX, outY)
+	}
+	for _, threshold := range []int{2, 100, 200} {
+		if outX, _ := lttb(xs, ys, threshold); len(outX) != len(xs) {
+			t.Errorf("threshold %d: got %d points, want all %d", threshold, len(outX), len(xs))
+		}
+	}
+}
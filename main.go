@@ -2,33 +2,65 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/wcharczuk/go-chart"
 	"github.com/wcharczuk/go-chart/drawing"
+	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
-	"syscall"
 	"time"
 )
 
 var (
-	dir = flag.String("dir", "", "Directory of files")
+	dir      = flag.String("dir", "", "Directory of files")
+	top      = flag.Int("top", 10, "Number of opcodes to list in the summary tables")
+	coverage = flag.Bool("coverage", false, "Print the covered block range and any gaps in the data")
+	run      = flag.String("run", "", "Name of the run, used in chart templates (defaults to the directory name)")
+
+	strictFlag = flag.Bool("strict", false, "Abort on any metrics file that cannot be parsed, instead of skipping it")
+	bucketFlag = flag.Int("bucket", 0, "Aggregate the series into buckets of this many blocks (0 = one point per file)")
 )
 
 type opMeter struct {
-	Num  uint64        //`json:"Count"`
-	Time time.Duration //`json:"ExecTime"`
+	Num    uint64        //`json:"Count"`
+	Time   time.Duration //`json:"ExecTime"`
+	Gas    uint64        `json:",omitempty"` // Gas spent, if measured, see dataPoint.gasUsed
+	Refund uint64        `json:",omitempty"` // Gas refunded, e.g. for cleared storage slots, if measured
+
+	// Sub breaks the executions down by regime, e.g. "warm" and "cold" storage
+	// accesses, or cache "hit" and "miss", if the client meters them apart.
+	// The sub-meters need not add up to the meter.
+	Sub map[string]opMeter `json:",omitempty"`
 }
 
-func gasCost(op vm.OpCode, blnum *big.Int) uint64 {
+// Mainnet fork blocks which change the gas costs, resolved once rather than
+// on every gasCost call.
+var (
+	eip150Block         = forkBlock(params.MainnetChainConfig.EIP150Block)
+	eip158Block         = forkBlock(params.MainnetChainConfig.EIP158Block)
+	constantinopleBlock = forkBlock(params.MainnetChainConfig.ConstantinopleBlock)
+)
+
+// forkBlock returns the activation block of a fork, or MaxUint64 if the fork
+// is not scheduled.
+func forkBlock(block *big.Int) uint64 {
+	if block == nil {
+		return math.MaxUint64
+	}
+	return block.Uint64()
+}
+
+func gasCost(op vm.OpCode, blnum uint64) uint64 {
 	switch op {
 	case vm.STOP:
 		return 0
@@ -63,13 +95,13 @@ func gasCost(op vm.OpCode, blnum *big.Int) uint64 {
 
 	var gt params.GasTable = params.GasTableHomestead
 
-	if params.MainnetChainConfig.IsEIP150(blnum) {
+	if blnum >= eip150Block {
 		gt = params.GasTableEIP150
 	}
-	if params.MainnetChainConfig.IsEIP158(blnum) {
+	if blnum >= eip158Block {
 		gt = params.GasTableEIP158
 	}
-	if params.MainnetChainConfig.IsConstantinople(blnum) {
+	if blnum >= constantinopleBlock {
 		gt = params.GasTableConstantinople
 	}
 	switch op {
@@ -84,7 +116,7 @@ func gasCost(op vm.OpCode, blnum *big.Int) uint64 {
 	case vm.EXTCODEHASH:
 		return gt.ExtcodeHash
 	case vm.SHL, vm.SHR, vm.SAR:
-		if params.MainnetChainConfig.IsConstantinople(blnum) {
+		if blnum >= constantinopleBlock {
 			return vm.GasFastestStep
 		}
 		return 0
@@ -97,18 +129,59 @@ func gasCost(op vm.OpCode, blnum *big.Int) uint64 {
 
 type dataPoint struct {
 	op          vm.OpCode
-	blockNumber *big.Int
+	blockNumber uint64
+	span        uint64 // Number of blocks covered by a delta, zero for a snapshot
 	count       uint64
 	execTime    time.Duration
+	gasUsed     uint64 // Measured gas, zero if the constant gas cost applies
+	refund      uint64 // Gas refunded, if measured, see netGas
+	netted      bool   // Whether gasUsed is the net gas, which applies even if zero, see net
+
+	sub map[string]*dataPoint // Breakdown of the executions by regime, see opMeter.Sub
 }
 
+// gas is the gas per execution. It is the average measured gas if there is
+// any, which also covers the opcodes without a constant gas cost.
 func (dp *dataPoint) gas() uint64 {
+	if (dp.gasUsed > 0 || dp.netted) && dp.count > 0 {
+		return dp.gasUsed / dp.count
+	}
 	return gasCost(dp.op, dp.blockNumber)
 }
 func (dp *dataPoint) totalGas() uint64 {
+	if dp.gasUsed > 0 || dp.netted {
+		return dp.gasUsed
+	}
 	return dp.count * dp.gas()
 }
 
+// netGas is the total gas less the refunds, which is what the executions
+// effectively cost. It is the total gas if no refunds were measured.
+func (dp *dataPoint) netGas() uint64 {
+	total := dp.totalGas()
+	if dp.refund >= total {
+		return 0
+	}
+	return total - dp.refund
+}
+
+// net returns a copy of the data point with the refunds deducted from the gas
+// used, so that all gas based metrics of it are refund-adjusted.
+func (dp *dataPoint) net() *dataPoint {
+	if dp.refund == 0 {
+		return dp
+	}
+	n := *dp
+	n.gasUsed, n.refund, n.netted = dp.netGas(), 0, true
+	if len(dp.sub) > 0 {
+		n.sub = make(map[string]*dataPoint, len(dp.sub))
+		for name, sp := range dp.sub {
+			n.sub[name] = sp.net()
+		}
+	}
+	return &n
+}
+
 func (dp *dataPoint) MilliSecondsPerMgas() float64 {
 	// gas / nanos * 1 000 M = gas / s
 	// (gas / 1000 000 ) / s = Mgas / s
@@ -120,20 +193,140 @@ func (dp *dataPoint) MilliSecondsPerMgas() float64 {
 	return float64(1000*dp.execTime) / float64(1000*dp.totalGas())
 }
 
+// MgasPerSecond is the reciprocal of MilliSecondsPerMgas, the gas throughput
+// of the opcode.
+func (dp *dataPoint) MgasPerSecond() float64 {
+	if dp.execTime == 0 {
+		return float64(0)
+	}
+	// (gas / 1M) / (nanos / 1000M) = gas * 1000 / nanos
+	return float64(1000*dp.totalGas()) / float64(dp.execTime)
+}
+
+// NanoSecondsPerExecution is the average time of one execution.
+func (dp *dataPoint) NanoSecondsPerExecution() float64 {
+	if dp.count == 0 {
+		return float64(0)
+	}
+	return float64(dp.execTime) / float64(dp.count)
+}
+
+// blocks returns the number of blocks covered by the data point. Snapshots are
+// cumulative since genesis.
+func (dp *dataPoint) blocks() uint64 {
+	if dp.span == 0 {
+		return dp.blockNumber
+	}
+	return dp.span
+}
+
+// ExecutionsPerBlock is the average number of executions per block.
+func (dp *dataPoint) ExecutionsPerBlock() float64 {
+	if dp.blocks() == 0 {
+		return float64(0)
+	}
+	return float64(dp.count) / float64(dp.blocks())
+}
+
 func (dp *dataPoint) Sub(prev *dataPoint) *dataPoint {
 	if prev == nil {
 		return dp
 	}
-	return &dataPoint{
+	delta := &dataPoint{
 		blockNumber: dp.blockNumber,
+		span:        dp.blockNumber - prev.blockNumber,
 		execTime:    dp.execTime - prev.execTime,
 		count:       dp.count - prev.count,
+		gasUsed:     dp.gasUsed - prev.gasUsed,
+		refund:      dp.refund - prev.refund,
 		op:          dp.op,
 	}
+	if len(dp.sub) > 0 {
+		delta.sub = make(map[string]*dataPoint, len(dp.sub))
+		for name, sp := range dp.sub {
+			delta.sub[name] = sp.Sub(prev.subPoint(name))
+		}
+	}
+	return delta
+}
+
+// subPoint returns the sub-meter of the given regime, or a zero data point if
+// there is none.
+func (dp *dataPoint) subPoint(name string) *dataPoint {
+	if sp, ok := dp.sub[name]; ok {
+		return sp
+	}
+	return &dataPoint{op: dp.op, blockNumber: dp.blockNumber}
 }
 
+// add adds the counters of other to dp, including its sub-meters.
+func (dp *dataPoint) add(other *dataPoint) {
+	dp.count += other.count
+	dp.execTime += other.execTime
+	dp.gasUsed += other.gasUsed
+	dp.refund += other.refund
+	for name, sp := range other.sub {
+		own := dp.sub[name]
+		if own == nil {
+			if dp.sub == nil {
+				dp.sub = make(map[string]*dataPoint)
+			}
+			own = &dataPoint{op: dp.op, blockNumber: dp.blockNumber}
+			dp.sub[name] = own
+		}
+		own.add(sp)
+	}
+}
+
+// meterPoint converts a meter, and its sub-meters, into a data point.
+func meterPoint(op vm.OpCode, blnum int, m opMeter) *dataPoint {
+	dp := &dataPoint{
+		op:          op,
+		blockNumber: uint64(blnum),
+		count:       m.Num,
+		execTime:    m.Time,
+		gasUsed:     m.Gas,
+		refund:      m.Refund,
+	}
+	for name, sm := range m.Sub {
+		if dp.sub == nil {
+			dp.sub = make(map[string]*dataPoint, len(m.Sub))
+		}
+		dp.sub[name] = meterPoint(op, blnum, sm)
+	}
+	return dp
+}
+
+// meter converts the data point back into a meter, see meterPoint.
+func (dp *dataPoint) meter() opMeter {
+	m := opMeter{Num: dp.count, Time: dp.execTime, Gas: dp.gasUsed, Refund: dp.refund}
+	for name, sp := range dp.sub {
+		if m.Sub == nil {
+			m.Sub = make(map[string]opMeter, len(dp.sub))
+		}
+		m.Sub[name] = sp.meter()
+	}
+	return m
+}
+
+// statCollection holds the snapshots of the meters, by block number. Once it is
+// loaded, it may be read concurrently, but it must not be modified while being
+// read. See liveCollection for adding snapshots while rendering.
 type statCollection struct {
-	data map[int](map[vm.OpCode]*dataPoint)
+	data    map[int](map[vm.OpCode]*dataPoint)
+	index   []int                // Sorted block numbers of the snapshots in data
+	bucket  int                  // If non-zero, series are aggregated into buckets of this many blocks
+	weight  string               // Weighting of the intervals in a bucket, see weighted
+	skipped []skippedFile        // Input files which were not loaded
+	resets  map[int]bool         // Snapshots taken after a counter reset, see fixResets
+	txs     map[int][]txStat     // Transactions of the interval ending at each snapshot, with --per-tx
+	runtime map[int]runtimeStats // Runtime metrics of the node at each snapshot, if dumped
+}
+
+// skippedFile is an input file which was not loaded, and why.
+type skippedFile struct {
+	name   string
+	reason string
 }
 
 func newStatCollection() statCollection {
@@ -141,70 +334,134 @@ func newStatCollection() statCollection {
 		data: make(map[int](map[vm.OpCode]*dataPoint)),
 	}
 }
-func (stats *statCollection) collect(blnum int, data []byte) error {
+func (stats *statCollection) collect(blnum int, f *parsedFile) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.block != 0 && f.block != blnum {
+		return fmt.Errorf("metrics are for block %d, expected %d", f.block, blnum)
+	}
+	stats.collectMeters(blnum, f.meters)
+	if f.txs != nil {
+		stats.collectTxs(blnum, f.txs)
+	}
+	if f.runtime != nil {
+		stats.collectRuntime(blnum, *f.runtime)
+	}
+	return nil
+}
 
-	var m [256]opMeter
-	if err := json.Unmarshal(data, &m); err != nil {
-		fmt.Printf("error: %v", err)
-		return err
+// collectMeters adds the snapshot of the meters at the given block.
+func (stats *statCollection) collectMeters(blnum int, m [256]opMeter) {
+	if _, exists := stats.data[blnum]; !exists {
+		// Snapshots mostly arrive in order, so this is usually an append
+		i := sort.SearchInts(stats.index, blnum)
+		stats.index = append(stats.index, 0)
+		copy(stats.index[i+1:], stats.index[i:])
+		stats.index[i] = blnum
 	}
-	//fmt.Printf("OPCODE;GASCOST;COUNT;TOTALTIME;TOTALTIME;TOTALGAS;MGASPERNS\n")
 	stats.data[blnum] = make(map[vm.OpCode]*dataPoint)
 	for i := 0; i < 256; i++ {
 		metric := m[i]
-		op := vm.OpCode(i)
-		dp := &dataPoint{
-			op:          op,
-			blockNumber: new(big.Int).SetUint64(uint64(blnum)),
-			count:       metric.Num,
-			execTime:    metric.Time,
+		if metric.Num == 0 && metric.Time == 0 && metric.Gas == 0 {
+			continue // Not executed so far, see point
 		}
-		stats.data[blnum][op] = dp
+		op := vm.OpCode(i)
+		stats.data[blnum][op] = meterPoint(op, blnum, metric)
 	}
-	return nil
+}
+
+// point returns the data point of op at the given block. Opcodes are only
+// stored once they have been executed, a zero data point is returned before.
+func (stats *statCollection) point(number int, op vm.OpCode) *dataPoint {
+	if dp, ok := stats.data[number][op]; ok {
+		return dp
+	}
+	return &dataPoint{op: op, blockNumber: uint64(number)}
 }
 
 func (stats *statCollection) series(op vm.OpCode, fromBlock int, yFunc func(point *dataPoint) float64) ([]float64, []float64) {
+	return stats.seriesOf(op, fromBlock, func(dp *dataPoint) *dataPoint { return dp }, yFunc)
+}
 
+// subNames returns the sorted regimes of the sub-meters of op, in any snapshot.
+func (stats *statCollection) subNames(op vm.OpCode) []string {
+	seen := make(map[string]bool)
+	for _, number := range stats.numbers() {
+		if dp := stats.data[number][op]; dp != nil {
+			for name := range dp.sub {
+				seen[name] = true
+			}
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seriesOf returns the values of the intervals between the snapshots, of the
+// data points of op picked by pick.
+func (stats *statCollection) seriesOf(op vm.OpCode, fromBlock int, pick func(dp *dataPoint) *dataPoint, yFunc func(point *dataPoint) float64) ([]float64, []float64) {
 	var (
 		xseries []float64
 		yseries []float64
 	)
-	var numbers []int
-	for k := range stats.data {
-		numbers = append(numbers, k)
+	numbers := stats.numbers()
+	if stats.bucket > 0 {
+		numbers = bucketed(numbers, stats.bucket)
 	}
-	sort.Ints(numbers)
+	numbers = numbers[sort.SearchInts(numbers, fromBlock):]
 
-	var prevBlock map[vm.OpCode]*dataPoint
+	var (
+		prevBlock  map[vm.OpCode]*dataPoint
+		prevNumber int
+		weighted   = stats.bucket > 0 && stats.weight != "" && stats.weight != weightPooled
+	)
 	for _, number := range numbers {
-		if number < fromBlock {
-			continue
-		}
 		block := stats.data[number]
-		if prevBlock != nil {
-			dp := block[op]
-			prevDp := prevBlock[op]
-			modDp := dp.Sub(prevDp)
+		if dp := block[op]; dp != nil && prevBlock != nil && !stats.resets[number] {
+			var prev *dataPoint
+			if dp := prevBlock[op]; dp != nil {
+				prev = pick(dp)
+			}
+			modDp := pick(dp).Sub(prev)
 			// Only count it if it's been done more than 1000 times
 			if modDp.count > 500 {
-				yseries = append(yseries, yFunc(modDp))
+				y := yFunc(modDp)
+				if weighted {
+					y, _ = stats.weighted(op, prevNumber, number, stats.weight, pick, yFunc)
+				}
+				yseries = append(yseries, y)
 				xseries = append(xseries, float64(number))
 
 			}
 		}
-		prevBlock = block
+		prevBlock, prevNumber = block, number
 	}
 	return xseries, yseries
 }
 
-func (stats *statCollection) numbers() []int {
-	var numbers []int
-	for k := range stats.data {
-		numbers = append(numbers, k)
+// bucketed returns the last snapshot number of every bucket of the given size.
+// Since the counters are cumulative, the deltas between those snapshots are the
+// sums over the buckets. A snapshot at block n covers the blocks up to and
+// including n, so it belongs in bucket (n-1)/size.
+func bucketed(numbers []int, size int) []int {
+	var result []int
+	for i, number := range numbers {
+		if i == len(numbers)-1 || (number-1)/size != (numbers[i+1]-1)/size {
+			result = append(result, number)
+		}
 	}
-	sort.Ints(numbers)
-	return numbers
+	return result
+}
+
+// numbers returns the sorted block numbers of all snapshots. The slice is
+// shared, and must not be modified.
+func (stats *statCollection) numbers() []int {
+	return stats.index
 }
 
 // Construct a filter, which returns true if the any value in the given series is above the threshold
@@ -222,12 +479,96 @@ func minFilter(threshold float64) func([]float64) bool {
 
 type filterFn func(vals []float64) bool
 
+// plotOpts contains the optional parameters of a line chart.
+type plotOpts struct {
+	filter     filterFn    // Only plot series for which the filter returns true
+	fromBlock  int         // First block to plot
+	yMin       *float64    // Lower bound of the Y axis, derived from the data if nil
+	yMax       *float64    // Upper bound of the Y axis, derived from the data if nil
+	gasSteps   bool        // Overlay the gas cost on the secondary Y axis, instead of the count
+	reprices   bool        // Mark the blocks where the gas cost of the ops changed
+	overlay    string      // System metric to overlay on the secondary Y axis, instead of the count
+	split      bool        // Plot the sub-meters of the ops as separate series, see opMeter.Sub
+	smooth     string      // Smoothing of the series, see smoothKind
+	window     int         // Window of the smoothing, 0 for the default
+	band       float64     // Standard deviations of the band around a single moving average, 0 for none
+	aggregates []aggregate // Aggregates of the intervals to plot, the mean if empty
+	params     interface{} // Parameters recorded in the sidecar, see writeSidecar
+	layout     chartLayout
+}
+
 func plot(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint) float64, title, x, y, filename string) (string, error) {
-	return plotFilter(ops, stat, yFunc, title, x, y, filename, nil, 0)
+	return plotWith(ops, stat, yFunc, title, x, y, filename, plotOpts{layout: layout})
+}
+
+func plotWith(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint) float64, title, x, y, filename string, opts plotOpts) (string, error) {
+	graph, err := lineChart(ops, stat, yFunc, title, x, y, opts)
+	if err != nil {
+		return "", err
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("./charts/%s", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return path, err
+	}
+	return path, writeSidecar(path, lineSidecar(graph, opts.params))
+}
+
+// opLines returns the names and values of the lines plotted for op: one per
+// aggregate of the intervals, of the op or, with split, of every regime.
+// Averaging the regimes of an op together hides their difference.
+func opLines(stat statCollection, op vm.OpCode, yFunc func(dp *dataPoint) float64, opts plotOpts) ([]string, [][]float64, [][]float64) {
+	var (
+		regimes = []string{""}
+		names   []string
+		xseries [][]float64
+		yseries [][]float64
+	)
+	if subs := stat.subNames(op); opts.split && len(subs) > 0 {
+		regimes = subs
+	}
+	aggs := opts.aggregates
+	if len(aggs) == 0 {
+		aggs = []aggregate{meanAggregate}
+	}
+	for _, regime := range regimes {
+		name, pick := opName(op), func(dp *dataPoint) *dataPoint { return dp }
+		if regime != "" {
+			regime := regime
+			name = fmt.Sprintf("%v (%v)", opName(op), regime)
+			pick = func(dp *dataPoint) *dataPoint { return dp.subPoint(regime) }
+		}
+		for _, agg := range aggs {
+			if agg == meanAggregate {
+				xvals, yvals := stat.seriesOf(op, opts.fromBlock, pick, yFunc)
+				names, xseries, yseries = append(names, name), append(xseries, xvals), append(yseries, yvals)
+				continue
+			}
+			xvals, yvals := stat.quantileSeriesOf(op, opts.fromBlock, agg.q, pick, yFunc)
+			if len(xvals) == 0 {
+				log.Warn("No interval has enough samples for a quantile", "line", name, "aggregate", agg.name, "min", minSamples)
+			}
+			names = append(names, fmt.Sprintf("%v %v", name, agg.name))
+			xseries, yseries = append(xseries, xvals), append(yseries, yvals)
+		}
+	}
+	return names, xseries, yseries
 }
-func plotFilter(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint) float64, title, x, y, filename string, filter filterFn, fromBlock int) (string, error) {
+
+// lineChart creates a line chart of the given ops over block numbers.
+func lineChart(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint) float64, title, x, y string, opts plotOpts) (chart.Chart, error) {
+	var (
+		filter    = opts.filter
+		fromBlock = opts.fromBlock
+		yMin      = math.Inf(1)
+		yMax      = math.Inf(-1)
+	)
 	showCount := len(ops) == 1
 	annotations := chart.AnnotationSeries{
+		Style: overlay,
 		Annotations: []chart.Value2{
 			{XValue: 1920000.0, YValue: 0, Label: "DaoFork"},
 			{XValue: 2463000.0, YValue: 0, Label: "EIP150/TW"},
@@ -238,57 +579,121 @@ func plotFilter(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint)
 
 	var series []chart.Series
 	for _, op := range ops {
-		xvals, yvals := stat.series(op, fromBlock, yFunc)
-
-		if filter == nil || filter(yvals) {
+		names, xseries, yseries := opLines(stat, op, yFunc, opts)
+		var (
+			plotted bool
+			single  = showCount && len(names) == 1
+			smooth  = smoothKind(opts.smooth, single)
+		)
+		for i, name := range names {
+			xvals, yvals := xseries[i], yseries[i]
+			if filter != nil && !filter(yvals) {
+				continue
+			}
+			plotted = true
+			for _, v := range yvals {
+				yMin = math.Min(yMin, v)
+				yMax = math.Max(yMax, v)
+			}
+			if opts.layout.MaxPoints > 0 {
+				xvals, yvals = lttb(xvals, yvals, opts.layout.MaxPoints)
+			}
 			serie := chart.ContinuousSeries{
 				XValues: xvals,
 				YValues: yvals,
-				Name:    op.String(),
+				Name:    name,
+			}
+			// The average of a lone series stands out in the foreground color,
+			// those of several series take the color of their series
+			style := chart.Style{Show: true, StrokeColor: foreground}
+			if !single && smooth != smoothNone {
+				serie.Style = chart.Style{Show: true, StrokeColor: seriesColor(len(series))}
+				style = serie.Style
+				style.StrokeWidth = 2
 			}
 			series = append(series, serie)
-			if showCount {
-				// Show simple moving average
-				smaSerie := chart.SMASeries{
-					InnerSeries: serie,
-					Style: chart.Style{
-						Show:        true,
-						StrokeColor: drawing.ColorBlack,
-					},
-					Name: fmt.Sprintf("Moving AVG %v", serie.Name),
+			if avg := smoothed(smooth, opts.window, serie, style); avg != nil {
+				// The band goes below the average, which stays readable
+				if single && opts.band > 0 {
+					series = append(series, deviationBand(opts.band, opts.window, serie, style.StrokeColor))
 				}
-				series = append(series, smaSerie)
+				series = append(series, avg)
 			}
-			if showCount {
-				secondaryYSeries, yvals := stat.series(op, fromBlock, func(dp *dataPoint) float64 {
-					return float64(dp.count)
-				})
-				countSerie := chart.ContinuousSeries{
-					XValues: secondaryYSeries,
-					YValues: yvals,
-					YAxis:   chart.YAxisSecondary,
-					Style: chart.Style{
-						StrokeColor: drawing.ColorRed,
-						Show:        true,
-					},
-					Name: "Count",
-				}
-				series = append(series, countSerie)
+		}
+		if plotted && showCount && !opts.gasSteps && opts.overlay == "" {
+			secondaryYSeries, yvals := stat.series(op, fromBlock, func(dp *dataPoint) float64 {
+				return float64(dp.count)
+			})
+			if opts.layout.MaxPoints > 0 {
+				secondaryYSeries, yvals = lttb(secondaryYSeries, yvals, opts.layout.MaxPoints)
 			}
+			countSerie := chart.ContinuousSeries{
+				XValues: secondaryYSeries,
+				YValues: yvals,
+				YAxis:   chart.YAxisSecondary,
+				Style: chart.Style{
+					StrokeColor: drawing.ColorRed,
+					Show:        true,
+				},
+				Name: "Count",
+			}
+			series = append(series, countSerie)
 		}
 
 	}
+	if opts.layout.LegendSort && !showCount {
+		final := func(s chart.Series) float64 {
+			if cs, ok := s.(chart.ContinuousSeries); ok && len(cs.YValues) > 0 {
+				return cs.YValues[len(cs.YValues)-1]
+			}
+			return 0
+		}
+		sort.SliceStable(series, func(i, j int) bool {
+			return final(series[i]) > final(series[j])
+		})
+	}
+	series = splitGaps(series, stat.gaps(*maxIntervalFlag))
+	if numbers := stat.numbers(); opts.reprices && len(numbers) > 0 && yMin <= yMax {
+		low, high := yMin, yMax
+		if opts.yMin != nil {
+			low = *opts.yMin
+		}
+		if opts.yMax != nil {
+			high = *opts.yMax
+		}
+		markers, labels := repricings(ops, fromBlock, numbers[len(numbers)-1], low, high)
+		series = append(series, markers...)
+		annotations.Annotations = append(annotations.Annotations, labels...)
+	}
+	if opts.gasSteps {
+		steps, err := gasStepSeries(ops, stat, fromBlock, chart.YAxisSecondary)
+		if err != nil {
+			return chart.Chart{}, err
+		}
+		series = append(series, steps...)
+	}
+	if opts.overlay != "" {
+		sys, err := overlaySeries(opts.overlay, stat, fromBlock, opts.layout.MaxPoints)
+		if err != nil {
+			return chart.Chart{}, err
+		}
+		series = append(series, sys)
+	}
 	series = append(series, annotations)
 
+	width, height := opts.layout.size(0, 0)
 	graph := chart.Chart{
-		Title:      fmt.Sprintf(title),
-		TitleStyle: chart.StyleShow(),
-
-		XAxis: chart.XAxis{
-			Name:      x,
-			NameStyle: chart.StyleShow(),
-			Style:     chart.StyleShow(),
+		Title:        fmt.Sprintf(title),
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          opts.layout.DPI,
+		ColorPalette: colors,
+		Background: chart.Style{
+			Padding: opts.layout.padding(chart.Box{}),
 		},
+
+		XAxis: blockAxis(x),
 		YAxis: chart.YAxis{
 			Name:      y,
 			NameStyle: chart.StyleShow(),
@@ -297,7 +702,30 @@ func plotFilter(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint)
 
 		Series: series,
 	}
-	if showCount {
+	if opts.yMin != nil || opts.yMax != nil {
+		if opts.yMin != nil {
+			yMin = *opts.yMin
+		}
+		if opts.yMax != nil {
+			yMax = *opts.yMax
+		}
+		if yMin < yMax {
+			graph.YAxis.Range = &chart.ContinuousRange{Min: yMin, Max: yMax}
+		}
+	}
+	if opts.gasSteps {
+		graph.YAxisSecondary = chart.YAxis{
+			Name:      "Gas",
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		}
+	} else if opts.overlay != "" {
+		graph.YAxisSecondary = chart.YAxis{
+			Name:      opts.overlay,
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		}
+	} else if showCount {
 		graph.YAxisSecondary = chart.YAxis{
 			Name:      "Count",
 			NameStyle: chart.StyleShow(),
@@ -305,165 +733,77 @@ func plotFilter(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint)
 		}
 	}
 
-	graph.Elements = []chart.Renderable{
-		chart.LegendLeft(&graph),
+	toGasAxis(&graph)
+	if numbers := stat.numbers(); len(numbers) > 0 {
+		if i := sort.SearchInts(numbers, fromBlock); i < len(numbers) {
+			addDateAxis(&graph, float64(numbers[i]), float64(numbers[len(numbers)-1]))
+		}
 	}
-	buffer := bytes.NewBuffer([]byte{})
-	if err := graph.Render(chart.PNG, buffer); err != nil {
-		return "", err
+	legend, err := opts.layout.legend(&graph)
+	if err != nil {
+		return graph, err
 	}
-	path := fmt.Sprintf("./charts/%s", filename)
-	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
-		return path, err
+	graph.Elements = append(graph.Elements, legend...)
+	return graph, nil
+}
+
+// plotSplit plots the given ops, splitting them over several charts if there are
+// more than opts.layout.MaxSeries of them. All parts share the same Y range, so
+// they can be compared side by side.
+func plotSplit(ops []vm.OpCode, stat statCollection, yFunc func(dp *dataPoint) float64, title, x, y, filename string, opts plotOpts) ([]string, error) {
+	limit := opts.layout.MaxSeries
+	if limit <= 0 || len(ops) <= limit {
+		path, err := plotWith(ops, stat, yFunc, title, x, y, filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
 	}
-	return path, nil
-}
-
-var RANGE0 = []vm.OpCode{
-	vm.ADD,
-	vm.MUL,
-	vm.SUB,
-	vm.DIV,
-	vm.SDIV,
-	vm.MOD,
-	vm.SMOD,
-	vm.ADDMOD,
-	vm.MULMOD,
-	vm.EXP,
-	vm.SIGNEXTEND,
-}
-var RANGE1 = []vm.OpCode{
-	vm.LT,
-	vm.GT,
-	vm.SLT,
-	vm.SGT,
-	vm.EQ,
-	vm.ISZERO,
-	vm.AND,
-	vm.OR,
-	vm.XOR,
-	vm.NOT,
-	vm.BYTE,
-	//vm.SHL,
-	//vm.SHR,
-	//vm.SAR,
-}
-var RANGE2 = []vm.OpCode{
-	vm.SHA3,
-}
-var RANGE3p1 = []vm.OpCode{
-	vm.ADDRESS,
-	vm.BALANCE,
-	vm.ORIGIN,
-	vm.CALLER,
-	vm.CALLVALUE,
-	vm.CALLDATASIZE,
-}
-
-var RANGE3p2 = []vm.OpCode{
-	vm.CODESIZE,
-	vm.GASPRICE,
-	vm.EXTCODESIZE,
-	vm.RETURNDATASIZE,
-	vm.EXTCODEHASH,
-	//vm.CALLDATALOAD,
-	//vm.CALLDATACOPY,
-	//vm.CODECOPY,
-	//vm.EXTCODECOPY,
-	//vm.RETURNDATACOPY,
-}
-var RANGE4 = []vm.OpCode{
-	//vm.BLOCKHASH,
-	vm.COINBASE,
-	vm.TIMESTAMP,
-	vm.NUMBER,
-	vm.DIFFICULTY,
-	vm.GASLIMIT,
-}
-var RANGE4p2 = []vm.OpCode{
-	vm.BLOCKHASH,
-}
-var RANGE5p1 = []vm.OpCode{
-	vm.POP,
-	vm.MLOAD,
-	vm.SLOAD,
-	vm.PC,
-	vm.MSIZE,
-	vm.GAS,
-}
-var RANGE6 = []vm.OpCode{
-	vm.PUSH1,
-	vm.PUSH2,
-	vm.PUSH3,
-	vm.PUSH4,
-	vm.PUSH5,
-	vm.PUSH6,
-	vm.PUSH7,
-	vm.PUSH8,
-	vm.PUSH9,
-	vm.PUSH10,
-	vm.PUSH11,
-	vm.PUSH12,
-	vm.PUSH13,
-	vm.PUSH14,
-	vm.PUSH15,
-	vm.PUSH16,
-	vm.PUSH17,
-	vm.PUSH18,
-	vm.PUSH19,
-	vm.PUSH20,
-	vm.PUSH21,
-	vm.PUSH22,
-	vm.PUSH23,
-	vm.PUSH24,
-	vm.PUSH25,
-	vm.PUSH26,
-	vm.PUSH27,
-	vm.PUSH28,
-	vm.PUSH29,
-	vm.PUSH30,
-	vm.PUSH31,
-	vm.PUSH32,
-	vm.DUP1,
-	vm.DUP2,
-	vm.DUP3,
-	vm.DUP4,
-	vm.DUP5,
-	vm.DUP6,
-	vm.DUP7,
-	vm.DUP8,
-	vm.DUP9,
-	vm.DUP10,
-	vm.DUP11,
-	vm.DUP12,
-	vm.DUP13,
-	vm.DUP14,
-	vm.DUP15,
-	vm.DUP16,
-	vm.SWAP1,
-	vm.SWAP2,
-	vm.SWAP3,
-	vm.SWAP4,
-	vm.SWAP5,
-	vm.SWAP6,
-	vm.SWAP7,
-	vm.SWAP8,
-	vm.SWAP9,
-	vm.SWAP10,
-	vm.SWAP11,
-	vm.SWAP12,
-	vm.SWAP13,
-	vm.SWAP14,
-	vm.SWAP15,
-	vm.SWAP16,
-}
-
-var RANGE7 = []vm.OpCode{
-	vm.LOG0,
-	vm.LOG1,
-	vm.LOG2,
-	vm.LOG3,
-	vm.LOG4,
+	var (
+		included []vm.OpCode
+		yMin     = math.Inf(1)
+		yMax     = math.Inf(-1)
+	)
+	for _, op := range ops {
+		_, yvals := stat.series(op, opts.fromBlock, yFunc)
+		if opts.filter != nil && !opts.filter(yvals) {
+			continue
+		}
+		included = append(included, op)
+		for _, v := range yvals {
+			yMin = math.Min(yMin, v)
+			yMax = math.Max(yMax, v)
+		}
+	}
+	if opts.yMin == nil && !math.IsInf(yMin, 1) {
+		opts.yMin = &yMin
+	}
+	if opts.yMax == nil && !math.IsInf(yMax, -1) {
+		opts.yMax = &yMax
+	}
+	// The filter has already been applied
+	opts.filter = nil
+
+	var (
+		paths []string
+		parts = (len(included) + limit - 1) / limit
+		ext   = filepath.Ext(filename)
+		base  = strings.TrimSuffix(filename, ext)
+	)
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * limit
+		if end > len(included) {
+			end = len(included)
+		}
+		path, err := plotWith(included[i*limit:end], stat, yFunc,
+			fmt.Sprintf("%v (%d/%d)", title, i+1, parts), x, y,
+			fmt.Sprintf("%v-%d%v", base, i+1, ext), opts)
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
 }
 
 var allOps []vm.OpCode
@@ -475,17 +815,24 @@ func init() {
 }
 
 func pie(filename string, stat statCollection, start, end int) error {
+	width, height := layout.size(600, 800)
 	timeGraph := chart.PieChart{
-		Width:      600,
-		Height:     800,
-		Title:      fmt.Sprintf("Blocks %d to %d - Time spent", start, end),
-		TitleStyle: chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		Background:   chart.Style{Padding: layout.padding(chart.Box{})},
+		Title:        fmt.Sprintf("Blocks %d to %d - Time spent", start, end),
+		TitleStyle:   chart.StyleShow(),
 	}
 	countGraph := chart.PieChart{
-		Width:      600,
-		Height:     800,
-		Title:      fmt.Sprintf("Blocks %d to %d - Total count", start, end),
-		TitleStyle: chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		Background:   chart.Style{Padding: layout.padding(chart.Box{})},
+		Title:        fmt.Sprintf("Blocks %d to %d - Total count", start, end),
+		TitleStyle:   chart.StyleShow(),
 	}
 	// Get the aggregate from blocks 0 to end
 	//blnums := stat.numbers()
@@ -498,346 +845,633 @@ func pie(filename string, stat statCollection, start, end int) error {
 	var countValues []chart.Value
 	var zero = &dataPoint{}
 	for op := vm.OpCode(0); op < 255; op++ {
+		if excludedOps[op] {
+			continue
+		}
 		dpStart := firstStat[op]
 
 		if dpStart == nil {
 			dpStart = zero
 		}
 		dpEnd := lastStat[op]
-		if dpEnd.count > 0 {
+		if dpEnd != nil && dpEnd.count > 0 {
 			timeValues = append(timeValues, chart.Value{
 				Value: float64(dpEnd.execTime) - float64(dpStart.execTime),
-				Label: op.String(),
+				Label: opName(op),
 			})
 			countValues = append(countValues, chart.Value{
 				Value: float64(dpEnd.count) - float64(dpStart.count),
-				Label: op.String(),
+				Label: opName(op),
 			})
 		}
 	}
-	timeGraph.Values = timeValues
-	countGraph.Values = countValues
+	timeGraph.Values = consolidate(timeValues, *otherFlag)
+	countGraph.Values = consolidate(countValues, *otherFlag)
 
 	buffer := bytes.NewBuffer([]byte{})
 	if err := timeGraph.Render(chart.PNG, buffer); err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(fmt.Sprintf("./charts/%s-time.png", filename), buffer.Bytes(), 0644); err != nil {
+	params := map[string]interface{}{"from": start, "to": end, "other": *otherFlag}
+	path := fmt.Sprintf("./charts/%s-time.png", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := writeSidecar(path, valuesSidecar(timeGraph.Title, "Time", timeGraph.Values, params)); err != nil {
 		return err
 	}
 	buffer = bytes.NewBuffer([]byte{})
 	if err := countGraph.Render(chart.PNG, buffer); err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(fmt.Sprintf("./charts/%s-count.png", filename), buffer.Bytes(), 0644); err != nil {
+	path = fmt.Sprintf("./charts/%s-count.png", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
 		return err
 	}
-
-	return nil
+	return writeSidecar(path, valuesSidecar(countGraph.Title, "Count", countGraph.Values, params))
 
 }
 
-func barchart(filename, runinfo string, stat statCollection, start, end int) (string, error) {
+// barchart renders the ms/Mgas of the top opcodes from start to end. It returns
+// the opcodes which were left out for being executed less than --min-per-block
+// times per block.
+func barchart(filename string, run runMeta, stat statCollection, start, end int) (string, []*dataPoint, error) {
+	width, height := layout.size(1000, 0)
 	g := chart.BarChart{
-		Width: 1000,
-		//Title:      fmt.Sprintf("Blocks %d to %d - Time per gas (Top 25)\n %v (excluding < 1 exec per block)", start, end, runinfo),
-		TitleStyle: chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		TitleStyle:   chart.StyleShow(),
 		XAxis: chart.Style{
 			Show:                true,
 			TextRotationDegrees: 90.0,
 		},
 		Background: chart.Style{
-			Padding: chart.Box{
+			Padding: layout.padding(chart.Box{
 				Top:    40,
 				Bottom: 80,
-			},
+			}),
 		},
-		BarWidth: 20,
+		BarWidth: layout.barWidth(20),
 		YAxis: chart.YAxis{
 			Style: chart.StyleShow(),
 		},
 	}
 
 	lastStat := stat.data[end]
-	firstStat := stat.data[start]
-	var vals []chart.Value
-
-	var zero = &dataPoint{
-		blockNumber:new(big.Int),
-
+	type bar struct {
+		chart.Value
+		spread *spread
 	}
-	fmt.Printf("--------\n")
-	for op := vm.OpCode(0); op < 255; op++ {
-		dpStart := firstStat[op]
+	var (
+		bars []bar
+		rare []*dataPoint
+	)
 
-		if dpStart == nil {
-			dpStart = zero
+	for op := vm.OpCode(0); op < 255; op++ {
+		if excludedOps[op] {
+			continue
 		}
+		dpStart := stat.point(start, op)
 		dpEnd := lastStat[op]
 		if dpEnd == nil {
-			return "", fmt.Errorf("data missing for %d", end)
-		}
-		if dpEnd.blockNumber == nil || dpStart.blockNumber == nil {
 			continue
 		}
-		// exclude those that are executed less than once per
-		nBlocks := dpEnd.blockNumber.Uint64() - dpStart.blockNumber.Uint64()
+		// exclude those that are executed less than --min-per-block times per block
+		nBlocks := dpEnd.blockNumber - dpStart.blockNumber
 		nExecs := dpEnd.count - dpStart.count
 		//fmt.Printf("nBlocks %d, nExecs %d\n", nBlocks, nExecs)
-		if nBlocks > nExecs {
+		if float64(nExecs) < *minPerBlockFlag*float64(nBlocks) {
+			if nExecs > 0 {
+				rare = append(rare, dpEnd.Sub(dpStart))
+			}
 			continue
 		}
 		if dpEnd.count > 0 {
 			modDp := dpEnd.Sub(dpStart)
 
-			vals = append(vals, chart.Value{
+			b := bar{Value: chart.Value{
 				Value: modDp.MilliSecondsPerMgas(),
-				Label: fmt.Sprintf("%v (%d)", op.String(), gasCost(op, modDp.blockNumber)),
-			})
+				Label: fmt.Sprintf("%v (%d)", opName(op), gasCost(op, modDp.blockNumber)),
+			}}
+			if *weightFlag != weightPooled {
+				b.Value.Value, _ = stat.weighted(op, start, end, *weightFlag, func(dp *dataPoint) *dataPoint { return dp }, metrics["timepergas"])
+			}
+			if *errorBarsFlag != "" {
+				if s, ok := intervalSpread(stat, op, start, end, b.Value.Value, *errorBarsFlag); ok {
+					b.spread = &s
+				}
+			}
+			bars = append(bars, b)
 		}
 	}
-	sort.Slice(vals, func(i, j int) bool {
-		return vals[i].Value > vals[j].Value
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Value.Value > bars[j].Value.Value
 	})
 	// Only use the top 25
-	if len(vals) > 25 {
-		vals = vals[:25]
+	if len(bars) > 25 {
+		bars = bars[:25]
+	}
+	g.Title = fmt.Sprintf("Blocks %d to %d - Time per gas%v (Top %d)\n %v", start, end, weightLabel(*weightFlag), len(bars), run)
+	if *minPerBlockFlag > 0 {
+		g.Title += fmt.Sprintf(" (excluding < %v exec per block)", *minPerBlockFlag)
 	}
-	g.Title = fmt.Sprintf("Blocks %d to %d - Time per gas (Top %d)\n %v (excluding < 1 exec per block)", start, end, len(vals), runinfo)
 
-	g.Bars = vals
+	var (
+		spreads []*spread
+		top     float64
+	)
+	for _, b := range bars {
+		g.Bars = append(g.Bars, b.Value)
+		spreads = append(spreads, b.spread)
+		top = math.Max(top, b.Value.Value)
+		if b.spread != nil {
+			top = math.Max(top, b.spread.high)
+		}
+	}
+	if *errorBarsFlag != "" && top > 0 {
+		// Pin the Y axis, so that the error bars can be placed on it
+		g.YAxis.Range = &chart.ContinuousRange{Min: 0, Max: top * 1.05}
+		g.Elements = append(g.Elements, errorBars(g, spreads, top*1.05))
+		g.Title += fmt.Sprintf(", %v error bars", *errorBarsFlag)
+	}
 
 	buffer := bytes.NewBuffer([]byte{})
 	if err := g.Render(chart.PNG, buffer); err != nil {
-		return "", err
+		return "", nil, err
 	}
 	path := fmt.Sprintf("./charts/%s.png", filename)
 	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
-		return "", err
+		return "", nil, err
 	}
-
-	return path, nil
+	sc := valuesSidecar(g.Title, "ms/Mgas", g.Bars, map[string]interface{}{
+		"from": start, "to": end, "minPerBlock": *minPerBlockFlag, "errorBars": *errorBarsFlag, "weight": *weightFlag,
+	})
+	if *errorBarsFlag != "" {
+		low, high := sidecarSeries{Name: "Error low"}, sidecarSeries{Name: "Error high"}
+		for i, s := range spreads {
+			low.Labels, high.Labels = append(low.Labels, g.Bars[i].Label), append(high.Labels, g.Bars[i].Label)
+			if s == nil {
+				low.Y, high.Y = append(low.Y, jsonFloat(math.NaN())), append(high.Y, jsonFloat(math.NaN()))
+				continue
+			}
+			low.Y, high.Y = append(low.Y, jsonFloat(s.low)), append(high.Y, jsonFloat(s.high))
+		}
+		sc.Series = append(sc.Series, low, high)
+	}
+	return path, rare, writeSidecar(path, sc)
 
 }
 
 func main() {
-	barcharts("./m5d.2xlarge.run3", "run3")
-	barcharts("./m5d.2xlarge.run2", "run2")
-	barcharts("./m5d.2xlarge", "run1")
-
-}
-
-func barcharts(dir, info string) {
-	files, _ := ioutil.ReadDir(dir)
-
-	stat := newStatCollection()
-	for _, fStat := range files {
-		if fStat.IsDir() {
-			continue
+	if len(os.Args) > 1 && os.Args[1] == "gastable" {
+		if err := gastableCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
 		}
-		if !strings.HasPrefix(fStat.Name(), "metrics_to") {
-			continue
+		return
+	}
+	// Subcommands which share the flags of the charts are followed by them
+	var command string
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "compare" || args[0] == "collect" || args[0] == "bench" || args[0] == "scrape" || args[0] == "daemon" || args[0] == "gasused" || args[0] == "save" || args[0] == "generate") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if command == "collect" {
+		ctx, cancel := interruptible()
+		defer cancel()
+		collectCmd(ctx)
+		return
+	}
+	if command == "gasused" {
+		ctx, cancel := interruptible()
+		defer cancel()
+		gasUsedCmd(ctx)
+		return
+	}
+	if command == "generate" {
+		ctx, cancel := interruptible()
+		defer cancel()
+		generateCmd(ctx)
+		return
+	}
+	// A snapshot brings its own chart suite, which --config overrides
+	var snap *analysisSnapshot
+	if *snapshotFlag != "" && command != "save" {
+		var err error
+		if snap, err = readSnapshot(*snapshotFlag); err != nil {
+			fatal(exitUsage, "Failed to load snapshot", "err", err)
 		}
-		blockstring := strings.Split(fStat.Name(), "_")[2]
-		blnum, _ := strconv.Atoi(blockstring)
-		dat, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", dir, fStat.Name()))
-		if err != nil {
-			fmt.Printf("error: %v", err)
-			os.Exit(1)
+	}
+	suite, err := loadSuite(*suiteFile)
+	if snap != nil && *suiteFile == "" {
+		suite, err = snap.suite()
+	}
+	if err != nil {
+		fatal(exitUsage, "Failed to load chart suite", "err", err)
+	}
+	if err := suite.registerMetrics(); err != nil {
+		fatal(exitUsage, "Invalid chart suite", "err", err)
+	}
+	if err := suite.registerGroups(); err != nil {
+		fatal(exitUsage, "Invalid chart suite", "err", err)
+	}
+	naming := suite.OpNames
+	if *opNamesFlag != "" {
+		naming = *opNamesFlag
+	}
+	if err := setOpNames(naming); err != nil {
+		fatal(exitUsage, "Invalid opcode naming", "err", err)
+	}
+	if err := setFormat(*formatFlag); err != nil {
+		fatal(exitUsage, "Invalid input format", "err", err)
+	}
+	if format.deltas && *chunkFlag > 0 {
+		fatal(exitUsage, "Chunked loading needs cumulative meters", "format", *formatFlag)
+	}
+	if *perTxFlag && (!format.txs || *chunkFlag > 0) {
+		fatal(exitUsage, "Per-transaction meters are only loaded from geth metrics, without chunking", "format", *formatFlag)
+	}
+	if err := setExcluded(); err != nil {
+		fatal(exitUsage, "Invalid opcode exclusion", "err", err)
+	}
+	if _, err := compileOpsMatch(*opsMatchFlag); err != nil {
+		fatal(exitUsage, "Invalid opcode selection", "err", err)
+	}
+	if *gasUsedFlag != "" {
+		if err := setGasUsed(*gasUsedFlag); err != nil {
+			fatal(exitUsage, "Failed to load gas used", "err", err)
 		}
-		stat.collect(blnum, dat)
 	}
-	for _, op := range []vm.OpCode{vm.BLOCKHASH, vm.SLOAD, vm.BALANCE} {
-
-		fmt.Printf("Plotting %v\n", op)
-		var timepergas = func(dp *dataPoint) float64 {
-			return dp.MilliSecondsPerMgas()
+	if err := setXAxis(*xAxisFlag, *timestampsFlag); err != nil {
+		fatal(exitUsage, "Invalid X axis", "err", err)
+	}
+	if err := checkErrorBars(*errorBarsFlag); err != nil {
+		fatal(exitUsage, "Invalid error bars", "err", err)
+	}
+	if err := checkSidecar(*sidecarFlag); err != nil {
+		fatal(exitUsage, "Invalid sidecar", "err", err)
+	}
+	if err := checkWeight(*weightFlag); err != nil {
+		fatal(exitUsage, "Invalid weighting", "err", err)
+	}
+	if *updateGoldenFlag && *goldenFlag == "" {
+		fatal(exitUsage, "No golden manifest to update, see --golden")
+	}
+	if *goldenDataFlag && *sidecarFlag == "" {
+		fatal(exitUsage, "No sidecars to compare with the golden manifest, see --sidecar")
+	}
+	if *goldenFlag != "" {
+		// The golden hashes are compared with those of the manifest
+		*manifestFlag = true
+	}
+	if *dosTimeFlag < 0 || *dosTimeFlag > 100 || *dosGasFlag < 0 || *dosGasFlag > 100 {
+		fatal(exitUsage, "Invalid DoS thresholds, expected percentages", "time", *dosTimeFlag, "gas", *dosGasFlag)
+	}
+	if *sysMetricsFlag != "" {
+		if err := setSysMetrics(*sysMetricsFlag); err != nil {
+			fatal(exitUsage, "Failed to load system metrics", "err", err)
 		}
+	}
+	if err := addGasUsedMetrics(); err != nil {
+		fatal(exitUsage, "Failed to load gas used", "err", err)
+	}
+	ctx, cancel := interruptible()
+	defer cancel()
 
-		fname := fmt.Sprintf("%v-%v.png", op, info)
-		path, err := plot([]vm.OpCode{op}, stat, timepergas,
-			fmt.Sprintf("Milliseconds per Mgas (%v) - %v", op, info),
-			"Blocknumber", "Milliseconds", fname)
+	flagLayout, err := layoutFromFlags()
+	if err != nil {
+		fatal(exitUsage, "Invalid layout", "err", err)
+	}
+	layout = suite.Layout.merge(flagLayout)
+	themeName, paletteName := suite.Theme, suite.Palette
+	if *themeFlag != "" {
+		themeName = *themeFlag
+	}
+	if *paletteFlag != "" {
+		paletteName = *paletteFlag
+	}
+	if err := setColors(themeName, paletteName, suite.Palettes); err != nil {
+		fatal(exitUsage, "Invalid colors", "err", err)
+	}
+	switch command {
+	case "compare":
+		compareCmd(ctx)
+		return
+	case "bench":
+		benchCmd(ctx)
+		return
+	case "scrape":
+		scrapeCmd(ctx, suite)
+		return
+	case "daemon":
+		daemonCmd(ctx, suite)
+		return
+	case "save":
+		saveCmd(ctx, suite)
+		return
+	}
+	if *dir != "" || *chaindataFlag != "" || snap != nil {
+		var (
+			stat statCollection
+			meta runMeta
+		)
+		switch {
+		case snap != nil:
+			stat, err = snap.stats()
+			if err != nil {
+				fatal(exitFailure, "Failed to load snapshot", "err", err)
+			}
+			reportWarnings(stat.validate(*minOpTimeFlag, *maxOpTimeFlag))
+			meta = snap.Run
+		case *chaindataFlag != "":
+			stat = reexecStats(ctx)
+			meta, err = loadRunMeta("", filepath.Base(filepath.Dir(*chaindataFlag)))
+		default:
+			stat = loadStats(ctx, *dir)
+			meta, err = loadRunMeta(*dir, filepath.Base(*dir))
+		}
 		if err != nil {
-			fmt.Printf("Error %v", err)
-		} else {
-			fmt.Println(path)
+			fatal(exitUsage, "Failed to load run metadata", "err", err)
 		}
-	}
-
-	// And let's make some bar charts over the time per gas
-	var barch = 0
-	for ; barch < 7; barch++ {
-		if file, err := barchart(fmt.Sprintf("%v.total-bars-%d", info, barch), info,
-			stat, barch*1000000, (barch+1)*1000000); err != nil {
-			fmt.Printf("Error: %v", err)
-			break
-			//syscall.Exit(1)
-		} else {
-			fmt.Println(file)
+		if *run != "" {
+			meta.Name = *run
+		}
+		if len(stat.numbers()) == 0 {
+			fatal(exitFailure, "No metrics loaded", "dir", *dir)
+		}
+		if err := meta.normalize(&stat); err != nil {
+			fatal(exitUsage, "Failed to normalize", "err", err)
+		}
+		if err := addRuntimeMetrics(stat); err != nil {
+			fatal(exitUsage, "Failed to load runtime metrics", "err", err)
+		}
+		if err := addChainGasLimit(meta); err != nil {
+			fatal(exitUsage, "Failed to overlay the gas limit", "err", err)
+		}
+		fails := renderRun(ctx, os.Stdout, suite, stat, meta)
+		fails.add(writeManifest())
+		if *goldenFlag != "" && ctx.Err() == nil {
+			fails.add(checkGolden(*goldenFlag))
 		}
+		fails.finish(stat)
+		return
 	}
+	var fails failures
+	fails.add(barcharts(ctx, "./m5d.2xlarge.run3", "run3"))
+	fails.add(barcharts(ctx, "./m5d.2xlarge.run2", "run2"))
+	fails.add(barcharts(ctx, "./m5d.2xlarge", "run1"))
+	fails.add(writeManifest())
+	fails.finish(statCollection{})
 
 }
 
-func firstRun() {
+// renderRun renders the chart suite and the analyses selected by the flags,
+// and writes the reports and the summary of the run to w, continuing past any
+// failed chart.
+func renderRun(ctx context.Context, w io.Writer, suite chartSuite, stat statCollection, meta runMeta) failures {
+	if *coverage {
+		printCoverage(w, stat)
+	}
+	var fails failures
+	fails.add(suite.render(ctx, stat, meta))
+	if *profileFlag != "" && ctx.Err() == nil {
+		fails.add(plotProfiles(ctx, stat, meta, *profileFlag))
+	}
+	if *stateSizeFlag != "" && ctx.Err() == nil {
+		fails.add(stateSizeAnalysis(ctx, w, stat))
+	}
+	if *correlateFlag != "" && ctx.Err() == nil {
+		fails.add(correlateOps(w, stat))
+	}
+	if *clustersFlag > 0 && ctx.Err() == nil {
+		fails.add(chartClusters(ctx, w, stat, meta))
+	}
+	if *perTxFlag && *chaindataFlag == "" && ctx.Err() == nil {
+		fails.add(txAnalysis(ctx, w, stat))
+	}
+	if *dosTimeFlag > 0 && ctx.Err() == nil {
+		fails.add(dosAnalysis(ctx, w, stat, meta))
+	}
+	if *surfaceFlag != "" && ctx.Err() == nil {
+		fails.add(exportAttackSurface(w, stat, meta, *surfaceFlag, *underpricedFlag))
+	}
+	if numbers := stat.numbers(); len(numbers) > 0 {
+		fmt.Fprintf(w, "\nRun %v\n", meta)
+		printSummary(w, stat, 0, numbers[len(numbers)-1], *top)
+		if len(suite.Groups) > 0 {
+			printGroupSummary(w, stat, 0, numbers[len(numbers)-1], opGroups)
+		}
+		if *worstFlag > 0 {
+			printWorstIntervals(w, stat, *worstFlag)
+		}
+	}
+	return fails
+}
 
-	dir := "./m5d.2xlarge"
-	files, _ := ioutil.ReadDir(dir)
+// loadStats reads all metrics files in the given directory or archive (.zip,
+// .tar, .tar.gz, .tgz or .tar.zst). The files may be compressed with gzip (.gz)
+// or zstd (.zst). If dir is "-", JSON Lines records are read from stdin.
+//
+// Several comma-separated sources can be given, e.g. the parts of a resumed
+// sync, which are merged into one collection. If the same block occurs more
+// than once with different contents, the most recently modified file is used,
+// or with --canonical, the one of the canonical block.
+func loadStats(ctx context.Context, dir string) statCollection {
+	stat, err := readStats(ctx, dir)
+	if err != nil {
+		fatal(exitCode(err), "Failed to load metrics", "err", err)
+	}
+	return stat
+}
 
+// readStats loads the metrics like loadStats, but returns any error instead of
+// exiting, for the daemon, which fails only the report at hand.
+func readStats(ctx context.Context, dir string) (statCollection, error) {
 	stat := newStatCollection()
-	for _, fStat := range files {
-		if fStat.IsDir() {
-			continue
-		}
-		if !strings.HasPrefix(fStat.Name(), "metrics_to") {
-			continue
-		}
-		blockstring := strings.Split(fStat.Name(), "_")[2]
-		blnum, _ := strconv.Atoi(blockstring)
-		dat, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", dir, fStat.Name()))
-		if err != nil {
-			fmt.Printf("error: %v", err)
-			os.Exit(1)
+	stat.bucket, stat.weight = *bucketFlag, *weightFlag
+	if dir == "-" {
+		if err := stat.collectStream(ctx, os.Stdin); err != nil {
+			return stat, err
 		}
-		stat.collect(blnum, dat)
+		stat.reportSkipped(dir)
+		stat.checkData()
+		return stat, nil
 	}
-
-	var time = func(dp *dataPoint) float64 {
-		return float64(dp.execTime) / 1000000
+	pattern, err := newFilePattern(patternExpr())
+	if err != nil {
+		return stat, err
 	}
-	var timeCapped = func(dp *dataPoint) float64 {
-		v := float64(dp.execTime) / 1000000
-		if v < 100000 {
-			return v
+	sources := strings.Split(dir, ",")
+	key, err := cacheKey(sources, *formatFlag, patternExpr(), *strictFlag)
+	l := newLoader(&stat, pattern)
+	// The cache has no transactions, nor does it know the canonical chain
+	if *cacheDir != "" && *chunkFlag == 0 && !*perTxFlag && !*canonicalFlag && err == nil {
+		if cached, err := loadCache(*cacheDir, key, l); err == nil {
+			log.Info("Loaded metrics from cache", "snapshots", len(cached.data))
+			cached.bucket, cached.weight = stat.bucket, stat.weight
+			stat = cached
+			stat.reportSkipped(dir)
+			l.reportConflicts()
+			stat.checkData()
+			return stat, nil
+		} else if !os.IsNotExist(err) {
+			log.Warn("Ignoring cache", "err", err)
 		}
-		return 100000
 	}
-
-	// Let's make some donuts aswell
-	var donut = 0
-	for ; donut < 7; donut++ {
-		if err := pie(fmt.Sprintf("total-pie-%d", donut),
-			stat, donut*1000000, (donut+1)*1000000); err != nil {
-			fmt.Printf("Error: %v", err)
-			syscall.Exit(1)
+	// The files are matched while they are being read, and parsed concurrently,
+	// so the unmatched ones are kept apart until the loading is done.
+	var unmatched []skippedFile
+	match := func(name string) bool {
+		if pattern.match(name) {
+			return true
 		}
+		unmatched = append(unmatched, skippedFile{name, "does not match pattern"})
+		return false
 	}
-
-	if _, err := plot(allOps, stat, time, "Time spent", "Blocknumber", "Milliseconds", "timespent.png"); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	if *canonicalFlag {
+		l.canonical = newCanonicalHashes(ctx, &rpcClient{url: *rpcFlag})
 	}
-	if _, err := plotFilter(allOps, stat, timeCapped, "Time spent", "Blocknumber", "Milliseconds",
-		"timespentCapped.png", minFilter(45000), 3220000); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	l.progress = newProgress(sources, pattern, *progressFlag)
+	if *chunkFlag > 0 {
+		err := l.loadChunked(ctx, sources, match, *chunkFlag)
+		l.progress.stop()
+		if err != nil {
+			return stat, err
+		}
+		stat.skipped = append(unmatched, l.skipped...)
+		stat.reportSkipped(dir)
+		l.reportConflicts()
+		return stat, nil
 	}
-
-	var timepergas = func(dp *dataPoint) float64 {
-		return dp.MilliSecondsPerMgas()
+	failed, err := parseFiles(ctx, sources, match, l.progress.track(l.add))
+	l.skipped = append(l.skipped, failed...)
+	l.progress.stop()
+	if err != nil {
+		return stat, err
 	}
-
-	var timepergasCapAt = func(cap float64) func(*dataPoint) float64 {
-		return func(dp *dataPoint) float64 {
-			if g := dp.MilliSecondsPerMgas(); g < cap {
-				return g
-			}
-			return cap
+	stat.skipped = append(unmatched, l.skipped...)
+	if format.deltas {
+		stat.accumulate()
+	}
+	if *cacheDir != "" && key != "" && !*perTxFlag && !*canonicalFlag {
+		if err := saveCache(*cacheDir, key, stat, l); err != nil {
+			log.Warn("Failed to cache metrics", "err", err)
 		}
 	}
+	stat.reportSkipped(dir)
+	l.reportConflicts()
+	stat.checkData()
+	return stat, nil
+}
 
-	if _, err := plot(RANGE0, stat, timepergas,
-		"Milliseconds per Mgas (0x00 opcodes - Arithmetic)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("arithmetics.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+// reportSkipped lists the input files which were not loaded.
+func (stats *statCollection) reportSkipped(dir string) {
+	if len(stats.skipped) > 0 {
+		log.Warn("Skipped files", "dir", dir, "count", len(stats.skipped))
+		for i, f := range stats.skipped {
+			listed(i)("Skipped file", "file", f.name, "reason", f.reason)
+		}
 	}
+}
 
-	if _, err := plot(RANGE0, stat, timepergasCapAt(250.0),
-		"Milliseconds per Mgas (0x00 opcodes - Arithmetic) - capped", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("arithmetics_cap.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+// checkData stitches counter resets, and reports where they occurred, along
+// with any other inconsistencies in the data.
+func (stats *statCollection) checkData() {
+	reportChecks(stats.fixResets(), stats.validate(*minOpTimeFlag, *maxOpTimeFlag))
+}
+
+func reportChecks(resets []int, warnings []dataWarning) {
+	if len(resets) > 0 {
+		log.Warn("Counter resets (node restarts) detected", "blocks", resets)
 	}
+	reportWarnings(warnings)
+}
 
-	if _, err := plot(RANGE1, stat, timepergasCapAt(250.0),
-		"Milliseconds per Mgas (0x10 opcodes - Comparison)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("comparison_cap.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+// barcharts renders the per-op charts and the bar charts of a run, continuing
+// past any failed chart.
+func barcharts(ctx context.Context, dir, name string) error {
+	meta, err := dirRunMeta(dir, name)
+	if err != nil {
+		return err
 	}
-	if _, err := plot(RANGE2, stat, time,
-		"Time spent on (0x30 opcodes - SHA3)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("sha3.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	stat := loadStats(ctx, dir)
+	if err := meta.normalize(&stat); err != nil {
+		return err
 	}
-	if _, err := plot(RANGE3p1, stat, timepergasCapAt(500.0),
-		"Milliseconds per Mgas (0x30 opcodes - Context, part 1)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("context1.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	spec := chartSpec{
+		File:   "{{.Op}}-{{.Run}}.png",
+		Title:  "Milliseconds per Mgas ({{.Op}}) - {{.Run}}",
+		Ops:    opNames([]vm.OpCode{vm.BLOCKHASH, vm.SLOAD, vm.BALANCE}),
+		PerOp:  true,
+		Metric: "timepergas",
 	}
-	if _, err := plot(RANGE3p2, stat, timepergasCapAt(500.0),
-		"Milliseconds per Mgas (0x30 opcodes - Context, part 2)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("context2.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	paths, err := spec.render(ctx, stat, meta)
+	for _, path := range paths {
+		fmt.Println(path)
 	}
+	var fails failures
+	fails.add(err)
 
-	if _, err := plot(RANGE4, stat, timepergasCapAt(600.0),
-		"Milliseconds per Mgas (0x40 opcodes - Block ops)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("blockops_cap.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	// And let's make some bar charts over the time per gas
+	eras := millionEras(7)
+	if *barErasFlag {
+		eras = forkEras(stat)
 	}
-
-	if _, err := plot(RANGE4p2, stat, timepergasCapAt(3000.0),
-		"Milliseconds per Mgas (BLOCKHASH)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("blockhash.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	rare := make([][]*dataPoint, len(eras))
+	for i, e := range eras {
+		if ctx.Err() != nil {
+			break
+		}
+		file, points, err := barchart(fmt.Sprintf("%v.%v", meta.Name, e.name), meta, stat, e.from, e.to)
+		if err != nil {
+			fails.add(fmt.Errorf("%v: %v", meta.Name, err))
+			continue
+		}
+		fmt.Println(file)
+		rare[i] = points
 	}
-
-	if _, err := plot(RANGE5p1, stat, timepergasCapAt(3000.0),
-		"Milliseconds per Mgas (0x50 Storage and execution - part 1)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("storage1.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	if numbers := stat.numbers(); len(numbers) > 0 {
+		fmt.Printf("\nRun %v\n", meta)
+		printSummary(os.Stdout, stat, 0, numbers[len(numbers)-1], *top)
 	}
-	if _, err := plot(RANGE6, stat, timepergasCapAt(600.0),
-		"Milliseconds per Mgas (0x60 Pops, Swaps, Dups)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("range60.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	for i, e := range eras {
+		if len(rare[i]) > 0 {
+			printRare(os.Stdout, e.from, e.to, rare[i])
+		}
 	}
+	return fails.err()
+}
 
-	if _, err := plot(RANGE6, stat, timepergasCapAt(100.0),
-		"Milliseconds per Mgas (0x60 Pops, Swaps, Dups) - capped at 100", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("range60p2.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
-	}
+func firstRun(ctx context.Context) {
+	stat := loadStats(ctx, "./m5d.2xlarge")
 
-	if _, err := plot(RANGE7, stat, time,
-		"Time spent on log operations (0x70 LOG) ", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("logging.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	// Let's make some donuts aswell
+	var donut = 0
+	for ; donut < 7; donut++ {
+		if err := pie(fmt.Sprintf("total-pie-%d", donut),
+			stat, donut*1000000, (donut+1)*1000000); err != nil {
+			fatal(exitFailure, "Failed to render pie chart", "err", err)
+		}
 	}
-
-	if _, err := plot([]vm.OpCode{vm.SLOAD}, stat, timepergas,
-		"Milliseconds per Mgas (SLOAD)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("sload.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	suite, err := loadSuite(*suiteFile)
+	if err != nil {
+		fatal(exitUsage, "Failed to load chart suite", "err", err)
 	}
-	if _, err := plot([]vm.OpCode{vm.BALANCE}, stat, timepergas,
-		"Milliseconds per Mgas (BALANCE)", "Blocknumber", "Milliseconds",
-		fmt.Sprintf("balance.png")); err != nil {
-		fmt.Printf("Error: %v", err)
-		syscall.Exit(1)
+	meta, err := dirRunMeta("./m5d.2xlarge", "run1")
+	if err != nil {
+		fatal(exitUsage, "Failed to load run metadata", "err", err)
+	}
+	if err := meta.normalize(&stat); err != nil {
+		fatal(exitUsage, "Failed to normalize", "err", err)
+	}
+	if err := suite.render(ctx, stat, meta); err != nil {
+		fatal(exitPartial, "Failed to render charts", "err", err)
 	}
-
 }
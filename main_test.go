@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+// setFlags sets the given command line flags for the duration of the test.
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+	for name, value := range values {
+		f := flag.Lookup(name)
+		if f == nil {
+			t.Fatalf("unknown flag %q", name)
+		}
+		old := f.Value.String()
+		if err := flag.Set(name, value); err != nil {
+			t.Fatalf("flag %q: %v", name, err)
+		}
+		t.Cleanup(func() { flag.Set(name, old) })
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	manifestFlag     = flag.Bool("manifest", false, "Write charts/manifest.json, listing every rendered chart with its parameters and hashes")
+	reproducibleFlag = flag.Bool("reproducible", false, "Leave the generation time out of the manifest, so that the same inputs and flags give byte-identical output")
+)
+
+const manifestPath = "./charts/manifest.json"
+
+// manifest indexes the artifacts of a run, so that other tools can find the
+// charts and their parameters without parsing the file names.
+type manifest struct {
+	Generated *time.Time        `json:"generated,omitempty"` // Left out with --reproducible
+	Flags     map[string]string `json:"flags,omitempty"`     // The flags set on the command line
+	Charts    []manifestEntry   `json:"charts"`
+}
+
+type manifestEntry struct {
+	File    string       `json:"file"`
+	Title   string       `json:"title"`
+	Series  []string     `json:"series,omitempty"`
+	Range   *[2]float64  `json:"range,omitempty"` // Of the X values of line charts, in blocks
+	Params  interface{}  `json:"params,omitempty"`
+	SHA256  string       `json:"sha256"`
+	Sidecar *manifestRef `json:"sidecar,omitempty"`
+}
+
+type manifestRef struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// artifacts holds the charts rendered so far, by path. A chart which is
+// rendered again, as when scraping, replaces its earlier entry.
+var artifacts = make(map[string]manifestEntry)
+
+// recordArtifact adds the chart at path, along with its sidecar at out, if
+// one was written, to the manifest.
+func recordArtifact(path, out string, sc sidecar) error {
+	if !*manifestFlag {
+		return nil
+	}
+	sum, err := fileHash(path)
+	if err != nil {
+		return err
+	}
+	entry := manifestEntry{File: sc.Chart, Title: sc.Title, Params: sc.Params, SHA256: sum}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range sc.Series {
+		entry.Series = append(entry.Series, s.Name)
+		for _, x := range s.X {
+			lo, hi = math.Min(lo, x), math.Max(hi, x)
+		}
+	}
+	if lo <= hi {
+		entry.Range = &[2]float64{lo, hi}
+	}
+	if out != "" {
+		sum, err := fileHash(out)
+		if err != nil {
+			return err
+		}
+		entry.Sidecar = &manifestRef{File: filepath.Base(out), SHA256: sum}
+	}
+	artifacts[path] = entry
+	return nil
+}
+
+// writeManifest writes the manifest of the charts rendered so far, if
+// --manifest is set.
+func writeManifest() error {
+	if !*manifestFlag {
+		return nil
+	}
+	m := manifest{Flags: make(map[string]string)}
+	if !*reproducibleFlag {
+		now := time.Now().UTC()
+		m.Generated = &now
+	}
+	flag.Visit(func(f *flag.Flag) {
+		m.Flags[f.Name] = f.Value.String()
+	})
+	m.Charts = manifestCharts()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath, append(data, '\n'), 0644)
+}
+
+// manifestCharts returns the entries of the charts rendered so far, sorted by
+// their files.
+func manifestCharts() []manifestEntry {
+	var charts []manifestEntry
+	for _, entry := range artifacts {
+		charts = append(charts, entry)
+	}
+	sort.Slice(charts, func(i, j int) bool {
+		return charts[i].File < charts[j].File
+	})
+	return charts
+}
+
+// fileHash returns the hex-encoded SHA-256 of the file.
+func fileHash(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// nethermindTick is the resolution of the .NET timings, 100 nanoseconds.
+const nethermindTick = 100 * time.Nanosecond
+
+// nethermindDump is a dump of Nethermind's per-opcode instrumentation,
+// cumulative since the start of the node, with the timings in .NET ticks:
+//
+//	{"BlockNumber": 4760000, "Opcodes": {"ADD": {"Count": 12, "Ticks": 34}, ...}}
+type nethermindDump struct {
+	BlockNumber int
+	Opcodes     map[string]struct {
+		Count uint64
+		Ticks int64
+	}
+}
+
+// parseNethermind decodes a Nethermind dump.
+func parseNethermind(r io.Reader) ([256]opMeter, int, error) {
+	var (
+		m    [256]opMeter
+		dump nethermindDump
+	)
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return m, 0, fmt.Errorf("invalid nethermind metrics: %v", err)
+	}
+	if dump.Opcodes == nil {
+		return m, 0, fmt.Errorf("invalid nethermind metrics: no opcodes")
+	}
+	for name, meter := range dump.Opcodes {
+		if om := meterOp(&m, name); om != nil {
+			om.Num = meter.Count
+			om.Time = time.Duration(meter.Ticks) * nethermindTick
+		}
+	}
+	return m, dump.BlockNumber, nil
+}
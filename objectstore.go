@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"google.golang.org/api/iterator"
+)
+
+// object is an entry in an object store listing.
+type object struct {
+	key     string
+	modTime time.Time
+}
+
+// objectStore is a bucket in S3 or GCS.
+type objectStore interface {
+	// list returns all objects under the prefix.
+	list(ctx context.Context, prefix string) ([]object, error)
+	// open returns a reader for the object with the given key.
+	open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+func isObjectStore(src string) bool {
+	return strings.HasPrefix(src, "s3://") || strings.HasPrefix(src, "gs://")
+}
+
+type s3Store struct {
+	svc    *s3.S3
+	bucket string
+}
+
+// newS3Store creates an S3 client, using the standard AWS credential chain
+// (environment, shared config and instance roles).
+func newS3Store(bucket string) (*s3Store, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{svc: s3.New(sess), bucket: bucket}, nil
+}
+
+func (s *s3Store) list(ctx context.Context, prefix string) ([]object, error) {
+	var objects []object
+	err := s.svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range page.Contents {
+			objects = append(objects, object{aws.StringValue(obj.Key), aws.TimeValue(obj.LastModified)})
+		}
+		return true
+	})
+	return objects, err
+}
+
+func (s *s3Store) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+type gcsStore struct {
+	bucket *storage.BucketHandle
+}
+
+// newGCSStore creates a GCS client, using the application default credentials.
+func newGCSStore(ctx context.Context, bucket string) (*gcsStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsStore{bucket: client.Bucket(bucket)}, nil
+}
+
+func (s *gcsStore) list(ctx context.Context, prefix string) ([]object, error) {
+	var objects []object
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return objects, err
+		}
+		objects = append(objects, object{attrs.Name, attrs.Updated})
+	}
+}
+
+func (s *gcsStore) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.bucket.Object(key).NewReader(ctx)
+}
+
+// forEachObject is the object-store counterpart of forEachFile, for sources
+// like s3://bucket/runs/run3/ or gs://bucket/runs/run3.tar.gz. Archives are
+// downloaded to a temporary file first.
+func forEachObject(ctx context.Context, src string, match func(name string) bool, fn fileFn) error {
+	u, err := url.Parse(src)
+	if err != nil {
+		return err
+	}
+	var store objectStore
+	switch u.Scheme {
+	case "s3":
+		store, err = newS3Store(u.Host)
+	case "gs":
+		store, err = newGCSStore(ctx, u.Host)
+	default:
+		err = fmt.Errorf("unsupported object store %q", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if isArchive(prefix) {
+		rc, err := store.open(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		f, err := ioutil.TempFile("", "vmstats-*-"+path.Base(prefix))
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		_, err = io.Copy(f, rc)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		return forEachFile(ctx, f.Name(), match, fn)
+	}
+	objects, err := store.list(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		name := path.Base(obj.key)
+		if strings.HasSuffix(obj.key, "/") || !match(name) {
+			continue
+		}
+		data, err := readEntry(func() (io.ReadCloser, error) {
+			return store.open(ctx, obj.key)
+		}, name)
+		if err != nil {
+			return err
+		}
+		if err := fn(&metricsFile{name, src, obj.modTime, buffered(data)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var opNamesFlag = flag.String("op-names", "", "Names of renamed opcodes in charts and reports: legacy (SHA3) or current (KECCAK256), defaults to go-ethereum's")
+
+// renamedOps are the opcodes which were renamed in go-ethereum, as pairs of
+// the legacy and the current name. Both names are accepted wherever opcodes
+// are named, regardless of the go-ethereum version.
+var renamedOps = [][2]string{
+	{"SHA3", "KECCAK256"},
+	{"DIFFICULTY", "PREVRANDAO"},
+}
+
+// displayNames maps the renamed opcodes to the name shown in charts and
+// reports, see setOpNames. Opcodes which are not in here are shown by the name
+// go-ethereum gives them.
+var displayNames = make(map[vm.OpCode]string)
+
+// lookupOp returns the opcode with the given name, which may be either name of
+// a renamed opcode.
+func lookupOp(name string) (vm.OpCode, bool) {
+	if op := vm.StringToOp(name); op != vm.STOP || name == "STOP" {
+		return op, true
+	}
+	for _, names := range renamedOps {
+		if name != names[0] && name != names[1] {
+			continue
+		}
+		for _, alias := range names {
+			if op := vm.StringToOp(alias); op != vm.STOP {
+				return op, true
+			}
+		}
+	}
+	return vm.STOP, false
+}
+
+// setOpNames selects the names of the renamed opcodes: "legacy", "current", or
+// empty for the names of the go-ethereum version in use.
+func setOpNames(naming string) error {
+	var index int
+	switch naming {
+	case "":
+		return nil
+	case "legacy":
+		index = 0
+	case "current":
+		index = 1
+	default:
+		return fmt.Errorf("unknown opcode naming %q (available: legacy, current)", naming)
+	}
+	for _, names := range renamedOps {
+		if op, ok := lookupOp(names[index]); ok {
+			displayNames[op] = names[index]
+		}
+	}
+	return nil
+}
+
+// opName returns the name of op in charts and reports.
+func opName(op vm.OpCode) string {
+	if name, ok := displayNames[op]; ok {
+		return name
+	}
+	return op.String()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var (
+	paletteFlag = flag.String("palette", "", "Series color palette: default, colorblind, tol, or one defined in the config")
+	themeFlag   = flag.String("theme", "", "Chart theme: light or dark")
+)
+
+// theme defines the non-series colors of a chart, and the series colors used
+// when no palette is selected.
+type theme struct {
+	background drawing.Color
+	canvas     drawing.Color
+	axis       drawing.Color
+	text       drawing.Color
+	series     []string // Default series colors, nil means the go-chart default
+}
+
+var themes = map[string]theme{
+	"light": {
+		background: chart.DefaultBackgroundColor,
+		canvas:     chart.DefaultCanvasColor,
+		axis:       chart.DefaultAxisColor,
+		text:       chart.DefaultTextColor,
+	},
+	"dark": {
+		background: drawing.Color{R: 30, G: 30, B: 30, A: 255},
+		canvas:     drawing.Color{R: 40, G: 40, B: 40, A: 255},
+		axis:       drawing.Color{R: 160, G: 160, B: 160, A: 255},
+		text:       drawing.Color{R: 220, G: 220, B: 220, A: 255},
+		series: []string{"#4FC3F7", "#FFB74D", "#81C784", "#E57373", "#BA68C8", "#FFF176",
+			"#4DB6AC", "#F06292", "#A1887F", "#90A4AE"},
+	},
+}
+
+// palette is a chart.ColorPalette with configurable background, text and series colors.
+type palette struct {
+	theme
+	colors []drawing.Color
+}
+
+func (p *palette) BackgroundColor() drawing.Color       { return p.background }
+func (p *palette) BackgroundStrokeColor() drawing.Color { return p.background }
+func (p *palette) CanvasColor() drawing.Color           { return p.canvas }
+func (p *palette) CanvasStrokeColor() drawing.Color     { return p.canvas }
+func (p *palette) AxisStrokeColor() drawing.Color       { return p.axis }
+func (p *palette) TextColor() drawing.Color             { return p.text }
+
+func (p *palette) GetSeriesColor(index int) drawing.Color {
+	return p.colors[index%len(p.colors)]
+}
+
+func parseColor(hex string) (drawing.Color, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 && len(hex) != 3 {
+		return drawing.Color{}, fmt.Errorf("invalid color %q", hex)
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return drawing.Color{}, fmt.Errorf("invalid color %q", hex)
+		}
+	}
+	return drawing.ColorFromHex(hex), nil
+}
+
+// builtinPalettes are the palettes available without configuration.
+var builtinPalettes = map[string][]string{
+	// Okabe & Ito, "Color Universal Design"
+	"colorblind": {"#E69F00", "#56B4E9", "#009E73", "#F0E442", "#0072B2", "#D55E00", "#CC79A7", "#000000"},
+	// Paul Tol's 'muted' scheme, distinguishable for all common color blindnesses
+	"tol": {"#332288", "#88CCEE", "#44AA99", "#117733", "#999933", "#DDCC77", "#CC6677", "#882255", "#AA4499", "#DDDDDD"},
+}
+
+var (
+	// colors is the palette used for all charts, nil means the go-chart default.
+	colors chart.ColorPalette
+	// foreground is the color used for overlays such as moving averages.
+	foreground = drawing.ColorBlack
+	// overlay is the style of annotations and legends, zero means the go-chart default.
+	overlay chart.Style
+)
+
+// setColors configures the chart colors from the given theme and palette. The
+// palette is looked up first among the user-defined palettes and then among the
+// builtin ones.
+func setColors(themeName, paletteName string, defined map[string][]string) error {
+	if themeName == "" {
+		themeName = "light"
+	}
+	t, ok := themes[themeName]
+	if !ok {
+		return fmt.Errorf("unknown theme %q", themeName)
+	}
+	hexColors := t.series
+	if paletteName != "" && paletteName != "default" {
+		if hexColors, ok = defined[paletteName]; !ok {
+			if hexColors, ok = builtinPalettes[paletteName]; !ok {
+				return fmt.Errorf("unknown palette %q", paletteName)
+			}
+		}
+		if len(hexColors) == 0 {
+			return fmt.Errorf("palette %v has no colors", paletteName)
+		}
+	}
+	if themeName == "light" && hexColors == nil {
+		colors = nil
+		return nil
+	}
+	p := &palette{theme: t}
+	for _, hex := range hexColors {
+		c, err := parseColor(hex)
+		if err != nil {
+			return fmt.Errorf("palette %v: %v", paletteName, err)
+		}
+		p.colors = append(p.colors, c)
+	}
+	colors = p
+	if themeName != "light" {
+		foreground = t.text
+		overlay = chart.Style{
+			Show:        true,
+			FillColor:   t.canvas,
+			FontColor:   t.text,
+			StrokeColor: t.axis,
+		}
+	}
+	return nil
+}
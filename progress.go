@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var progressFlag = flag.Duration("progress", 5*time.Second, "Interval between progress reports while loading (0 = none)")
+
+// progress periodically reports how far the loading has come. The total
+// number of files is only known for local directories, other sources are
+// reported without an ETA.
+type progress struct {
+	pattern *filePattern
+	start   time.Time
+	total   int // Number of matching files, zero if unknown
+	stopCh  chan struct{}
+	done    sync.WaitGroup
+
+	mu          sync.Mutex
+	files       int
+	first, last int // Range of blocks loaded so far
+	reported    bool
+}
+
+// newProgress starts reporting at the given interval, until stop is called. It
+// returns nil if the interval is zero.
+func newProgress(sources []string, pattern *filePattern, interval time.Duration) *progress {
+	if interval <= 0 {
+		return nil
+	}
+	p := &progress{
+		pattern: pattern,
+		start:   time.Now(),
+		total:   countFiles(sources, pattern),
+		stopCh:  make(chan struct{}),
+	}
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.stopCh:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// countFiles returns the number of matching files in the sources, or zero if
+// any of them is not a local directory.
+func countFiles(sources []string, pattern *filePattern) int {
+	var total int
+	for _, src := range sources {
+		if isRemote(src) || isObjectStore(src) || isArchive(src) {
+			return 0
+		}
+		files, err := ioutil.ReadDir(src)
+		if err != nil {
+			return 0
+		}
+		for _, f := range files {
+			if !f.IsDir() && pattern.match(f.Name()) {
+				total++
+			}
+		}
+	}
+	return total
+}
+
+// track wraps fn, counting the files passed to it.
+func (p *progress) track(fn func(f *parsedFile) error) func(f *parsedFile) error {
+	if p == nil {
+		return fn
+	}
+	return func(f *parsedFile) error {
+		blnum, _ := p.pattern.block(f.name)
+		p.mu.Lock()
+		p.files++
+		if blnum > 0 && (p.first == 0 || blnum < p.first) {
+			p.first = blnum
+		}
+		if blnum > p.last {
+			p.last = blnum
+		}
+		p.mu.Unlock()
+		return fn(f)
+	}
+}
+
+func (p *progress) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		elapsed = time.Since(p.start)
+		rate    = float64(p.files) / elapsed.Seconds()
+		ctx     = []interface{}{"files", p.files}
+	)
+	if p.total > 0 {
+		ctx = append(ctx, "total", p.total)
+	}
+	if p.files > 0 {
+		ctx = append(ctx, "blocks", fmt.Sprintf("%d-%d", p.first, p.last), "rate", fmt.Sprintf("%.0f/s", rate))
+	}
+	if p.total > 0 && rate > 0 && p.files < p.total {
+		eta := time.Duration(float64(p.total-p.files) / rate * float64(time.Second))
+		ctx = append(ctx, "eta", eta.Round(time.Second))
+	}
+	log.Info("Loading metrics", ctx...)
+	p.reported = true
+}
+
+// stop ends the reporting. If any progress was reported, the total time is
+// reported as well.
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.stopCh)
+	p.done.Wait()
+	if p.reported {
+		log.Info("Loaded metrics", "files", p.files, "elapsed", time.Since(p.start).Round(time.Second))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var quantilesFlag = flag.String("quantiles", "", "Comma-separated aggregates of every line chart: mean, or quantiles of the per-transaction samples like p50,p90 (default mean)")
+
+// minSamples is the number of samples an interval needs for its quantiles to
+// be plotted.
+const minSamples = 5
+
+// aggregate is how the samples of an interval are summarized into one value:
+// the mean, over all executions in the interval, or a quantile of the samples.
+type aggregate struct {
+	name string
+	q    float64 // Quantile in [0, 1], negative for the mean
+}
+
+var meanAggregate = aggregate{name: "mean", q: -1}
+
+// parseAggregates parses a list of aggregates, e.g. mean, p50 and p99.9. An
+// empty list is the mean only.
+func parseAggregates(list []string) ([]aggregate, error) {
+	if len(list) == 0 {
+		return []aggregate{meanAggregate}, nil
+	}
+	var aggs []aggregate
+	for _, name := range list {
+		name = strings.TrimSpace(name)
+		if name == meanAggregate.name {
+			aggs = append(aggs, meanAggregate)
+			continue
+		}
+		if !strings.HasPrefix(name, "p") {
+			return nil, fmt.Errorf("unknown aggregate %q, expected mean or a percentile like p90", name)
+		}
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q", name)
+		}
+		aggs = append(aggs, aggregate{name: name, q: p / 100})
+	}
+	return aggs, nil
+}
+
+// needsSamples returns true if any of the aggregates is a quantile.
+func needsSamples(aggs []aggregate) bool {
+	for _, agg := range aggs {
+		if agg.q >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// quantile returns the q-quantile of the sorted values, interpolating linearly
+// between the closest ranks.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// unsampled returns the number of snapshots from fromBlock on, and how many of
+// them have no per-transaction samples. When several sources are merged, only
+// some of them may have been collected with --per-tx.
+func (stats *statCollection) unsampled(fromBlock int) (int, int) {
+	var total, missing int
+	for _, number := range stats.numbers() {
+		if number < fromBlock {
+			continue
+		}
+		total++
+		if _, ok := stats.txs[number]; !ok {
+			missing++
+		}
+	}
+	return total, missing
+}
+
+// quantileSeriesOf is like seriesOf, but summarizes every interval by the
+// q-quantile of the values of its transactions which executed op, rather than
+// by the mean over all of them. Intervals with fewer than minSamples samples
+// are left out.
+func (stats *statCollection) quantileSeriesOf(op vm.OpCode, fromBlock int, q float64, pick func(dp *dataPoint) *dataPoint, yFunc func(point *dataPoint) float64) ([]float64, []float64) {
+	var (
+		xseries []float64
+		yseries []float64
+		raw     = stats.numbers()
+		numbers = raw
+	)
+	if stats.bucket > 0 {
+		numbers = bucketed(numbers, stats.bucket)
+	}
+	// The transactions are stored by snapshot, a bucket holds all of those
+	// since the previous one
+	next := 0
+	for _, number := range numbers {
+		var samples []float64
+		for ; next < len(raw) && raw[next] <= number; next++ {
+			for _, tx := range stats.txs[raw[next]] {
+				m, ok := tx.meters[op]
+				if !ok || m.Num == 0 {
+					continue
+				}
+				dp := meterPoint(op, tx.block, m)
+				dp.span = 1
+				if sp := pick(dp); sp.count > 0 {
+					samples = append(samples, yFunc(sp))
+				}
+			}
+		}
+		if number < fromBlock || len(samples) < minSamples {
+			continue
+		}
+		sort.Float64s(samples)
+		xseries = append(xseries, float64(number))
+		yseries = append(yseries, quantile(samples, q))
+	}
+	return xseries, yseries
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 1}, {0.5, 3}, {0.9, 4.6}, {1, 5},
+	}
+	for _, tt := range tests {
+		if got := quantile(sorted, tt.q); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("q%v: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParseAggregates(t *testing.T) {
+	aggs, err := parseAggregates([]string{"mean", " p50", "p99.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggs) != 3 || aggs[0] != meanAggregate || aggs[1].q != 0.5 || aggs[2].name != "p99.9" {
+		t.Errorf("got %v", aggs)
+	}
+	if !needsSamples(aggs) || needsSamples(aggs[:1]) {
+		t.Error("wrong needsSamples")
+	}
+	for _, bad := range []string{"median", "p101", "px"} {
+		if _, err := parseAggregates([]string{bad}); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+// TestQuantileMerged merges a source with per-transaction samples and one
+// without, as from a resumed sync where only one part was collected with
+// --per-tx.
+func TestQuantileMerged(t *testing.T) {
+	stat := newStatCollection()
+	for _, number := range []int{100, 200, 300, 400} {
+		var m [256]opMeter
+		m[vm.SLOAD] = opMeter{Num: uint64(number), Time: 1000}
+		stat.collectMeters(number, m)
+	}
+	for _, number := range []int{300, 400} {
+		var txs []txMeters
+		for i := 0; i < minSamples; i++ {
+			txs = append(txs, txMeters{Block: number, Index: i, Meters: map[string]opMeter{"SLOAD": {Num: 1, Time: time.Duration(100 * (i + 1))}}})
+		}
+		stat.collectTxs(number, txs)
+	}
+	if total, missing := stat.unsampled(0); total != 4 || missing != 2 {
+		t.Errorf("unsampled: %d of %d, want 2 of 4", missing, total)
+	}
+	if total, missing := stat.unsampled(300); total != 2 || missing != 0 {
+		t.Errorf("unsampled from 300: %d of %d, want 0 of 2", missing, total)
+	}
+	pick := func(dp *dataPoint) *dataPoint { return dp }
+	xs, ys := stat.quantileSeriesOf(vm.SLOAD, 0, 0.5, pick, metricVars["time"])
+	if len(xs) != 2 || xs[0] != 300 || xs[1] != 400 || ys[0] != 300 {
+		t.Errorf("got %v %v, want the medians at 300 and 400", xs, ys)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var chaindataFlag = flag.String("chaindata", "", "Re-execute the blocks from --from to --to of this geth chaindata directory, instead of loading metrics files")
+
+// timingTracer measures the execution time of every opcode, as the time from
+// one step to the next. The time therefore includes the overhead of tracing,
+// which is the same for all opcodes, and that of entering and leaving calls,
+// which is attributed to the calling opcodes.
+type timingTracer struct {
+	meters [256]opMeter
+	last   vm.OpCode
+	start  time.Time // Start of the last step, zero outside of a transaction
+}
+
+func (t *timingTracer) step(op vm.OpCode, now time.Time) {
+	if !t.start.IsZero() {
+		t.meters[t.last].Num++
+		t.meters[t.last].Time += now.Sub(t.start)
+	}
+	t.last, t.start = op, now
+}
+
+func (t *timingTracer) CaptureStart(from common.Address, to common.Address, call bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (t *timingTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	t.step(op, time.Now())
+	return nil
+}
+
+func (t *timingTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *timingTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	t.step(0, time.Now())
+	t.start = time.Time{}
+	return nil
+}
+
+// chainReader provides the headers of the chaindata for BLOCKHASH.
+type chainReader struct {
+	db ethdb.Database
+}
+
+// Engine is only used to find the author of a block, which is always passed
+// to the state transition explicitly.
+func (c chainReader) Engine() consensus.Engine {
+	return nil
+}
+
+func (c chainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return rawdb.ReadHeader(c.db, hash, number)
+}
+
+// reexecute re-executes the blocks from first to last in the given chaindata
+// with the timingTracer, and collects a snapshot every `every` blocks. The
+// state of the blocks must be available, i.e. the chaindata must be of an
+// archive node for all but the most recent blocks. The chaindata is only
+// read, but the LevelDB of geth 1.8 can't be opened read-only, so the node
+// must not be running.
+func reexecute(ctx context.Context, chaindata string, first, last, every int) (statCollection, error) {
+	stat := newStatCollection()
+	stat.bucket, stat.weight = *bucketFlag, *weightFlag
+	db, err := ethdb.NewLDBDatabase(chaindata, 512, 256)
+	if err != nil {
+		return stat, err
+	}
+	defer db.Close()
+
+	var (
+		chain  = chainReader{db}
+		tracer = new(timingTracer)
+		config = vm.Config{Debug: true, Tracer: tracer}
+		start  = time.Now()
+	)
+	for number := first; number <= last; number++ {
+		if err := ctx.Err(); err != nil {
+			return stat, err
+		}
+		block := rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, uint64(number)), uint64(number))
+		if block == nil {
+			return stat, fmt.Errorf("block %d not found", number)
+		}
+		parent := rawdb.ReadHeader(db, block.ParentHash(), uint64(number-1))
+		if parent == nil {
+			return stat, fmt.Errorf("parent of block %d not found", number)
+		}
+		statedb, err := state.New(parent.Root, state.NewDatabase(db))
+		if err != nil {
+			return stat, fmt.Errorf("state of block %d: %v", number-1, err)
+		}
+		var (
+			header  = block.Header()
+			author  = block.Coinbase()
+			gp      = new(core.GasPool).AddGas(block.GasLimit())
+			usedGas uint64
+		)
+		for i, tx := range block.Transactions() {
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			if _, _, err := core.ApplyTransaction(params.MainnetChainConfig, chain, &author, gp, statedb, header, tx, &usedGas, config); err != nil {
+				return stat, fmt.Errorf("block %d, transaction %d: %v", number, i, err)
+			}
+		}
+		if (number-first+1)%every == 0 || number == last {
+			stat.collectMeters(number, tracer.meters)
+			log.Info("Re-executed blocks", "number", number, "elapsed", time.Since(start).Round(time.Second))
+		}
+	}
+	return stat, nil
+}
+
+// reexecStats re-executes the blocks selected by the flags, and checks the
+// resulting metrics like loaded ones.
+func reexecStats(ctx context.Context) statCollection {
+	if *toFlag < *fromFlag || *fromFlag < 1 {
+		fatal(exitUsage, "Invalid block range, see --from and --to", "from", *fromFlag, "to", *toFlag)
+	}
+	if *everyFlag <= 0 {
+		fatal(exitUsage, "Invalid interval, see --every", "every", *everyFlag)
+	}
+	stat, err := reexecute(ctx, *chaindataFlag, *fromFlag, *toFlag, *everyFlag)
+	if err != nil {
+		fatal(exitCode(err), "Failed to re-execute blocks", "err", err)
+	}
+	stat.checkData()
+	return stat
+}
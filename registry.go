@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Names of the per-opcode metrics in a geth metrics registry, around the name
+// of the opcode.
+const (
+	registryTimer = "/time" // Timer of the executions
+	registryGas   = "/gas"  // Counter of the gas spent, if measured
+)
+
+// Names of the other metrics read from a geth metrics registry.
+const (
+	registryBlock  = "chain/head/block"     // Gauge of the head block
+	registryPauses = "system/memory/pauses" // Meter of the GC pauses, in nanoseconds
+	registryHeap   = "system/memory/used"   // Gauge of the bytes allocated on the heap
+)
+
+// parseRegistry decodes a JSON dump of the metrics registry of an instrumented
+// geth, as written by metrics.WriteJSON. Every metric is an object of its
+// values, and the opcodes have a timer and optionally a gas counter:
+//
+//	{"vm/op/SLOAD/time": {"count": 12, "mean": 283.3, ...}, "vm/op/SLOAD/gas": {"count": 9600}, ...}
+//
+// Like when scraping, the total time is taken from a "sum" if there is one, and
+// estimated as the mean times the count otherwise. The block number is read
+// from the chain/head/block gauge, if it was dumped.
+func parseRegistry(r io.Reader) ([256]opMeter, int, error) {
+	m, block, _, err := parseRegistryDump(r, false)
+	return m, block, err
+}
+
+// parseRegistryDump decodes a registry dump like parseRegistry, along with the
+// runtime metrics of the node, from the system/memory metrics of geth: the GC
+// pauses meter, which counts nanoseconds, and the gauge of the bytes in use.
+// Registries have no transactions.
+func parseRegistryDump(r io.Reader, withTxs bool) ([256]opMeter, int, dumpExtras, error) {
+	var (
+		m    [256]opMeter
+		x    dumpExtras
+		dump map[string]map[string]interface{}
+	)
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return m, 0, x, fmt.Errorf("invalid metrics registry: %v", err)
+	}
+	values := make(map[string]interface{})
+	for name, metric := range dump {
+		for field, v := range metric {
+			values[name+"."+field] = v
+		}
+	}
+	value := func(key string) (float64, bool) {
+		v, ok := values[key].(float64)
+		return v, ok
+	}
+	var found bool
+	for name := range dump {
+		if !strings.HasPrefix(name, opTimerPrefix) || !strings.HasSuffix(name, registryTimer) {
+			continue
+		}
+		op := strings.TrimSuffix(strings.TrimPrefix(name, opTimerPrefix), registryTimer)
+		om := meterOp(&m, op)
+		if om == nil {
+			continue
+		}
+		timerMeter(om, name, value)
+		if gas, ok := value(opTimerPrefix + op + registryGas + ".count"); ok {
+			om.Gas = uint64(gas)
+		}
+		found = true
+	}
+	if !found {
+		return m, 0, x, fmt.Errorf("no %v*%v timers in the metrics registry", opTimerPrefix, registryTimer)
+	}
+	pauses, hasPauses := value(registryPauses + ".count")
+	heap, hasHeap := value(registryHeap + ".value")
+	if hasPauses || hasHeap {
+		x.runtime = &runtimeStats{PauseTotalNs: uint64(pauses), HeapAlloc: uint64(heap)}
+	}
+	block, _ := value(registryBlock + ".value")
+	return m, int(block), x, nil
+}
+
+// timerMeter sets the count and the total time of om from the geth timer with
+// the given name, whose values are looked up as name.count, name.sum and
+// name.mean.
+func timerMeter(om *opMeter, name string, value func(key string) (float64, bool)) {
+	count, _ := value(name + ".count")
+	om.Num = uint64(count)
+	if sum, ok := value(name + ".sum"); ok {
+		om.Time = time.Duration(sum)
+	} else if mean, ok := value(name + ".mean"); ok {
+		om.Time = time.Duration(mean * count)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// hrefRe matches the links in an HTML directory listing.
+var hrefRe = regexp.MustCompile(`href="([^"?#]+)"`)
+
+func isRemote(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// get performs a GET request, which is aborted when ctx is cancelled.
+func get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+// fetch performs a GET request and returns the response body.
+func fetch(ctx context.Context, u string) ([]byte, http.Header, error) {
+	resp, err := get(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetching %v: %v", u, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	return body, resp.Header, err
+}
+
+// remoteFiles returns the URLs of the files listed at the given URL, which is
+// either an HTML directory listing or a manifest with one (relative) file URL
+// per line.
+func remoteFiles(ctx context.Context, src string) ([]*url.URL, error) {
+	base, err := url.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	body, header, err := fetch(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	if strings.HasPrefix(header.Get("Content-Type"), "text/html") {
+		for _, m := range hrefRe.FindAllSubmatch(body, -1) {
+			refs = append(refs, string(m[1]))
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				refs = append(refs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	var urls []*url.URL
+	for _, ref := range refs {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file reference %q in %v: %v", ref, src, err)
+		}
+		urls = append(urls, base.ResolveReference(u))
+	}
+	return urls, nil
+}
+
+// forEachRemoteFile is the remote counterpart of forEachFile. Archives are
+// downloaded to a temporary file first.
+func forEachRemoteFile(ctx context.Context, src string, match func(name string) bool, fn fileFn) error {
+	if isArchive(src) {
+		tmp, err := download(ctx, src)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		return forEachFile(ctx, tmp, match, fn)
+	}
+	urls, err := remoteFiles(ctx, src)
+	if err != nil {
+		return err
+	}
+	for _, u := range urls {
+		name := path.Base(u.Path)
+		if !match(name) {
+			continue
+		}
+		body, header, err := fetch(ctx, u.String())
+		if err != nil {
+			return err
+		}
+		data, err := readEntry(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}, name)
+		if err != nil {
+			return err
+		}
+		// A missing or malformed header leaves the zero time
+		modTime, _ := http.ParseTime(header.Get("Last-Modified"))
+		if err := fn(&metricsFile{name, src, modTime, buffered(data)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download fetches the given URL into a temporary file, retaining the file
+// extension so the archive type can be detected.
+func download(ctx context.Context, src string) (string, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	resp, err := get(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %v: %v", src, resp.Status)
+	}
+	f, err := ioutil.TempFile("", "vmstats-*-"+path.Base(u.Path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var canonicalFlag = flag.Bool("canonical", false, "Resolve snapshots of the same block with different block hashes, left behind by reorgs, in favour of the canonical block of the node at --rpc")
+
+// blockHash returns the hash of the canonical block with the given number.
+func (c *rpcClient) blockHash(ctx context.Context, number int) (string, error) {
+	var block struct {
+		Hash string `json:"hash"`
+	}
+	err := c.call(ctx, &block, "eth_getBlockByNumber", "0x"+strconv.FormatInt(int64(number), 16), false)
+	if err != nil {
+		return "", fmt.Errorf("block %d: %v", number, err)
+	}
+	if block.Hash == "" {
+		return "", fmt.Errorf("block %d: not found", number)
+	}
+	return block.Hash, nil
+}
+
+// canonicalHashes looks up the canonical hashes of blocks on demand, once per
+// block, as only the blocks with conflicting snapshots need them.
+type canonicalHashes struct {
+	ctx    context.Context
+	client *rpcClient
+	hashes map[int]string
+}
+
+func newCanonicalHashes(ctx context.Context, client *rpcClient) *canonicalHashes {
+	return &canonicalHashes{ctx: ctx, client: client, hashes: make(map[int]string)}
+}
+
+func (c *canonicalHashes) hash(number int) (string, error) {
+	if hash, ok := c.hashes[number]; ok {
+		return hash, nil
+	}
+	hash, err := c.client.blockHash(c.ctx, number)
+	if err != nil {
+		return "", err
+	}
+	c.hashes[number] = hash
+	return hash, nil
+}
+
+// sameHash reports whether the block hash taken from a filename matches the
+// full hash, which is the case for a prefix too, as filenames may abbreviate
+// the hash.
+func sameHash(name, full string) bool {
+	name = strings.ToLower(strings.TrimPrefix(name, "0x"))
+	full = strings.ToLower(strings.TrimPrefix(full, "0x"))
+	return name != "" && strings.HasPrefix(full, name)
+}
+
+// preferCanonical decides between two snapshots of blnum with different block
+// hashes in their filenames, taken on either side of a reorg. It returns
+// whether the snapshot with hash b is the canonical one, rather than a, and
+// ok is false if neither is, or the canonical chain is unknown.
+func (l *loader) preferCanonical(blnum int, a, b string) (useB, ok bool, err error) {
+	if l.canonical == nil || a == "" || b == "" || sameHash(a, b) || sameHash(b, a) {
+		return false, false, nil
+	}
+	hash, err := l.canonical.hash(blnum)
+	if err != nil {
+		return false, false, err
+	}
+	switch {
+	case sameHash(a, hash):
+		return false, true, nil
+	case sameHash(b, hash):
+		return true, true, nil
+	}
+	return false, false, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var (
+	minPerBlockFlag = flag.Float64("min-per-block", 1, "Leave the opcodes executed less often than this per block out of the bar charts, and list them instead (0 = keep all)")
+	worstFlag       = flag.Int("worst-intervals", 0, "List this many block intervals with the most EVM time, along with their dominant opcodes (0 = none)")
+)
+
+// dominantOps is the number of opcodes listed with every worst interval.
+const dominantOps = 3
+
+// delta returns the per-opcode difference between the snapshots at start and end.
+// A missing start snapshot is treated as all-zero, so start=0 means 'since genesis'.
+// Opcodes that were not executed within the range are omitted.
+func (stats *statCollection) delta(start, end int) []*dataPoint {
+	firstStat := stats.data[start]
+	lastStat := stats.data[end]
+	var points []*dataPoint
+	for op := vm.OpCode(0); op < 255; op++ {
+		dpEnd := lastStat[op]
+		if dpEnd == nil {
+			continue
+		}
+		modDp := dpEnd.Sub(firstStat[op])
+		if modDp.count == 0 {
+			continue
+		}
+		points = append(points, modDp)
+	}
+	return points
+}
+
+// printSummary writes four tables to w, listing the top n opcodes in the given
+// block range by total time spent, by time per gas, by time per execution and
+// by execution count.
+func printSummary(w io.Writer, stat statCollection, start, end, n int) {
+	points := stat.delta(start, end)
+
+	var total time.Duration
+	for _, dp := range points {
+		total += dp.execTime
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	section := func(title string, less func(a, b *dataPoint) bool, filter func(dp *dataPoint) bool) {
+		var sel []*dataPoint
+		for _, dp := range points {
+			if filter == nil || filter(dp) {
+				sel = append(sel, dp)
+			}
+		}
+		sort.Slice(sel, func(i, j int) bool {
+			return less(sel[i], sel[j])
+		})
+		if len(sel) > n {
+			sel = sel[:n]
+		}
+		fmt.Fprintf(tw, "\n%s\n", title)
+		fmt.Fprintf(tw, "OPCODE\tCOUNT\tTIME\tTIME%%\tGAS\tMS/MGAS\tNS/EXEC\t\n")
+		for _, dp := range sel {
+			share := float64(0)
+			if total > 0 {
+				share = 100 * float64(dp.execTime) / float64(total)
+			}
+			fmt.Fprintf(tw, "%v\t%d\t%v\t%.2f\t%d\t%.2f\t%.1f\t\n",
+				opName(dp.op), dp.count, dp.execTime, share, dp.gas(), dp.MilliSecondsPerMgas(), dp.NanoSecondsPerExecution())
+		}
+	}
+	fmt.Fprintf(tw, "Blocks %d to %d - top %d opcodes (total time %v)\n", start, end, n, total)
+	section("By time spent", func(a, b *dataPoint) bool {
+		return a.execTime > b.execTime
+	}, nil)
+	section("By time per gas", func(a, b *dataPoint) bool {
+		return a.MilliSecondsPerMgas() > b.MilliSecondsPerMgas()
+	}, func(dp *dataPoint) bool {
+		return dp.gas() > 0
+	})
+	section("By time per execution", func(a, b *dataPoint) bool {
+		return a.NanoSecondsPerExecution() > b.NanoSecondsPerExecution()
+	}, nil)
+	section("By count", func(a, b *dataPoint) bool {
+		return a.count > b.count
+	}, nil)
+	tw.Flush()
+}
+
+// printRare writes a table to w of the opcodes which were left out of the bar
+// chart of the given block range for being executed too rarely, ordered by time
+// per gas, since rare opcodes may well be expensive ones.
+func printRare(w io.Writer, start, end int, points []*dataPoint) {
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].MilliSecondsPerMgas() > points[j].MilliSecondsPerMgas()
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nBlocks %d to %d - %d opcodes executed < %v times per block, left out of the bars\n",
+		start, end, len(points), *minPerBlockFlag)
+	fmt.Fprintf(tw, "OPCODE\tCOUNT\tPER BLOCK\tMS/MGAS\tNS/EXEC\t\n")
+	for _, dp := range points {
+		fmt.Fprintf(tw, "%v\t%d\t%.3f\t%.2f\t%.1f\t\n",
+			opName(dp.op), dp.count, dp.ExecutionsPerBlock(), dp.MilliSecondsPerMgas(), dp.NanoSecondsPerExecution())
+	}
+	tw.Flush()
+}
+
+// printWorstIntervals writes a table to w of the n intervals between snapshots
+// with the most EVM time, along with the opcodes which took the most of it, to
+// locate slow spots like the attack blocks of 2016.
+func printWorstIntervals(w io.Writer, stat statCollection, n int) {
+	type interval struct {
+		from, to int
+		total    time.Duration
+		points   []*dataPoint
+	}
+	var (
+		numbers   = stat.numbers()
+		intervals []interval
+	)
+	for i := 1; i < len(numbers); i++ {
+		iv := interval{from: numbers[i-1], to: numbers[i], points: stat.delta(numbers[i-1], numbers[i])}
+		for _, dp := range iv.points {
+			iv.total += dp.execTime
+		}
+		intervals = append(intervals, iv)
+	}
+	sort.SliceStable(intervals, func(i, j int) bool {
+		return intervals[i].total > intervals[j].total
+	})
+	if len(intervals) > n {
+		intervals = intervals[:n]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nIntervals with the most EVM time\n")
+	fmt.Fprintf(tw, "BLOCKS\tTIME\tPER BLOCK\tDOMINANT OPCODES\t\n")
+	for _, iv := range intervals {
+		sort.Slice(iv.points, func(i, j int) bool {
+			return iv.points[i].execTime > iv.points[j].execTime
+		})
+		var dominant []string
+		for k, dp := range iv.points {
+			if k == dominantOps || iv.total == 0 {
+				break
+			}
+			dominant = append(dominant, fmt.Sprintf("%v %.0f%%", opName(dp.op), 100*float64(dp.execTime)/float64(iv.total)))
+		}
+		fmt.Fprintf(tw, "%d-%d\t%v\t%v\t%v\t\n", iv.from, iv.to, iv.total,
+			iv.total/time.Duration(iv.to-iv.from), strings.Join(dominant, ", "))
+	}
+	tw.Flush()
+}
+
+// printCoverage writes the block range covered by the collection to w, along
+// with the usual snapshot interval and any gaps and counter resets.
+func printCoverage(w io.Writer, stat statCollection) {
+	numbers := stat.numbers()
+	if len(numbers) == 0 {
+		fmt.Fprintf(w, "No data\n")
+		return
+	}
+	fmt.Fprintf(w, "Coverage: blocks %d to %d, %d snapshots, every %d blocks\n",
+		numbers[0], numbers[len(numbers)-1], len(numbers), stat.interval())
+	gaps := stat.gaps(*maxIntervalFlag)
+	if len(gaps) == 0 {
+		fmt.Fprintf(w, "No gaps\n")
+	}
+	for _, g := range gaps {
+		reason := "missing data"
+		if stat.resets[g.to] {
+			reason = "counter reset"
+		}
+		fmt.Fprintf(w, "  gap: blocks %d to %d (%d blocks, %v)\n", g.from, g.to, g.to-g.from, reason)
+	}
+	if len(stat.skipped) > 0 {
+		fmt.Fprintf(w, "%d input files skipped\n", len(stat.skipped))
+	}
+}
+
+// printGroupSummary writes a table to w with the totals of every opcode group
+// in the given block range, ordered by time spent.
+func printGroupSummary(w io.Writer, stat statCollection, start, end int, groups map[string][]vm.OpCode) {
+	type total struct {
+		name  string
+		count uint64
+		time  time.Duration
+		gas   uint64
+	}
+	points := make(map[vm.OpCode]*dataPoint)
+	for _, dp := range stat.delta(start, end) {
+		points[dp.op] = dp
+	}
+	var totals []total
+	for name, ops := range groups {
+		t := total{name: name}
+		for _, op := range ops {
+			if dp := points[op]; dp != nil {
+				t.count += dp.count
+				t.time += dp.execTime
+				t.gas += dp.totalGas()
+			}
+		}
+		totals = append(totals, t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].time != totals[j].time {
+			return totals[i].time > totals[j].time
+		}
+		return totals[i].name < totals[j].name
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nBlocks %d to %d - opcode groups\n", start, end)
+	fmt.Fprintf(tw, "GROUP\tOPCODES\tCOUNT\tTIME\tMS/MGAS\t\n")
+	for _, t := range totals {
+		perMgas := float64(0)
+		if t.gas > 0 {
+			perMgas = float64(t.time) / float64(t.gas)
+		}
+		fmt.Fprintf(tw, "%v\t%d\t%d\t%v\t%.2f\t\n", t.name, len(groups[t.name]), t.count, t.time, perMgas)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// fixResets detects counter resets, which happen when the instrumented node is
+// restarted mid-run: the cumulative meters start over from zero, so a later
+// snapshot has lower counts than an earlier one.
+//
+// The segments are stitched together by adding the last values before the
+// reset to all later snapshots, which keeps the counters monotonic. The
+// interval spanning a reset only covers the blocks since the restart, so it is
+// left out of the series. The block numbers of the resets are returned.
+func (stats *statCollection) fixResets() []int {
+	var (
+		s      stitcher
+		resets []int
+	)
+	for _, number := range stats.numbers() {
+		if s.stitch(stats, number) {
+			resets = append(resets, number)
+		}
+	}
+	if stats.resets == nil {
+		stats.resets = make(map[int]bool)
+	}
+	for _, number := range resets {
+		stats.resets[number] = true
+	}
+	return resets
+}
+
+// stitcher carries the reset offsets from one snapshot to the next.
+type stitcher struct {
+	off      [256]dataPoint // Counters at the end of the previous segment
+	rawCount [256]uint64
+	prev     map[vm.OpCode]*dataPoint
+}
+
+// stitch adds the offsets to the snapshot at the given block, which must be
+// later than all snapshots stitched before. It returns true if the counters
+// were reset since the previous snapshot.
+func (s *stitcher) stitch(stats *statCollection, number int) bool {
+	var (
+		snap  = stats.data[number]
+		reset bool
+	)
+	if s.prev != nil {
+		for op := 0; op < 256; op++ {
+			// Opcodes which have not been executed yet have no data point
+			var count uint64
+			if dp := snap[vm.OpCode(op)]; dp != nil {
+				count = dp.count
+			}
+			if count < s.rawCount[op] {
+				// Start the new segment where the previous one ended
+				s.off = [256]dataPoint{}
+				for op, dp := range s.prev {
+					s.off[op].add(dp)
+				}
+				reset = true
+				break
+			}
+		}
+	}
+	for op := 0; op < 256; op++ {
+		dp := snap[vm.OpCode(op)]
+		if dp == nil {
+			s.rawCount[op] = 0
+			if s.off[op].count == 0 && s.off[op].execTime == 0 {
+				continue
+			}
+			dp = stats.point(number, vm.OpCode(op))
+			snap[vm.OpCode(op)] = dp
+		}
+		s.rawCount[op] = dp.count
+		dp.add(&s.off[op])
+	}
+	s.prev = snap
+	return reset
+}
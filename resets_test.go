@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// writeResetRun writes a run with a snapshot every 100 blocks up to block
+// 1200, whose node restarted before block 800, so that the counters start
+// over there.
+func writeResetRun(t *testing.T) string {
+	dir := t.TempDir()
+	for number := 100; number <= 1200; number += 100 {
+		n := uint64(number / 100)
+		if number >= 800 {
+			n -= 7
+		}
+		var m [256]opMeter
+		m[vm.ADD] = opMeter{Num: 1000 * n, Time: time.Duration(n) * time.Millisecond}
+		m[vm.SLOAD] = opMeter{Num: 10 * n, Time: time.Duration(n) * 5 * time.Millisecond}
+		if _, err := writeMetrics(dir, number, m, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFixResets(t *testing.T) {
+	setFlags(t, map[string]string{"cache": "", "chunk": "0"})
+	stat, err := readStats(context.Background(), writeResetRun(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range stat.numbers() {
+		if want := number == 800; stat.resets[number] != want {
+			t.Errorf("block %d: reset %v, want %v", number, stat.resets[number], want)
+		}
+	}
+	// The counters carry on from the 7000 executions before the reset
+	if got := stat.data[800][vm.ADD].count; got != 8000 {
+		t.Errorf("stitched count at block 800: %d, want 8000", got)
+	}
+	if got := stat.data[1200][vm.ADD].count; got != 12000 {
+		t.Errorf("stitched count at block 1200: %d, want 12000", got)
+	}
+}
+
+// TestChunkedResets loads the same run with and without chunks, and checks
+// that the chunks keep the stitched counters, and mark the interval spanning
+// the reset.
+func TestChunkedResets(t *testing.T) {
+	dir := writeResetRun(t)
+	setFlags(t, map[string]string{"cache": "", "chunk": "0"})
+	full, err := readStats(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFlags(t, map[string]string{"chunk": "300"})
+	chunked, err := readStats(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbers := chunked.numbers()
+	if len(numbers) != 4 {
+		t.Fatalf("chunked snapshots: %v, want the last of every chunk", numbers)
+	}
+	prev := 0
+	for _, number := range numbers {
+		for _, op := range []vm.OpCode{vm.ADD, vm.SLOAD} {
+			want, got := full.data[number][op], chunked.data[number][op]
+			if got == nil || got.count != want.count || got.execTime != want.execTime {
+				t.Errorf("block %d, %v: chunked %+v, want %+v", number, op, got, want)
+			}
+		}
+		var spans bool
+		for _, n := range full.numbers() {
+			if n > prev && n <= number && full.resets[n] {
+				spans = true
+			}
+		}
+		if chunked.resets[number] != spans {
+			t.Errorf("block %d: reset %v, want %v", number, chunked.resets[number], spans)
+		}
+		prev = number
+	}
+}
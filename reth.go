@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// rethDump is a dump of the opcode statistics of revm, as collected by reth,
+// cumulative since the start of the node. The opcodes are identified by their
+// value, the names are informational:
+//
+//	{"block": 4760000, "opcodes": [{"opcode": 1, "name": "ADD", "count": 12, "time_ns": 3400}, ...]}
+type rethDump struct {
+	Block   int `json:"block"`
+	Opcodes []struct {
+		Opcode int    `json:"opcode"`
+		Name   string `json:"name"`
+		Count  uint64 `json:"count"`
+		TimeNs int64  `json:"time_ns"`
+	} `json:"opcodes"`
+}
+
+// parseReth decodes a revm/reth dump.
+func parseReth(r io.Reader) ([256]opMeter, int, error) {
+	var (
+		m    [256]opMeter
+		dump rethDump
+	)
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return m, 0, fmt.Errorf("invalid reth metrics: %v", err)
+	}
+	for _, stat := range dump.Opcodes {
+		if stat.Opcode < 0 || stat.Opcode > 0xff {
+			return m, 0, fmt.Errorf("invalid reth metrics: opcode %d out of range", stat.Opcode)
+		}
+		// Like for the named formats, opcodes unknown to go-ethereum are ignored
+		if op := vm.OpCode(stat.Opcode); definedOp(op) {
+			m[op] = opMeter{Num: stat.Count, Time: time.Duration(stat.TimeNs)}
+		}
+	}
+	return m, dump.Block, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var (
+	runMetaFlag   = flag.String("run-meta", "", "Metadata file of the run (defaults to run.json in the metrics directory)")
+	normalizeFlag = flag.Bool("normalize", false, "Scale the measured times of each run by the hardware factor in its metadata")
+)
+
+// runMeta describes the setup of a run. It is read from a JSON file next to
+// the metrics, and stamped on the charts and reports of the run.
+type runMeta struct {
+	Name     string `json:"name,omitempty"`     // Defaults to the directory name
+	Instance string `json:"instance,omitempty"` // E.g. "m5d.2xlarge"
+	CPU      string `json:"cpu,omitempty"`
+	Disk     string `json:"disk,omitempty"`
+	Geth     string `json:"geth,omitempty"`  // Version of geth
+	Flags    string `json:"flags,omitempty"` // Cache flags, e.g. "--cache 4096"
+	Chain    string `json:"chain,omitempty"` // Defaults to "mainnet", whose gas limit history is known
+
+	// Factor is the speed of the hardware relative to a reference machine, as
+	// measured by a reference benchmark: 2 means twice as fast. Normalizing
+	// multiplies the measured times by it, so runs on different hardware can be
+	// compared.
+	Factor float64 `json:"factor,omitempty"`
+
+	normalized bool // Whether the times of the run were normalized
+}
+
+// stamp returns a one-line description of the setup, or "" if nothing but the
+// name is known.
+func (m runMeta) stamp() string {
+	var parts []string
+	for _, s := range []string{m.Instance, m.CPU, m.Disk} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if m.Geth != "" {
+		parts = append(parts, "geth "+m.Geth)
+	}
+	if m.Flags != "" {
+		parts = append(parts, m.Flags)
+	}
+	if m.normalized {
+		parts = append(parts, fmt.Sprintf("times normalized by x%.2f", m.Factor))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (m runMeta) String() string {
+	if s := m.stamp(); s != "" {
+		return fmt.Sprintf("%v (%v)", m.Name, s)
+	}
+	return m.Name
+}
+
+// loadRunMeta reads the metadata of the run with metrics in src: the file given
+// with --run-meta, or run.json if src is a local directory. Without either,
+// only the given name is known.
+func loadRunMeta(src, name string) (runMeta, error) {
+	if *runMetaFlag != "" {
+		return readRunMeta(*runMetaFlag, name)
+	}
+	return dirRunMeta(src, name)
+}
+
+// dirRunMeta reads the run.json in src, ignoring --run-meta. It is used where
+// several runs are loaded at once.
+func dirRunMeta(src, name string) (runMeta, error) {
+	if src == "" || src == "-" || isRemote(src) || isObjectStore(src) || isArchive(src) {
+		return runMeta{Name: name}, nil
+	}
+	meta, err := readRunMeta(filepath.Join(src, "run.json"), name)
+	if os.IsNotExist(err) {
+		return runMeta{Name: name}, nil
+	}
+	return meta, err
+}
+
+func readRunMeta(path, name string) (runMeta, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return runMeta{}, err
+	}
+	var meta runMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return runMeta{}, fmt.Errorf("invalid run metadata %v: %v", path, err)
+	}
+	if meta.Name == "" {
+		meta.Name = name
+	}
+	return meta, nil
+}
+
+// normalize scales the measured times of the run, those of the sub-meters and
+// those of the transactions, by its hardware factor, if --normalize is set.
+func (m *runMeta) normalize(stat *statCollection) error {
+	if !*normalizeFlag {
+		return nil
+	}
+	if m.Factor <= 0 {
+		return fmt.Errorf("run %v has no hardware factor to normalize by", m.Name)
+	}
+	for _, points := range stat.data {
+		for _, dp := range points {
+			dp.execTime = time.Duration(float64(dp.execTime) * m.Factor)
+			for _, sp := range dp.sub {
+				sp.execTime = time.Duration(float64(sp.execTime) * m.Factor)
+			}
+		}
+	}
+	for _, txs := range stat.txs {
+		for _, tx := range txs {
+			scaleMeters(tx.meters, m.Factor)
+			for _, meters := range tx.contracts {
+				scaleMeters(meters, m.Factor)
+			}
+		}
+	}
+	m.normalized = true
+	return nil
+}
+
+// scaleMeters scales the times of the meters, and of their sub-meters, by the
+// factor, in place.
+func scaleMeters(meters map[vm.OpCode]opMeter, factor float64) {
+	for op, om := range meters {
+		om.Time = time.Duration(float64(om.Time) * factor)
+		if len(om.Sub) > 0 {
+			sub := make(map[string]opMeter, len(om.Sub))
+			for name, sm := range om.Sub {
+				sm.Time = time.Duration(float64(sm.Time) * factor)
+				sub[name] = sm
+			}
+			om.Sub = sub
+		}
+		meters[op] = om
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestNormalize(t *testing.T) {
+	setFlags(t, map[string]string{"normalize": "true"})
+	stat := newStatCollection()
+	stat.data[100] = map[vm.OpCode]*dataPoint{
+		vm.SLOAD: {op: vm.SLOAD, blockNumber: 100, count: 10, execTime: 1000, sub: map[string]*dataPoint{
+			"cold": {op: vm.SLOAD, blockNumber: 100, count: 2, execTime: 600},
+		}},
+	}
+	shared := map[string]opMeter{"cold": {Num: 1, Time: 300}}
+	stat.txs = map[int][]txStat{100: {{
+		block:  100,
+		meters: map[vm.OpCode]opMeter{vm.SLOAD: {Num: 5, Time: 500, Sub: shared}},
+		contracts: map[string]map[vm.OpCode]opMeter{
+			"0xaa": {vm.SLOAD: {Num: 5, Time: 400}},
+		},
+	}}}
+	meta := runMeta{Name: "test", Factor: 2}
+	if err := meta.normalize(&stat); err != nil {
+		t.Fatal(err)
+	}
+	dp := stat.data[100][vm.SLOAD]
+	if dp.execTime != 2000 || dp.sub["cold"].execTime != 1200 {
+		t.Errorf("snapshot times %v and %v, want 2000 and 1200", dp.execTime, dp.sub["cold"].execTime)
+	}
+	tx := stat.txs[100][0]
+	if got := tx.meters[vm.SLOAD].Time; got != 1000 {
+		t.Errorf("tx time %v, want 1000", got)
+	}
+	if got := tx.meters[vm.SLOAD].Sub["cold"].Time; got != 600 {
+		t.Errorf("tx sub-meter time %v, want 600", got)
+	}
+	if got := tx.contracts["0xaa"][vm.SLOAD].Time; got != 800 {
+		t.Errorf("contract time %v, want 800", got)
+	}
+	if got := shared["cold"].Time; got != time.Duration(300) {
+		t.Errorf("shared sub-meters were modified: %v", got)
+	}
+	if !meta.normalized {
+		t.Error("run not marked as normalized")
+	}
+
+	if err := (&runMeta{Name: "nofactor"}).normalize(&stat); err == nil {
+		t.Error("normalized a run without a hardware factor")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// runtimeStats are the Go runtime metrics of the node at a snapshot, named like
+// in runtime.MemStats. The GC pauses are cumulative, like the meters.
+type runtimeStats struct {
+	PauseTotalNs uint64 // Total time of the GC pauses since the node started
+	HeapAlloc    uint64 // Bytes allocated on the heap
+}
+
+// dumpExtras is what a metrics file holds besides its meters.
+type dumpExtras struct {
+	txs     []txMeters    // Meters of the transactions, with --per-tx
+	runtime *runtimeStats // Runtime metrics of the node, if dumped
+}
+
+// collectRuntime adds the runtime metrics of the snapshot at blnum.
+func (stats *statCollection) collectRuntime(blnum int, rt runtimeStats) {
+	if stats.runtime == nil {
+		stats.runtime = make(map[int]runtimeStats)
+	}
+	stats.runtime[blnum] = rt
+}
+
+// runtimeSeries are the system metrics derived from the runtime metrics of the
+// last collection they were added for, by name.
+var runtimeSeries = make(map[string]*sysSeries)
+
+// addRuntimeMetrics makes the runtime metrics of the collection available as
+// system metrics, to be overlaid on the line charts: gcpause, the milliseconds
+// of GC pauses per block over the interval ending at each snapshot, and heap,
+// the megabytes allocated on the heap. GC pressure during a sync slows down all
+// opcodes alike, which the overlay shows. Intervals spanning a restart of the
+// node, where the pauses start over, are left out. Loading a system metric of
+// the same name with --sysmetrics as well is an error.
+func addRuntimeMetrics(stat statCollection) error {
+	if len(stat.runtime) == 0 {
+		return nil
+	}
+	// With --chunk, there are runtime metrics for more snapshots than are kept
+	var (
+		pauses, heap = new(sysSeries), new(sysSeries)
+		numbers      []int
+		prev         = -1
+	)
+	for number := range stat.runtime {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		rt := stat.runtime[number]
+		heap.blocks = append(heap.blocks, float64(number))
+		heap.values = append(heap.values, float64(rt.HeapAlloc)/(1024*1024))
+		if last, ok := stat.runtime[prev]; ok && rt.PauseTotalNs >= last.PauseTotalNs && !stat.resets[number] {
+			pauses.blocks = append(pauses.blocks, float64(number))
+			pauses.values = append(pauses.values, float64(rt.PauseTotalNs-last.PauseTotalNs)/1e6/float64(number-prev))
+		}
+		prev = number
+	}
+	if sysMetrics == nil {
+		sysMetrics = make(map[string]*sysSeries)
+	}
+	for name, s := range map[string]*sysSeries{"gcpause": pauses, "heap": heap} {
+		if existing := sysMetrics[name]; existing != nil && existing != runtimeSeries[name] {
+			return fmt.Errorf("system metric %q is defined twice, it is read from the runtime metrics as well", name)
+		}
+		sysMetrics[name], runtimeSeries[name] = s, s
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Supported versions of the metrics dump schema.
+//
+// Version 1 is a bare JSON array of 256 meters, indexed by opcode:
+//
+//	[{"Num": 0, "Time": 0}, {"Num": 12, "Time": 3400}, ...]
+//
+// Version 2 wraps the same array in an object, which carries the schema
+// version and the block number of the snapshot:
+//
+//	{"version": 2, "block": 4760000, "meters": [{"Num": 0, "Time": 0}, ...]}
+//
+// Version 2 and 3 may carry the Go runtime metrics of the node at the snapshot,
+// named like in runtime.MemStats:
+//
+//	"runtime": {"PauseTotalNs": 812345678, "HeapAlloc": 2147483648}
+//
+// Instead of an array, the meters may be an object keyed by opcode name, as
+// dumped by some instrumented builds, either bare or as the meters of version 2
+// or 3. Opcodes which are left out were not executed:
+//
+//	{"SLOAD": {"Num": 12, "Time": 3400}, "ADD": {"Num": 200, "Time": 1600}}
+//
+// The layout is detected per file, so dumps of different builds can be loaded
+// together.
+//
+// In any version, a meter may break its executions down by regime, e.g. for
+// the storage accesses of SLOAD:
+//
+//	{"Num": 12, "Time": 3400, "Sub": {"warm": {"Num": 10, "Time": 900}, "cold": {"Num": 2, "Time": 2500}}}
+//
+// Version 3 adds the meters of the individual transactions executed since the
+// previous snapshot, which are not cumulative, and keyed by opcode name:
+//
+//	{"version": 3, "block": 4760000, "meters": [...], "txs": [
+//		{"block": 4759001, "index": 0, "hash": "0x...", "meters": {"SLOAD": {"Num": 3, "Time": 1200}}}, ...]}
+//
+// The meters of a transaction may also be broken down by the executing
+// contract, in the same form:
+//
+//	"contracts": {"0x06012c8cf97bead5deae237070f9587f8e7a266d": {"SLOAD": {"Num": 2, "Time": 900}}, ...}
+const (
+	schemaV1 = 1
+	schemaV2 = 2
+	schemaV3 = 3
+)
+
+// truncatedError is the error of a dump which ends early, e.g. because the node
+// crashed while writing it. If all meters were read before the end, the
+// snapshot is complete and can be salvaged, only its transactions may be lost.
+type truncatedError struct {
+	complete bool // Whether all meters were read
+}
+
+func (e *truncatedError) Error() string {
+	if e.complete {
+		return "truncated metrics file, after the meters"
+	}
+	return "truncated metrics file"
+}
+
+// cutOff returns a truncatedError if err is due to the end of the input, and
+// err itself otherwise. Depending on where the input ends, the decoder reports
+// an EOF or a syntax error.
+func cutOff(err error, complete bool) error {
+	if se, ok := err.(*json.SyntaxError); ok && se.Error() == "unexpected end of JSON input" {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &truncatedError{complete}
+	}
+	return err
+}
+
+// txMeters are the meters of one transaction, see schema version 3.
+type txMeters struct {
+	Block  int                `json:"block"`
+	Index  int                `json:"index"`
+	Hash   string             `json:"hash,omitempty"`
+	Meters map[string]opMeter `json:"meters"`
+
+	Contracts map[string]map[string]opMeter `json:"contracts,omitempty"` // By executing contract, if known
+}
+
+// toMeters checks that there is exactly one meter per opcode.
+func toMeters(list []opMeter) ([256]opMeter, error) {
+	var m [256]opMeter
+	if len(list) != len(m) {
+		return m, fmt.Errorf("expected %d meters, got %d", len(m), len(list))
+	}
+	copy(m[:], list)
+	return m, nil
+}
+
+// parseMeters decodes a metrics dump of any supported schema version. The dump
+// is decoded meter by meter, so it is never held in memory as a whole. The
+// returned block number is zero if the dump does not contain one.
+func parseMeters(r io.Reader) ([256]opMeter, int, error) {
+	m, block, _, err := parseSnapshot(r, false)
+	return m, block, err
+}
+
+// parseSnapshot decodes a metrics dump like parseMeters, along with the runtime
+// metrics of the node, and the meters of its transactions if withTxs is set.
+// Otherwise, they are skipped.
+func parseSnapshot(r io.Reader, withTxs bool) ([256]opMeter, int, dumpExtras, error) {
+	var x dumpExtras
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return [256]opMeter{}, 0, x, fmt.Errorf("empty metrics file")
+	}
+	switch {
+	case err == nil && tok == json.Delim('['):
+		m, err := decodeMeters(dec)
+		if _, ok := err.(*truncatedError); ok {
+			return m, 0, x, err
+		}
+		if err != nil {
+			return m, 0, x, fmt.Errorf("invalid v%d metrics: %v", schemaV1, err)
+		}
+		return m, 0, x, nil
+	case err == nil && tok == json.Delim('{'):
+		m, block, err := decodeObject(dec, withTxs, &x)
+		return m, block, x, err
+	}
+	return [256]opMeter{}, 0, x, fmt.Errorf("unrecognized metrics format, expected a JSON array (v%d) or object (v%d, v%d, or meters by opcode name)",
+		schemaV1, schemaV2, schemaV3)
+}
+
+// decodeMeters decodes the elements of a meter array, following its opening
+// bracket.
+func decodeMeters(dec *json.Decoder) ([256]opMeter, error) {
+	var (
+		m [256]opMeter
+		n int
+	)
+	for ; n < len(m) && dec.More(); n++ {
+		if err := dec.Decode(&m[n]); err != nil {
+			return m, cutOff(err, false)
+		}
+	}
+	tok, err := dec.Token()
+	switch {
+	case err != nil:
+		return m, cutOff(err, n == len(m))
+	case tok != json.Delim(']'):
+		return m, fmt.Errorf("expected %d meters, got more", len(m))
+	case n != len(m):
+		return m, fmt.Errorf("expected %d meters, got %d", len(m), n)
+	}
+	return m, nil
+}
+
+// decodeNamedMeters decodes the meters of an object keyed by opcode name, up to
+// and including its closing brace. The meters of any opcodes which came before
+// must already be in m.
+func decodeNamedMeters(dec *json.Decoder, m *[256]opMeter) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return cutOff(err, false)
+		}
+		if err := decodeNamedMeter(dec, m, tok.(string)); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return cutOff(err, false)
+}
+
+// decodeNamedMeter decodes the meter of the opcode with the given name.
+func decodeNamedMeter(dec *json.Decoder, m *[256]opMeter, name string) error {
+	op, ok := lookupOp(strings.ToUpper(name))
+	if !ok {
+		return fmt.Errorf("unknown opcode %q", name)
+	}
+	return cutOff(dec.Decode(&m[op]), false)
+}
+
+// decodeObject decodes the fields of a version 2 or 3 object, following its
+// opening brace, and stores the transactions and the runtime metrics in x. The
+// fields may come in any order. If the object is cut off after its meters,
+// they are returned with a truncatedError, and x holds what was read in full.
+func decodeObject(dec *json.Decoder, withTxs bool, x *dumpExtras) ([256]opMeter, int, error) {
+	var (
+		m              [256]opMeter
+		version, block int
+		hasTxs         bool
+		fields         bool  // Whether any field of version 2 or 3 was read
+		metersErr      error = fmt.Errorf("expected %d meters, got 0", len(m))
+	)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err == nil {
+			switch key := tok.(string); key {
+			case "version":
+				err = dec.Decode(&version)
+			case "block":
+				err = dec.Decode(&block)
+			case "meters":
+				tok, err = dec.Token()
+				switch {
+				case err != nil:
+				case tok == json.Delim('['):
+					m, metersErr = decodeMeters(dec)
+				case tok == json.Delim('{'):
+					metersErr = decodeNamedMeters(dec, &m)
+				default:
+					err = fmt.Errorf("meters is neither an array nor an object")
+				}
+			case "runtime":
+				x.runtime = new(runtimeStats)
+				err = dec.Decode(x.runtime)
+			case "txs":
+				hasTxs = true
+				if withTxs {
+					err = dec.Decode(&x.txs)
+				} else {
+					var skip json.RawMessage
+					err = dec.Decode(&skip)
+				}
+			default:
+				if _, ok := lookupOp(strings.ToUpper(key)); ok && !fields {
+					// Bare meters by opcode name, without the fields around them
+					err := decodeNamedMeter(dec, &m, key)
+					if err == nil {
+						err = decodeNamedMeters(dec, &m)
+					}
+					if _, ok := err.(*truncatedError); ok {
+						return m, 0, err
+					}
+					if err != nil {
+						return m, 0, fmt.Errorf("invalid metrics by opcode name: %v", err)
+					}
+					return m, 0, nil
+				}
+				err = fmt.Errorf("unknown field %q", key)
+			}
+			fields = true
+		}
+		if cut, ok := cutOff(err, false).(*truncatedError); ok {
+			cut.complete = metersErr == nil && (version == schemaV2 || version == schemaV3)
+			switch tok {
+			case "txs":
+				x.txs = nil // Cut off within the transactions
+			case "runtime":
+				x.runtime = nil
+			}
+			return m, block, cut
+		}
+		if err != nil {
+			return m, 0, fmt.Errorf("invalid metrics object: %v", err)
+		}
+	}
+	// A dump cut off between two fields lacks the closing brace
+	_, err := dec.Token()
+	cut, truncated := cutOff(err, false).(*truncatedError)
+	if _, ok := metersErr.(*truncatedError); ok {
+		return m, 0, metersErr
+	}
+	switch {
+	case truncated && version != schemaV2 && version != schemaV3:
+		return m, 0, cut
+	case version == 0:
+		return m, 0, fmt.Errorf("metrics object has no version field")
+	case version == schemaV2 && hasTxs:
+		return m, 0, fmt.Errorf("v%d metrics have no transactions, they were added in v%d", schemaV2, schemaV3)
+	case version != schemaV2 && version != schemaV3:
+		return m, 0, fmt.Errorf("unsupported schema version %d (supported: %d, %d, %d)",
+			version, schemaV1, schemaV2, schemaV3)
+	}
+	if metersErr != nil {
+		return m, 0, fmt.Errorf("invalid v%d metrics: %v", version, metersErr)
+	}
+	if truncated {
+		cut.complete = true
+		return m, block, cut
+	}
+	return m, block, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// meterArray returns the JSON array of 256 meters, with the given meters set
+// and the others zero.
+func meterArray(t *testing.T, set map[vm.OpCode]opMeter) string {
+	t.Helper()
+	list := make([]opMeter, 256)
+	for op, m := range set {
+		list[op] = m
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseSnapshot(t *testing.T) {
+	var (
+		set    = map[vm.OpCode]opMeter{vm.ADD: {Num: 200, Time: 1600}, vm.SLOAD: {Num: 12, Time: 3400}}
+		meters = meterArray(t, set)
+		named  = `{"SLOAD": {"Num": 12, "Time": 3400}, "add": {"Num": 200, "Time": 1600}}`
+		txs    = `[{"block": 99, "index": 0, "meters": {"SLOAD": {"Num": 3, "Time": 1200}}}]`
+	)
+	tests := []struct {
+		name     string
+		input    string
+		block    int
+		txs      int
+		err      string
+		complete bool // Whether a truncated dump has all its meters
+	}{
+		{name: "v1", input: meters},
+		{name: "v2", input: `{"version": 2, "block": 100, "meters": ` + meters + `}`, block: 100},
+		{name: "v2 fields reordered", input: `{"meters": ` + meters + `, "block": 100, "version": 2}`, block: 100},
+		{name: "v2 named", input: `{"version": 2, "block": 100, "meters": ` + named + `}`, block: 100},
+		{name: "v3", input: `{"version": 3, "block": 100, "meters": ` + meters + `, "txs": ` + txs + `}`, block: 100, txs: 1},
+		{name: "v3 runtime", input: `{"version": 3, "block": 100, "meters": ` + meters + `, "runtime": {"HeapAlloc": 1}}`, block: 100},
+		{name: "named", input: named},
+		{name: "empty", input: "", err: "empty metrics file"},
+		{name: "garbage", input: `"metrics"`, err: "unrecognized metrics format"},
+		{name: "v1 short", input: meterArray(t, nil)[:len("[")+len(`{"Num":0,"Time":0}`)] + "]", err: "expected 256 meters, got 1"},
+		{name: "no version", input: `{"block": 100, "meters": ` + meters + `}`, err: "no version field"},
+		{name: "v4", input: `{"version": 4, "block": 100, "meters": ` + meters + `}`, err: "unsupported schema version 4"},
+		{name: "v2 txs", input: `{"version": 2, "block": 100, "meters": ` + meters + `, "txs": ` + txs + `}`, err: "v2 metrics have no transactions"},
+		{name: "v2 no meters", input: `{"version": 2, "block": 100}`, err: "expected 256 meters, got 0"},
+		{name: "unknown field", input: `{"version": 2, "block": 100, "extra": 1, "meters": ` + meters + `}`, err: `unknown field "extra"`},
+		{name: "unknown opcode", input: `{"SLOAD": {"Num": 12, "Time": 3400}, "NOSUCHOP": {}}`, err: `unknown opcode "NOSUCHOP"`},
+		{name: "v1 truncated", input: meters[:100], err: "truncated metrics file"},
+		{name: "v2 truncated in meters", input: `{"version": 2, "block": 100, "meters": ` + meters[:100], err: "truncated metrics file"},
+		{name: "v2 truncated after meters", input: `{"version": 2, "block": 100, "meters": ` + meters, block: 100, err: "truncated metrics file, after the meters", complete: true},
+		{name: "v3 truncated in txs", input: `{"version": 3, "block": 100, "meters": ` + meters + `, "txs": ` + txs[:20], block: 100, err: "truncated metrics file, after the meters", complete: true},
+	}
+	for _, tt := range tests {
+		m, block, x, err := parseSnapshot(strings.NewReader(tt.input), true)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+				continue
+			}
+			cut, truncated := err.(*truncatedError)
+			if truncated && cut.complete != tt.complete {
+				t.Errorf("%s: complete %v, want %v", tt.name, cut.complete, tt.complete)
+			}
+			if !tt.complete {
+				continue
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if block != tt.block {
+			t.Errorf("%s: block %d, want %d", tt.name, block, tt.block)
+		}
+		if len(x.txs) != tt.txs {
+			t.Errorf("%s: %d transactions, want %d", tt.name, len(x.txs), tt.txs)
+		}
+		for op := range m {
+			if want := set[vm.OpCode(op)]; m[op].Num != want.Num || m[op].Time != want.Time {
+				t.Errorf("%s: %v meter %+v, want %+v", tt.name, vm.OpCode(op), m[op], want)
+			}
+		}
+	}
+}
+
+// TestParseMetersSkipsTxs checks that the transactions of a v3 dump are only
+// decoded when asked for.
+func TestParseMetersSkipsTxs(t *testing.T) {
+	input := `{"version": 3, "block": 100, "meters": ` + meterArray(t, nil) + `, "txs": [{"block": 99, "meters": {}}]}`
+	if _, _, x, err := parseSnapshot(strings.NewReader(input), false); err != nil || x.txs != nil {
+		t.Errorf("got transactions %v, error %v", x.txs, err)
+	}
+	if _, block, err := parseMeters(strings.NewReader(input)); err != nil || block != 100 {
+		t.Errorf("got block %d, error %v", block, err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	metricsURLFlag     = flag.String("metrics-url", "http://localhost:6060/debug/metrics", "Metrics endpoint of the geth node to scrape")
+	scrapeIntervalFlag = flag.Duration("scrape-interval", time.Minute, "Interval between the scrapes of the metrics endpoint")
+	renderEveryFlag    = flag.Int("render-every", 10, "Render the chart suite every this many scrapes while scraping (0 = never)")
+)
+
+// opTimerPrefix is the prefix of the per-opcode timers in geth's metrics.
+const opTimerPrefix = "vm/op/"
+
+// scrapeMeters fetches the metrics of a geth node, and returns the meters of
+// the vm/op/* timers. The endpoint lists the count and the mean time of every
+// timer, in nanoseconds:
+//
+//	{"vm/op/ADD.count": 12, "vm/op/ADD.mean": 283.3, ...}
+//
+// The total time is taken from a ".sum" entry if there is one, and estimated
+// as the mean times the count otherwise. The mean is that of a sample, so the
+// estimate is only as good as the sample is representative.
+func scrapeMeters(ctx context.Context, url string) ([256]opMeter, error) {
+	var m [256]opMeter
+	body, _, err := fetch(ctx, url)
+	if err != nil {
+		return m, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return m, fmt.Errorf("invalid metrics from %v: %v", url, err)
+	}
+	value := func(key string) (float64, bool) {
+		v, ok := values[key].(float64)
+		return v, ok
+	}
+	var found bool
+	for key := range values {
+		if !strings.HasPrefix(key, opTimerPrefix) || !strings.HasSuffix(key, ".count") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, opTimerPrefix), ".count")
+		om := meterOp(&m, name)
+		if om == nil {
+			continue
+		}
+		timerMeter(om, opTimerPrefix+name, value)
+		found = true
+	}
+	if !found {
+		return m, fmt.Errorf("no %v* timers at %v, is geth running with --metrics?", opTimerPrefix, url)
+	}
+	return m, nil
+}
+
+// blockNumber returns the current block of the node.
+func (c *rpcClient) blockNumber(ctx context.Context) (int, error) {
+	var hex string
+	if err := c.call(ctx, &hex, "eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(strings.TrimPrefix(hex, "0x"), 16, 64)
+	return int(number), err
+}
+
+// scrapeCmd implements "vmstats scrape", which polls the metrics of a running
+// geth node, and adds a snapshot at the current block to a live collection on
+// every poll. The snapshots are written to --out as metrics files, and the
+// chart suite is rendered from the collection every --render-every polls, so
+// the charts follow the node. A restart of the node is handled like a counter
+// reset. With --webhook, the opcodes of --alert-ops are checked for
+// regressions on every poll. Scraping continues until interrupted.
+func scrapeCmd(ctx context.Context, suite chartSuite) {
+	if err := os.MkdirAll(*outFlag, 0755); err != nil {
+		fatal(exitFailure, "Failed to create output directory", "err", err)
+	}
+	var (
+		client  = &rpcClient{url: *rpcFlag}
+		lc      = newLiveCollection()
+		ticker  = time.NewTicker(*scrapeIntervalFlag)
+		scrapes int
+	)
+	defer ticker.Stop()
+
+	meta, err := loadRunMeta("", filepath.Base(*outFlag))
+	if err != nil {
+		fatal(exitUsage, "Failed to load run metadata", "err", err)
+	}
+	if *run != "" {
+		meta.Name = *run
+	}
+	var alerts *alerter
+	if *webhookFlag != "" {
+		ops, err := parseOps(strings.Split(*alertOpsFlag, ","))
+		if err != nil {
+			fatal(exitUsage, "Invalid alert opcodes", "err", err)
+		}
+		if *alertRatioFlag <= 1 || *alertWindowFlag < 1 {
+			fatal(exitUsage, "Invalid alert threshold", "ratio", *alertRatioFlag, "window", *alertWindowFlag)
+		}
+		alerts = newAlerter(*webhookFlag, *chartURLFlag, ops)
+	}
+
+	log.Info("Scraping metrics", "url", *metricsURLFlag, "rpc", *rpcFlag, "interval", *scrapeIntervalFlag)
+	for {
+		if err := scrapeOnce(ctx, client, lc); err != nil {
+			log.Warn("Failed to scrape metrics", "err", err)
+		} else {
+			scrapes++
+			if *renderEveryFlag > 0 && scrapes%*renderEveryFlag == 0 {
+				if err := suite.render(ctx, lc.snapshot(), meta); err != nil {
+					log.Warn("Failed to render charts", "err", err)
+				}
+				if err := writeManifest(); err != nil {
+					log.Warn("Failed to write manifest", "err", err)
+				}
+			}
+			if alerts != nil {
+				if err := alerts.check(ctx, lc.snapshot(), meta); err != nil {
+					log.Warn("Failed to alert on regressions", "err", err)
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Info("Stopped scraping", "scrapes", scrapes)
+			return
+		}
+	}
+}
+
+// scrapeOnce takes one snapshot. Snapshots at a block which was already
+// scraped are dropped, since the node has not progressed.
+func scrapeOnce(ctx context.Context, client *rpcClient, lc *liveCollection) error {
+	number, err := client.blockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := scrapeMeters(ctx, *metricsURLFlag)
+	if err != nil {
+		return err
+	}
+	if err := lc.collect(number, m); err != nil {
+		log.Debug("Dropping snapshot", "err", err)
+		return nil
+	}
+	path, err := writeMetrics(*outFlag, number, m, nil)
+	if err != nil {
+		return err
+	}
+	log.Info("Scraped metrics", "block", number, "file", path)
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+var sidecarFlag = flag.String("sidecar", "", "Write the plotted points and parameters of every chart next to it: csv or json (default none)")
+
+// sidecar holds the exact points of a chart, along with the parameters it was
+// rendered with, so that it can be verified and re-plotted independently.
+// Derived series, like moving averages, are left out, as they follow from the
+// points.
+type sidecar struct {
+	Chart  string          `json:"chart"`
+	Title  string          `json:"title"`
+	Params interface{}     `json:"params,omitempty"`
+	Series []sidecarSeries `json:"series"`
+}
+
+type sidecarSeries struct {
+	Name      string      `json:"name"`
+	Secondary bool        `json:"secondary,omitempty"` // Plotted on the secondary Y axis
+	X         []float64   `json:"x,omitempty"`
+	Labels    []string    `json:"labels,omitempty"` // Of bars and slices, instead of X
+	Y         []jsonFloat `json:"y"`
+}
+
+// jsonFloat is a float which is encoded as null if it isn't a number, such as
+// a missing correlation, which JSON can't represent otherwise.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func jsonFloats(vals []float64) []jsonFloat {
+	fs := make([]jsonFloat, len(vals))
+	for i, v := range vals {
+		fs[i] = jsonFloat(v)
+	}
+	return fs
+}
+
+// lineSidecar collects the continuous series of a line chart. The segments of
+// a series which was split at gaps are joined again, the vertical markers of
+// repricings are left out.
+func lineSidecar(graph chart.Chart, params interface{}) sidecar {
+	sc := sidecar{Title: graph.Title, Params: params}
+	for _, s := range graph.Series {
+		cs, ok := s.(chart.ContinuousSeries)
+		if !ok {
+			continue
+		}
+		if cs.Name == "" && len(cs.XValues) == 2 && cs.XValues[0] == cs.XValues[1] {
+			continue
+		}
+		if cs.Name == "" && len(sc.Series) > 0 {
+			last := &sc.Series[len(sc.Series)-1]
+			last.X = append(last.X, cs.XValues...)
+			last.Y = append(last.Y, jsonFloats(cs.YValues)...)
+			continue
+		}
+		sc.Series = append(sc.Series, sidecarSeries{
+			Name:      cs.Name,
+			Secondary: cs.YAxis == chart.YAxisSecondary,
+			X:         append([]float64(nil), cs.XValues...),
+			Y:         jsonFloats(cs.YValues),
+		})
+	}
+	return sc
+}
+
+// valuesSidecar collects the bars or slices of a chart as one series.
+func valuesSidecar(title, name string, values []chart.Value, params interface{}) sidecar {
+	s := sidecarSeries{Name: name}
+	for _, v := range values {
+		s.Labels = append(s.Labels, v.Label)
+		s.Y = append(s.Y, jsonFloat(v.Value))
+	}
+	return sidecar{Title: title, Params: params, Series: []sidecarSeries{s}}
+}
+
+// writeSidecar writes the sidecar of the chart at path, if --sidecar is set,
+// replacing the extension of the chart with that of the format, and records
+// the chart in the manifest.
+func writeSidecar(path string, sc sidecar) error {
+	sc.Chart = filepath.Base(path)
+	if *sidecarFlag == "" {
+		return recordArtifact(path, "", sc)
+	}
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "." + *sidecarFlag
+	if err := writeSidecarFile(out, sc); err != nil {
+		return err
+	}
+	return recordArtifact(path, out, sc)
+}
+
+// writeSidecarFile writes the sidecar in the format of --sidecar. A CSV
+// sidecar has one row per point, the parameters are left out.
+func writeSidecarFile(out string, sc sidecar) error {
+	switch *sidecarFlag {
+	case "json":
+		data, err := json.MarshalIndent(sc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("sidecar of %v: %v", sc.Chart, err)
+		}
+		return ioutil.WriteFile(out, append(data, '\n'), 0644)
+	case "csv":
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := csv.NewWriter(f)
+		w.Write([]string{"series", "x", "label", "y"})
+		for _, s := range sc.Series {
+			for i, y := range s.Y {
+				var x, label string
+				if i < len(s.X) {
+					x = strconv.FormatFloat(s.X[i], 'f', -1, 64)
+				}
+				if i < len(s.Labels) {
+					label = s.Labels[i]
+				}
+				w.Write([]string{s.Name, x, label, strconv.FormatFloat(float64(y), 'g', -1, 64)})
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fmt.Errorf("unknown sidecar format %q, expected csv or json", *sidecarFlag)
+}
+
+// checkSidecar validates the --sidecar format.
+func checkSidecar(format string) error {
+	switch format {
+	case "", "csv", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown sidecar format %q, expected csv or json", format)
+}
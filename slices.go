@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+var otherFlag = flag.Float64("pie-other", 1, "Merge the pie slices below this percentage of the total into one \"Other\" slice (0 = keep all)")
+
+// consolidate merges the values below the given percentage of the total into
+// a single "Other" value, labelled with the number of merged values, so the
+// pies don't drown in tiny slices with overlapping labels. The other values
+// keep their order. A lone small value is kept as is.
+func consolidate(values []chart.Value, percent float64) []chart.Value {
+	var total float64
+	for _, v := range values {
+		total += v.Value
+	}
+	if percent <= 0 || total <= 0 {
+		return values
+	}
+	var (
+		kept  []chart.Value
+		other chart.Value
+		small []chart.Value
+	)
+	for _, v := range values {
+		if 100*v.Value/total < percent {
+			small = append(small, v)
+			other.Value += v.Value
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if len(small) < 2 {
+		return values
+	}
+	other.Label = fmt.Sprintf("Other (%d)", len(small))
+	return append(kept, other)
+}
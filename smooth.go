@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var (
+	smoothFlag = flag.String("smooth", "", "Smoothing of every line chart: none, sma or ema (defaults to a SMA of single-opcode charts)")
+	windowFlag = flag.Int("window", 0, "Window of the smoothing, in data points (0 = the go-chart default)")
+	bandFlag   = flag.Float64("band", 0, "Shade a band of this many standard deviations around the moving average of single-opcode charts (0 = none)")
+)
+
+// Kinds of smoothing of the line charts.
+const (
+	smoothNone = "none"
+	smoothSMA  = "sma" // Simple moving average
+	smoothEMA  = "ema" // Exponential moving average
+)
+
+// checkSmoothing validates the smoothing of a chart. An empty kind is valid,
+// and selects the default, see smoothKind.
+func checkSmoothing(kind string, window int, band float64) error {
+	switch kind {
+	case "", smoothNone, smoothSMA, smoothEMA:
+	default:
+		return fmt.Errorf("unknown smoothing %q, expected %v, %v or %v", kind, smoothNone, smoothSMA, smoothEMA)
+	}
+	if window < 0 {
+		return fmt.Errorf("negative smoothing window %d", window)
+	}
+	if band < 0 {
+		return fmt.Errorf("negative band of %v standard deviations", band)
+	}
+	return nil
+}
+
+// smoothKind resolves the default smoothing: charts of a single opcode get a
+// simple moving average, others none, since the lines of several opcodes
+// would be hard to tell apart from their averages.
+func smoothKind(kind string, single bool) string {
+	if kind != "" {
+		return kind
+	}
+	if single {
+		return smoothSMA
+	}
+	return smoothNone
+}
+
+// smoothed returns the moving average of the series, drawn with the given
+// color, or nil if the kind is none.
+func smoothed(kind string, window int, inner chart.ContinuousSeries, style chart.Style) chart.Series {
+	name := fmt.Sprintf("Moving AVG %v", inner.Name)
+	switch kind {
+	case smoothSMA:
+		return chart.SMASeries{Name: name, Style: style, Period: window, InnerSeries: inner}
+	case smoothEMA:
+		return &chart.EMASeries{Name: name, Style: style, Period: window, InnerSeries: inner}
+	}
+	return nil
+}
+
+// deviationBand returns a shaded band of k standard deviations of the series
+// around its simple moving average, over the same window as the smoothing, so
+// the variance of the opcode can be read off the chart. Like the average, it
+// is drawn in the given color.
+func deviationBand(k float64, window int, inner chart.ContinuousSeries, color drawing.Color) chart.Series {
+	return &chart.BollingerBandsSeries{
+		Name:        fmt.Sprintf("±%vσ %v", k, inner.Name),
+		Period:      window,
+		K:           k,
+		InnerSeries: inner,
+		Style: chart.Style{
+			Show:        true,
+			StrokeColor: color.WithAlpha(64),
+			FillColor:   color.WithAlpha(32),
+		},
+	}
+}
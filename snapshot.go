@@ -0,0 +1,211 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var snapshotFlag = flag.String("snapshot", "", "Analysis snapshot file, written by vmstats save and charted instead of --dir otherwise")
+
+// snapshotVersion is bumped whenever the snapshot format changes. Unlike the
+// cache, snapshots are shared, so older versions are rejected with an error.
+const snapshotVersion = 1
+
+// analysisSnapshot is everything needed to chart a run without its metrics
+// files: the parsed collection, the metadata of the run and the chart suite.
+type analysisSnapshot struct {
+	Version   int
+	Run       runMeta
+	Suite     []byte // The chart suite, as JSON
+	Snapshots []cachedSnapshot
+	Resets    []int // Snapshots taken after a counter reset, already stitched
+	Txs       []snapshotTxs
+	Skipped   [][2]string          // Name and reason of the skipped files
+	Runtime   map[int]runtimeStats // Runtime metrics of the node, by block
+}
+
+// snapshotTxs is the transactions of the interval ending at one snapshot.
+type snapshotTxs struct {
+	Block int
+	Txs   []txMeters
+}
+
+// newSnapshot captures a loaded collection, after its resets are stitched but
+// before it is normalized, so that the normalization can be changed later.
+func newSnapshot(stat statCollection, run runMeta, suite chartSuite) (*analysisSnapshot, error) {
+	data, err := json.Marshal(suite)
+	if err != nil {
+		return nil, err
+	}
+	snap := &analysisSnapshot{Version: snapshotVersion, Run: run, Suite: data, Runtime: stat.runtime}
+	for _, number := range stat.numbers() {
+		meters := make([]opMeter, 256)
+		for op, dp := range stat.data[number] {
+			meters[op] = dp.meter()
+		}
+		snap.Snapshots = append(snap.Snapshots, cachedSnapshot{number, meters})
+		if stat.resets[number] {
+			snap.Resets = append(snap.Resets, number)
+		}
+		if len(stat.txs[number]) == 0 {
+			continue
+		}
+		st := snapshotTxs{Block: number}
+		for _, tx := range stat.txs[number] {
+			tm := txMeters{Block: tx.block, Index: tx.index, Hash: tx.hash, Meters: opMeters(tx.meters)}
+			if len(tx.contracts) > 0 {
+				tm.Contracts = make(map[string]map[string]opMeter, len(tx.contracts))
+				for addr, meters := range tx.contracts {
+					tm.Contracts[addr] = opMeters(meters)
+				}
+			}
+			st.Txs = append(st.Txs, tm)
+		}
+		snap.Txs = append(snap.Txs, st)
+	}
+	for _, s := range stat.skipped {
+		snap.Skipped = append(snap.Skipped, [2]string{s.name, s.reason})
+	}
+	return snap, nil
+}
+
+// opMeters keys the meters by the go-ethereum names of the opcodes, which
+// namedMeters reads back regardless of the naming in use.
+func opMeters(meters map[vm.OpCode]opMeter) map[string]opMeter {
+	named := make(map[string]opMeter, len(meters))
+	for op, m := range meters {
+		named[op.String()] = m
+	}
+	return named
+}
+
+// stats rebuilds the collection of the snapshot. The resets were stitched
+// when it was saved, so they are only marked again.
+func (snap *analysisSnapshot) stats() (statCollection, error) {
+	stat := newStatCollection()
+	stat.bucket, stat.weight = *bucketFlag, *weightFlag
+	for _, s := range snap.Snapshots {
+		m, err := toMeters(s.Meters)
+		if err != nil {
+			return stat, fmt.Errorf("snapshot of block %d: %v", s.Block, err)
+		}
+		stat.collectMeters(s.Block, m)
+	}
+	stat.resets = make(map[int]bool)
+	for _, number := range snap.Resets {
+		stat.resets[number] = true
+	}
+	for _, st := range snap.Txs {
+		stat.collectTxs(st.Block, st.Txs)
+	}
+	for _, s := range snap.Skipped {
+		stat.skipped = append(stat.skipped, skippedFile{s[0], s[1]})
+	}
+	stat.runtime = snap.Runtime
+	return stat, nil
+}
+
+// suite returns the chart suite of the snapshot.
+func (snap *analysisSnapshot) suite() (chartSuite, error) {
+	var suite chartSuite
+	if err := json.Unmarshal(snap.Suite, &suite); err != nil {
+		return suite, fmt.Errorf("invalid chart suite in snapshot: %v", err)
+	}
+	return suite, nil
+}
+
+// writeSnapshot writes the gzipped snapshot to path, through a temporary file
+// so that an interrupted write doesn't leave a truncated snapshot behind.
+func writeSnapshot(path string, snap *analysisSnapshot) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := gob.NewEncoder(zw).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readSnapshot reads the snapshot at path.
+func readSnapshot(path string) (*analysisSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a snapshot: %v", path, err)
+	}
+	var snap analysisSnapshot
+	if err := gob.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("corrupt snapshot %v: %v", path, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot %v has version %d, expected %d", path, snap.Version, snapshotVersion)
+	}
+	return &snap, nil
+}
+
+// saveCmd implements "vmstats save", which loads the metrics of --dir, or
+// re-executes --chaindata, and writes them to the --snapshot file along with
+// the metadata of the run and the chart suite. The snapshot can be charted on
+// another machine, without the metrics files.
+func saveCmd(ctx context.Context, suite chartSuite) {
+	if *snapshotFlag == "" {
+		fatal(exitUsage, "No snapshot file to save to, see --snapshot")
+	}
+	var (
+		stat statCollection
+		meta runMeta
+		err  error
+	)
+	switch {
+	case *chaindataFlag != "":
+		stat = reexecStats(ctx)
+		meta, err = loadRunMeta("", filepath.Base(filepath.Dir(*chaindataFlag)))
+	case *dir != "":
+		stat = loadStats(ctx, *dir)
+		meta, err = loadRunMeta(*dir, filepath.Base(*dir))
+	default:
+		fatal(exitUsage, "No metrics to save, see --dir")
+	}
+	if err != nil {
+		fatal(exitUsage, "Failed to load run metadata", "err", err)
+	}
+	if *run != "" {
+		meta.Name = *run
+	}
+	if len(stat.numbers()) == 0 {
+		fatal(exitFailure, "No metrics loaded", "dir", *dir)
+	}
+	snap, err := newSnapshot(stat, meta, suite)
+	if err != nil {
+		fatal(exitFailure, "Failed to create snapshot", "err", err)
+	}
+	if err := writeSnapshot(*snapshotFlag, snap); err != nil {
+		fatal(exitFailure, "Failed to write snapshot", "err", err)
+	}
+	log.Info("Saved snapshot", "file", *snapshotFlag, "snapshots", len(snap.Snapshots))
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var (
+	stateSizeFlag   = flag.String("statesize", "", "System metric holding the state size, to correlate with the cost of state access")
+	extrapolateFlag = flag.Float64("extrapolate", 0, "State size to extrapolate the fitted costs to (0 = twice the largest observed)")
+)
+
+// stateOps are the opcodes whose cost is expected to grow with the state.
+var stateOps = []vm.OpCode{vm.SLOAD, vm.BALANCE, vm.EXTCODEHASH}
+
+// curveFit is a least-squares fit of y = a + b*x, or of y = a + b*ln(x) if log
+// is set. Trie lookups grow with the depth of the trie, so the logarithmic
+// curve often fits the cost better than the linear one.
+type curveFit struct {
+	a, b float64
+	log  bool
+	r2   float64 // Coefficient of determination
+}
+
+func (f curveFit) at(x float64) float64 {
+	if f.log {
+		return f.a + f.b*math.Log(x)
+	}
+	return f.a + f.b*x
+}
+
+func (f curveFit) String() string {
+	if f.log {
+		return fmt.Sprintf("%.4g + %.4g*ln(size)", f.a, f.b)
+	}
+	return fmt.Sprintf("%.4g + %.4g*size", f.a, f.b)
+}
+
+// fitLine fits a straight line through the points, by least squares.
+func fitLine(xs, ys []float64) curveFit {
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		sxy += (xs[i] - mx) * (ys[i] - my)
+	}
+	var f curveFit
+	if sxx > 0 {
+		f.b = sxy / sxx
+	}
+	f.a = my - f.b*mx
+
+	var ssres, sstot float64
+	for i := range xs {
+		ssres += (ys[i] - f.at(xs[i])) * (ys[i] - f.at(xs[i]))
+		sstot += (ys[i] - my) * (ys[i] - my)
+	}
+	if sstot > 0 {
+		f.r2 = 1 - ssres/sstot
+	}
+	return f
+}
+
+// fitCurve returns the better of the linear and the logarithmic fit. The sizes
+// must be positive.
+func fitCurve(sizes, costs []float64) curveFit {
+	best := fitLine(sizes, costs)
+	logs := make([]float64, len(sizes))
+	for i, size := range sizes {
+		logs[i] = math.Log(size)
+	}
+	if f := fitLine(logs, costs); f.r2 > best.r2 {
+		f.log = true
+		best = f
+	}
+	return best
+}
+
+// pearson returns the correlation coefficient of the two series.
+func pearson(xs, ys []float64) float64 {
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+
+	var sxx, syy, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		syy += (ys[i] - my) * (ys[i] - my)
+		sxy += (xs[i] - mx) * (ys[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// at returns the value of the system metric at the given block, interpolating
+// linearly between the samples. Blocks outside the sampled range have no value.
+func (s *sysSeries) at(block float64) (float64, bool) {
+	i := sort.SearchFloat64s(s.blocks, block)
+	switch {
+	case i == len(s.blocks):
+		return 0, false
+	case s.blocks[i] == block:
+		return s.values[i], true
+	case i == 0:
+		return 0, false
+	}
+	x0, x1 := s.blocks[i-1], s.blocks[i]
+	y0, y1 := s.values[i-1], s.values[i]
+	return y0 + (y1-y0)*(block-x0)/(x1-x0), true
+}
+
+// stateCost is the ms/Mgas of an opcode against the state size, over the
+// intervals of a run.
+type stateCost struct {
+	op           vm.OpCode
+	sizes, costs []float64
+	r            float64 // Correlation of the cost with the state size
+	fit          curveFit
+}
+
+// stateCosts pairs the ms/Mgas of each interval with the state size at its
+// end. Intervals without a state size, or in which op was not executed, are
+// left out.
+func stateCosts(stat statCollection, size *sysSeries, op vm.OpCode) stateCost {
+	sc := stateCost{op: op}
+	xvals, yvals := stat.series(op, 0, metrics["timepergas"])
+	for i, block := range xvals {
+		s, ok := size.at(block)
+		if !ok || s <= 0 || yvals[i] == 0 {
+			continue
+		}
+		sc.sizes = append(sc.sizes, s)
+		sc.costs = append(sc.costs, yvals[i])
+	}
+	if len(sc.sizes) >= 2 {
+		sc.r = pearson(sc.sizes, sc.costs)
+		sc.fit = fitCurve(sc.sizes, sc.costs)
+	}
+	return sc
+}
+
+// stateSizeAnalysis correlates the cost of the state-access opcodes with the
+// state size, printing a table of the correlations and fitted curves, and
+// rendering a chart of the cost against the state size per opcode.
+func stateSizeAnalysis(ctx context.Context, w io.Writer, stat statCollection) error {
+	size, ok := sysMetrics[*stateSizeFlag]
+	if !ok {
+		return fmt.Errorf("state size %q is not a system metric, see --sysmetrics", *stateSizeFlag)
+	}
+	var (
+		fails failures
+		costs []stateCost
+	)
+	for _, op := range withoutExcluded(stateOps) {
+		if err := ctx.Err(); err != nil {
+			fails.add(err)
+			break
+		}
+		sc := stateCosts(stat, size, op)
+		if len(sc.sizes) < 2 {
+			continue
+		}
+		costs = append(costs, sc)
+		path, err := plotStateCost(sc, fmt.Sprintf("statesize-%v.png", opName(op)))
+		if err == nil {
+			fmt.Fprintln(w, path)
+		}
+		fails.add(err)
+	}
+	if len(costs) == 0 {
+		fails.add(fmt.Errorf("no intervals with a state size and state access"))
+		return fails.err()
+	}
+	target := extrapolationTarget(costs)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nCost against state size %q (extrapolated to %.4g)\n", *stateSizeFlag, target)
+	fmt.Fprintf(tw, "OPCODE\tINTERVALS\tCORRELATION\tFIT\tR2\tEXTRAPOLATED MS/MGAS\t\n")
+	for _, sc := range costs {
+		fmt.Fprintf(tw, "%v\t%d\t%.3f\t%v\t%.3f\t%.2f\t\n",
+			opName(sc.op), len(sc.sizes), sc.r, sc.fit, sc.fit.r2, sc.fit.at(target))
+	}
+	tw.Flush()
+	return fails.err()
+}
+
+// extrapolationTarget returns the state size given with --extrapolate, or
+// twice the largest observed one.
+func extrapolationTarget(costs []stateCost) float64 {
+	if *extrapolateFlag > 0 {
+		return *extrapolateFlag
+	}
+	var peak float64
+	for _, sc := range costs {
+		for _, s := range sc.sizes {
+			peak = math.Max(peak, s)
+		}
+	}
+	return 2 * peak
+}
+
+// plotStateCost renders the ms/Mgas of an opcode against the state size as a
+// scatter plot, with the fitted curve extended to the extrapolation target.
+func plotStateCost(sc stateCost, filename string) (string, error) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range sc.sizes {
+		lo, hi = math.Min(lo, s), math.Max(hi, s)
+	}
+	if target := extrapolationTarget([]stateCost{sc}); target > hi {
+		hi = target
+	}
+	const steps = 100
+	var xfit, yfit []float64
+	for i := 0; i <= steps; i++ {
+		x := lo + (hi-lo)*float64(i)/steps
+		xfit = append(xfit, x)
+		yfit = append(yfit, sc.fit.at(x))
+	}
+	width, height := layout.size(0, 0)
+	graph := chart.Chart{
+		Title:        fmt.Sprintf("Milliseconds per Mgas (%v) against state size - r = %.2f", opName(sc.op), sc.r),
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		Background: chart.Style{
+			Padding: layout.padding(chart.Box{}),
+		},
+		XAxis: chart.XAxis{
+			Name:      *stateSizeFlag,
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		},
+		YAxis: chart.YAxis{
+			Name:      metricLabel("timepergas"),
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				Name:    opName(sc.op),
+				XValues: sc.sizes,
+				YValues: sc.costs,
+				Style: chart.Style{
+					Show:        true,
+					StrokeWidth: chart.Disabled,
+					DotWidth:    2,
+				},
+			},
+			chart.ContinuousSeries{
+				Name:    fmt.Sprintf("Fit %v", sc.fit),
+				XValues: xfit,
+				YValues: yfit,
+				Style: chart.Style{
+					Show:        true,
+					StrokeColor: drawing.ColorRed,
+				},
+			},
+		},
+	}
+	return renderChart(&graph, layout, filename, map[string]interface{}{
+		"op": opName(sc.op), "statesize": *stateSizeFlag, "fit": sc.fit.String(), "r": sc.r,
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// streamRecord is one line of a JSON Lines stream, holding the cumulative
+// meters at the given block:
+//
+//	{"block": 4760000, "meters": [{"Num": 0, "Time": 0}, ...]}
+//
+// With --per-tx, the transactions of the interval are read from the txs field,
+// like in schema version 3.
+type streamRecord struct {
+	Block  int        `json:"block"`
+	Meters []opMeter  `json:"meters"`
+	Txs    []txMeters `json:"txs,omitempty"`
+}
+
+// collectStream reads JSON Lines records from r until EOF, or until ctx is
+// cancelled. The blocks of the records must be increasing.
+func (stats *statCollection) collectStream(ctx context.Context, r io.Reader) error {
+	var (
+		dec  = json.NewDecoder(r)
+		prev int // Block of the previous record
+	)
+	for line := 1; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var rec streamRecord
+		err := dec.Decode(&rec)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF && !*strictFlag:
+			// The stream was cut off, e.g. by a crash of the node writing it
+			stats.skipped = append(stats.skipped, skippedFile{fmt.Sprintf("record %d", line), "truncated"})
+			return nil
+		case err != nil:
+			return fmt.Errorf("record %d: %v", line, err)
+		}
+		switch {
+		case rec.Block <= 0:
+			return fmt.Errorf("record %d: invalid block number %d", line, rec.Block)
+		case rec.Block <= prev:
+			return fmt.Errorf("record %d: block %d does not follow block %d", line, rec.Block, prev)
+		}
+		prev = rec.Block
+		m, err := toMeters(rec.Meters)
+		if err != nil {
+			return fmt.Errorf("record %d: %v", line, err)
+		}
+		stats.collectMeters(rec.Block, m)
+		if *perTxFlag && rec.Txs != nil {
+			stats.collectTxs(rec.Block, rec.Txs)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// streamLine returns a record of the stream at block, with n executions of
+// every opcode.
+func streamLine(t *testing.T, block int, n uint64) string {
+	rec := streamRecord{Block: block, Meters: make([]opMeter, 256)}
+	for i := range rec.Meters {
+		rec.Meters[i] = opMeter{Num: n, Time: 10}
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func TestCollectStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		blocks []int
+		err    string
+	}{
+		{
+			name:   "records",
+			input:  streamLine(t, 100, 1) + streamLine(t, 200, 3),
+			blocks: []int{100, 200},
+		},
+		{
+			name:   "truncated",
+			input:  streamLine(t, 100, 1) + streamLine(t, 200, 3)[:40],
+			blocks: []int{100},
+		},
+		{
+			name:  "no block",
+			input: streamLine(t, 0, 1),
+			err:   "record 1: invalid block number 0",
+		},
+		{
+			name:  "decreasing",
+			input: streamLine(t, 200, 1) + streamLine(t, 100, 2),
+			err:   "record 2: block 100 does not follow block 200",
+		},
+		{
+			name:  "repeated",
+			input: streamLine(t, 200, 1) + streamLine(t, 200, 2),
+			err:   "record 2: block 200 does not follow block 200",
+		},
+		{
+			name:  "invalid",
+			input: `{"block": "x"}`,
+			err:   "record 1:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat := newStatCollection()
+			err := stat.collectStream(context.Background(), strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stat.numbers(); !reflect.DeepEqual(got, tt.blocks) {
+				t.Errorf("blocks %v, want %v", got, tt.blocks)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// structLog is an entry of the structLogs of debug_traceTransaction. Only the
+// opcode and its gas cost are used:
+//
+//	{"pc": 0, "op": "PUSH1", "gas": 78304, "gasCost": 3, "depth": 1, "stack": [], ...}
+type structLog struct {
+	Op      string `json:"op"`
+	GasCost uint64 `json:"gasCost"`
+}
+
+// parseStructLogs decodes the output of debug_traceTransaction, either bare or
+// as the result of a JSON-RPC response, counting the executed opcodes and the
+// gas they spent:
+//
+//	{"gas": 78304, "failed": false, "returnValue": "", "structLogs": [...]}
+//
+// The structLogs are decoded one at a time, since traces can be large. The
+// trace has no block number, it is taken from the filename.
+func parseStructLogs(r io.Reader) ([256]opMeter, int, error) {
+	var m [256]opMeter
+	dec := json.NewDecoder(r)
+	found, err := decodeTrace(dec, &m)
+	if err != nil {
+		return m, 0, fmt.Errorf("invalid trace: %v", err)
+	}
+	if !found {
+		return m, 0, fmt.Errorf("invalid trace: no structLogs")
+	}
+	return m, 0, nil
+}
+
+// decodeTrace decodes a trace object, looking for the structLogs in it or in
+// its result field. It returns whether they were found.
+func decodeTrace(dec *json.Decoder, m *[256]opMeter) (bool, error) {
+	if tok, err := dec.Token(); err != nil {
+		return false, err
+	} else if tok != json.Delim('{') {
+		return false, fmt.Errorf("expected an object")
+	}
+	var found bool
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		switch tok.(string) {
+		case "result":
+			if found, err = decodeTrace(dec, m); err != nil {
+				return false, err
+			}
+		case "structLogs":
+			if err := decodeStructLogs(dec, m); err != nil {
+				return false, err
+			}
+			found = true
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return false, err
+			}
+		}
+	}
+	_, err := dec.Token()
+	return found, err
+}
+
+// decodeStructLogs adds the entries of a structLogs array to the meters.
+// Opcodes unknown to go-ethereum are ignored.
+func decodeStructLogs(dec *json.Decoder, m *[256]opMeter) error {
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("structLogs is not an array")
+	}
+	for i := 0; dec.More(); i++ {
+		var log structLog
+		if err := dec.Decode(&log); err != nil {
+			return fmt.Errorf("structLog %d: %v", i, err)
+		}
+		if om := meterOp(m, log.Op); om != nil {
+			om.Num++
+			om.Gas += log.GasCost
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	suiteFile   = flag.String("config", "", "Chart-suite config file (json), defaults to the built-in suite")
+	yMinFlag    = flag.Float64("ymin", 0, "Pin the lower bound of the Y axis for every chart")
+	yMaxFlag    = flag.Float64("ymax", 0, "Pin the upper bound of the Y axis for every chart")
+	capFlag     = flag.Float64("cap", 0, "Cap every Y value at this level (0 = no cap)")
+	metricFlag  = flag.String("metric", "", "Metric of every line chart: a metric name or an expression like 'time/count'")
+	repriceFlag = flag.Bool("reprices", false, "Mark the blocks where the charted opcodes were repriced")
+	gasFlag     = flag.String("gas", "gross", "Gas of every chart: gross, or net of the refunds of e.g. SSTORE and SELFDESTRUCT")
+	splitFlag   = flag.Bool("split", false, "Plot the sub-meters of the opcodes, e.g. warm and cold SLOAD, as separate series")
+
+	gasLimitFlag = flag.Bool("gas-limit", false, "Overlay the block gas limit on the throughput (mgaspersec) charts without another overlay")
+)
+
+// metrics maps the metric names usable in the chart suite to the corresponding y-functions.
+var metrics = map[string]func(dp *dataPoint) float64{
+	"time": func(dp *dataPoint) float64 {
+		return float64(dp.execTime) / 1000000
+	},
+	"timepergas": func(dp *dataPoint) float64 {
+		return dp.MilliSecondsPerMgas()
+	},
+	"count": func(dp *dataPoint) float64 {
+		return float64(dp.count)
+	},
+	"nsperexec": func(dp *dataPoint) float64 {
+		return dp.NanoSecondsPerExecution()
+	},
+	"mgaspersec": func(dp *dataPoint) float64 {
+		return dp.MgasPerSecond()
+	},
+	"perblock": func(dp *dataPoint) float64 {
+		return dp.ExecutionsPerBlock()
+	},
+	"timeperblockgas": func(dp *dataPoint) float64 {
+		if gas := intervalGas(dp); gas > 0 {
+			return float64(dp.execTime) / gas
+		}
+		return 0
+	},
+}
+
+// metricLabels are the Y axis labels of the metrics.
+var metricLabels = map[string]string{
+	"time":       "Milliseconds",
+	"timepergas": "Milliseconds per Mgas",
+	"count":      "Count",
+	"nsperexec":  "Nanoseconds per execution",
+	"mgaspersec": "Mgas per second",
+	"perblock":   "Executions per block",
+
+	"timeperblockgas": "Milliseconds per block Mgas",
+}
+
+// chartSpec describes one line chart in the chart suite. The File and Title
+// are templates, see chartVars for the available placeholders.
+type chartSpec struct {
+	File   string   `json:"file"`
+	Title  string   `json:"title"`
+	Type   string   `json:"type,omitempty"`  // Empty for a line chart, or gascost, see plotGasCost
+	Ops    []string `json:"ops,omitempty"`   // Opcode or group names, empty means all opcodes
+	Match  string   `json:"match,omitempty"` // Regex on the opcode names, selecting from Ops
+	PerOp  bool     `json:"perop,omitempty"` // Render a separate chart for every opcode
+	Metric string   `json:"metric"`          // Metric name or expression, see parseMetric
+	YLabel string   `json:"ylabel,omitempty"`
+	Panels []string `json:"panels,omitempty"` // Metrics to stack into one composite image, instead of Metric
+
+	Cap       float64  `json:"cap,omitempty"`       // Values above cap are clamped (0 = no cap)
+	YMin      *float64 `json:"ymin,omitempty"`      // Lower bound of the Y axis
+	YMax      *float64 `json:"ymax,omitempty"`      // Upper bound of the Y axis
+	Filter    float64  `json:"filter,omitempty"`    // Only plot ops which reach this value (0 = plot all)
+	Reprices  bool     `json:"reprices,omitempty"`  // Mark the blocks where the ops were repriced
+	Overlay   string   `json:"overlay,omitempty"`   // System metric on the secondary Y axis, see loadSysMetrics
+	Split     bool     `json:"split,omitempty"`     // Plot the sub-meters of the ops as separate series, see opMeter.Sub
+	Gas       string   `json:"gas,omitempty"`       // Gross gas (default), or net of the refunds, see dataPoint.net
+	Smooth    string   `json:"smooth,omitempty"`    // Smoothing: none, sma or ema, see smoothKind for the default
+	Window    int      `json:"window,omitempty"`    // Window of the smoothing, in data points
+	Band      float64  `json:"band,omitempty"`      // Standard deviations of the band around the average (0 = none)
+	Quantiles []string `json:"quantiles,omitempty"` // Aggregates of the intervals, see parseAggregates
+	From      int      `json:"from,omitempty"`      // First block to plot
+
+	Layout chartLayout `json:"layout,omitempty"` // Overrides the suite layout for this chart
+}
+
+type chartSuite struct {
+	Layout   chartLayout         `json:"layout,omitempty"`   // Layout for all charts, including pies and bars
+	Theme    string              `json:"theme,omitempty"`    // Theme for all charts, light or dark
+	Palette  string              `json:"palette,omitempty"`  // Palette for all charts
+	Palettes map[string][]string `json:"palettes,omitempty"` // User-defined palettes, as lists of hex colors
+	Metrics  map[string]string   `json:"metrics,omitempty"`  // User-defined metrics, as expressions
+	Groups   map[string][]string `json:"groups,omitempty"`   // User-defined opcode groups
+	OpNames  string              `json:"opnames,omitempty"`  // Names of renamed opcodes, legacy or current
+	Charts   []chartSpec         `json:"charts"`
+}
+
+func opNames(ops []vm.OpCode) []string {
+	var names []string
+	for _, op := range ops {
+		names = append(names, opName(op))
+	}
+	return names
+}
+
+// defaultSuite is the set of charts used in the README.
+func defaultSuite() chartSuite {
+	return chartSuite{Charts: []chartSpec{
+		{File: "timespent.png", Title: "Time spent", Metric: "time"},
+		{File: "timespentCapped.png", Title: "Time spent", Metric: "time",
+			Cap: 100000, Filter: 45000, From: 3220000},
+		{File: "arithmetics.png", Title: "Milliseconds per Mgas (0x00 opcodes - Arithmetic)",
+			Ops: []string{"arithmetic"}, Metric: "timepergas"},
+		{File: "arithmetics_cap.png", Title: "Milliseconds per Mgas (0x00 opcodes - Arithmetic) - capped",
+			Ops: []string{"arithmetic"}, Metric: "timepergas", Cap: 250},
+		{File: "comparison_cap.png", Title: "Milliseconds per Mgas (0x10 opcodes - Comparison)",
+			Ops: []string{"comparison"}, Metric: "timepergas", Cap: 250},
+		{File: "sha3.png", Title: "Time spent on (0x30 opcodes - SHA3)",
+			Ops: []string{"crypto"}, Metric: "time"},
+		{File: "context1.png", Title: "Milliseconds per Mgas (0x30 opcodes - Context, part 1)",
+			Ops:    []string{"ADDRESS", "BALANCE", "ORIGIN", "CALLER", "CALLVALUE", "CALLDATASIZE"},
+			Metric: "timepergas", Cap: 500},
+		{File: "context2.png", Title: "Milliseconds per Mgas (0x30 opcodes - Context, part 2)",
+			Ops:    []string{"CODESIZE", "GASPRICE", "EXTCODESIZE", "RETURNDATASIZE", "EXTCODEHASH"},
+			Metric: "timepergas", Cap: 500},
+		{File: "blockops_cap.png", Title: "Milliseconds per Mgas (0x40 opcodes - Block ops)",
+			Ops:    []string{"COINBASE", "TIMESTAMP", "NUMBER", "DIFFICULTY", "GASLIMIT"},
+			Metric: "timepergas", Cap: 600},
+		{File: "blockhash.png", Title: "Milliseconds per Mgas (BLOCKHASH)",
+			Ops: []string{"BLOCKHASH"}, Metric: "timepergas", Cap: 3000},
+		{File: "storage1.png", Title: "Milliseconds per Mgas (0x50 Storage and execution - part 1)",
+			Ops:    []string{"POP", "MLOAD", "SLOAD", "PC", "MSIZE", "GAS"},
+			Metric: "timepergas", Cap: 3000},
+		{File: "range60.png", Title: "Milliseconds per Mgas (0x60 Pops, Swaps, Dups)",
+			Ops: []string{"stack"}, Metric: "timepergas", Cap: 600},
+		{File: "range60p2.png", Title: "Milliseconds per Mgas (0x60 Pops, Swaps, Dups) - capped at 100",
+			Ops: []string{"stack"}, Metric: "timepergas", Cap: 100},
+		{File: "logging.png", Title: "Time spent on log operations (0x70 LOG) ",
+			Ops: []string{"logging"}, Metric: "time"},
+		{File: "sload.png", Title: "Milliseconds per Mgas (SLOAD)",
+			Ops: []string{"SLOAD"}, Metric: "timepergas"},
+		{File: "balance.png", Title: "Milliseconds per Mgas (BALANCE)",
+			Ops: []string{"BALANCE"}, Metric: "timepergas"},
+	}}
+}
+
+// loadSuite reads a chart suite from the given file, or returns the default
+// suite if no file is given.
+func loadSuite(path string) (chartSuite, error) {
+	if path == "" {
+		return defaultSuite(), nil
+	}
+	var suite chartSuite
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return suite, err
+	}
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return suite, fmt.Errorf("invalid chart suite %v: %v", path, err)
+	}
+	return suite, nil
+}
+
+// applyFlags overrides the spec with any Y-range flags given on the command
+// line, and adds the gas limit to throughput charts with --gas-limit.
+func (spec *chartSpec) applyFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ymin":
+			v := *yMinFlag
+			spec.YMin = &v
+		case "ymax":
+			v := *yMaxFlag
+			spec.YMax = &v
+		case "cap":
+			spec.Cap = *capFlag
+		case "metric":
+			if len(spec.Panels) == 0 && spec.Type == "" {
+				spec.Metric = *metricFlag
+			}
+		case "reprices":
+			spec.Reprices = *repriceFlag
+		case "ops-match":
+			spec.Match = *opsMatchFlag
+		case "overlay":
+			spec.Overlay = *overlayFlag
+		case "split":
+			spec.Split = *splitFlag
+		case "gas":
+			spec.Gas = *gasFlag
+		case "smooth":
+			spec.Smooth = *smoothFlag
+		case "window":
+			spec.Window = *windowFlag
+		case "band":
+			spec.Band = *bandFlag
+		case "quantiles":
+			spec.Quantiles = strings.Split(*quantilesFlag, ",")
+		}
+	})
+	if *gasLimitFlag && spec.Overlay == "" && spec.Metric == "mgaspersec" && spec.Type == "" {
+		spec.Overlay = "gasLimit"
+	}
+}
+
+func (spec *chartSpec) opcodes() ([]vm.OpCode, error) {
+	ops := allOps
+	if len(spec.Ops) > 0 {
+		var err error
+		if ops, err = parseOps(spec.Ops); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Match != "" {
+		re, err := compileOpsMatch(spec.Match)
+		if err != nil {
+			return nil, err
+		}
+		ops = matchOps(ops, re)
+	}
+	return withoutExcluded(ops), nil
+}
+
+// yFunc returns the function for the given metric, capped as configured.
+func (spec *chartSpec) yFunc(metric string) (func(dp *dataPoint) float64, error) {
+	yFunc, err := lookupMetric(metric)
+	if err != nil {
+		return nil, fmt.Errorf("chart %v: %v", spec.File, err)
+	}
+	if strings.Contains(metric, "blockgas") && cumulativeGas == nil {
+		return nil, fmt.Errorf("chart %v: metric %q needs the gas used by block, see --gas-used", spec.File, metric)
+	}
+	switch spec.Gas {
+	case "", "gross":
+	case "net":
+		gross := yFunc
+		yFunc = func(dp *dataPoint) float64 {
+			return gross(dp.net())
+		}
+	default:
+		return nil, fmt.Errorf("chart %v: unknown gas %q, expected gross or net", spec.File, spec.Gas)
+	}
+	if cap := spec.Cap; cap > 0 {
+		inner := yFunc
+		yFunc = func(dp *dataPoint) float64 {
+			if v := inner(dp); v < cap {
+				return v
+			}
+			return cap
+		}
+	}
+	return yFunc, nil
+}
+
+// render plots the chart described by the spec, which may be split into several
+// charts if it has too many series.
+func (spec chartSpec) render(ctx context.Context, stat statCollection, run runMeta) ([]string, error) {
+	spec.applyFlags()
+	ops, err := spec.opcodes()
+	if err != nil {
+		return nil, fmt.Errorf("chart %v: %v", spec.File, err)
+	}
+	if len(ops) == 0 {
+		log.Debug("Skipping chart without matching opcodes", "chart", spec.File, "match", spec.Match)
+		return nil, nil
+	}
+	if spec.PerOp {
+		var (
+			paths []string
+			fails failures
+		)
+		for _, op := range ops {
+			if err := ctx.Err(); err != nil {
+				fails.add(err)
+				break
+			}
+			single := spec
+			single.PerOp = false
+			single.Ops = []string{opName(op)}
+			p, err := single.render(ctx, stat, run)
+			paths = append(paths, p...)
+			fails.add(err)
+		}
+		return paths, fails.err()
+	}
+	metric := spec.Metric
+	if len(spec.Panels) > 0 {
+		metric = strings.Join(spec.Panels, ",")
+	}
+	vars := newChartVars(stat, run, ops, metric, spec.From)
+	if spec.File, err = expand(spec.File, vars); err != nil {
+		return nil, fmt.Errorf("chart %v: %v", spec.File, err)
+	}
+	if spec.Title, err = expand(spec.Title, vars); err != nil {
+		return nil, fmt.Errorf("chart %v: %v", spec.File, err)
+	}
+	if spec.Gas == "net" {
+		spec.Title += ", net of refunds"
+	}
+	if stat.bucket > 0 {
+		spec.Title += weightLabel(stat.weight)
+	}
+	if stamp := run.stamp(); stamp != "" {
+		spec.Title += "\n" + stamp
+	}
+	opts := plotOpts{
+		fromBlock: spec.From,
+		yMin:      spec.YMin,
+		yMax:      spec.YMax,
+		reprices:  spec.Reprices,
+		overlay:   spec.Overlay,
+		split:     spec.Split,
+		smooth:    spec.Smooth,
+		window:    spec.Window,
+		band:      spec.Band,
+		layout:    layout.merge(spec.Layout),
+	}
+	if err := checkSmoothing(spec.Smooth, spec.Window, spec.Band); err != nil {
+		return nil, fmt.Errorf("chart %v: %v", spec.File, err)
+	}
+	if opts.aggregates, err = parseAggregates(spec.Quantiles); err != nil {
+		return nil, fmt.Errorf("chart %v: %v", spec.File, err)
+	}
+	if needsSamples(opts.aggregates) && len(stat.txs) == 0 {
+		return nil, fmt.Errorf("chart %v: quantiles need per-transaction samples, see --per-tx", spec.File)
+	}
+	if needsSamples(opts.aggregates) {
+		if total, missing := stat.unsampled(spec.From); missing > 0 {
+			log.Warn("Quantiles cover only the snapshots with per-transaction samples", "chart", spec.File, "snapshots", total, "unsampled", missing)
+		}
+	}
+	opts.params = spec
+	if spec.Filter > 0 {
+		opts.filter = minFilter(spec.Filter)
+	}
+	switch spec.Type {
+	case "":
+	case "gascost":
+		// Without a metric, only the gas cost is plotted
+		if spec.Metric == "" {
+			path, err := plotGasCost(ops, stat, spec.Title, spec.File, opts)
+			if err != nil {
+				return nil, err
+			}
+			return []string{path}, nil
+		}
+		if spec.Overlay != "" {
+			return nil, fmt.Errorf("chart %v: the gas cost and overlay %q both need the secondary Y axis", spec.File, spec.Overlay)
+		}
+		opts.gasSteps = true
+	default:
+		return nil, fmt.Errorf("chart %v: unknown chart type %q", spec.File, spec.Type)
+	}
+	if len(spec.Panels) > 0 {
+		yFuncs := make(map[string]func(*dataPoint) float64)
+		for _, metric := range spec.Panels {
+			if yFuncs[metric], err = spec.yFunc(metric); err != nil {
+				return nil, err
+			}
+		}
+		path, err := plotComposite(ops, stat, spec.Panels, yFuncs, spec.Title, spec.File, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	}
+	yFunc, err := spec.yFunc(spec.Metric)
+	if err != nil {
+		return nil, err
+	}
+	ylabel := spec.YLabel
+	if ylabel == "" {
+		ylabel = metricLabel(spec.Metric)
+	}
+	return plotSplit(ops, stat, yFunc, spec.Title, "Blocknumber", ylabel, spec.File, opts)
+}
+
+// registerMetrics adds the user-defined metrics of the suite to the metrics
+// available to charts.
+func (suite chartSuite) registerMetrics() error {
+	// In order of their names, so that the same error is reported every time
+	names := make([]string, 0, len(suite.Metrics))
+	for name := range suite.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expr := suite.Metrics[name]
+		if _, exists := metrics[name]; exists {
+			return fmt.Errorf("metric %q is already defined", name)
+		}
+		fn, err := parseMetric(expr)
+		if err != nil {
+			return fmt.Errorf("metric %q: %v", name, err)
+		}
+		metrics[name] = fn
+		metricLabels[name] = expr
+	}
+	return nil
+}
+
+// render plots all charts in the suite. A chart which fails doesn't stop the
+// others from being rendered, the errors are returned as failures. Rendering
+// stops when ctx is cancelled, the charts rendered so far are kept.
+func (suite chartSuite) render(ctx context.Context, stat statCollection, run runMeta) error {
+	var fails failures
+	for _, spec := range suite.Charts {
+		if err := ctx.Err(); err != nil {
+			fails.add(err)
+			break
+		}
+		paths, err := spec.render(ctx, stat, run)
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		fails.add(err)
+	}
+	return fails.err()
+}
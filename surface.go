@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+var surfaceFlag = flag.String("attack-surface", "", "Write the opcodes which are --underpriced in any fork era to this JSON file")
+
+// attackSurface is the machine-readable list of the mispriced opcodes of a
+// run, for the tooling of security researchers.
+type attackSurface struct {
+	Run       string          `json:"run"`
+	Threshold float64         `json:"threshold"` // Mispricing factor from which opcodes are listed
+	Opcodes   []surfaceOpcode `json:"opcodes"`
+}
+
+// surfaceOpcode is an opcode which is mispriced in one fork era. The factor is
+// its ms/Mgas relative to that of all opcodes in the era.
+type surfaceOpcode struct {
+	Op           string  `json:"op"`
+	Fork         string  `json:"fork"`
+	From         int     `json:"from"`
+	To           int     `json:"to"`
+	MsPerMgas    float64 `json:"msPerMgas"`
+	EraMsPerMgas float64 `json:"eraMsPerMgas"`
+	Factor       float64 `json:"factor"`
+	Gas          uint64  `json:"gas"` // Charged per execution
+	Count        uint64  `json:"count"`
+	NsPerExec    float64 `json:"nsPerExec"`
+}
+
+// mispriced returns the opcodes whose ms/Mgas is at least factor times that
+// of all opcodes in any fork era, the most mispriced first.
+func mispriced(stat statCollection, factor float64) []surfaceOpcode {
+	var list []surfaceOpcode
+	for _, e := range forkEras(stat) {
+		var (
+			points          = stat.delta(e.from, e.to)
+			totTime, totGas float64
+		)
+		for _, dp := range points {
+			totTime += float64(dp.execTime)
+			totGas += float64(dp.totalGas())
+		}
+		if totTime == 0 || totGas == 0 {
+			continue
+		}
+		overall := totTime / totGas
+		for _, dp := range points {
+			if dp.totalGas() == 0 {
+				continue
+			}
+			f := dp.MilliSecondsPerMgas() / overall
+			if f < factor {
+				continue
+			}
+			list = append(list, surfaceOpcode{
+				Op:           opName(dp.op),
+				Fork:         e.fork,
+				From:         e.from,
+				To:           e.to,
+				MsPerMgas:    dp.MilliSecondsPerMgas(),
+				EraMsPerMgas: overall,
+				Factor:       f,
+				Gas:          dp.gas(),
+				Count:        dp.count,
+				NsPerExec:    dp.NanoSecondsPerExecution(),
+			})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Factor > list[j].Factor
+	})
+	return list
+}
+
+// exportAttackSurface writes the opcodes which are mispriced by at least
+// factor in any fork era to path.
+func exportAttackSurface(w io.Writer, stat statCollection, run runMeta, path string, factor float64) error {
+	surface := attackSurface{Run: run.Name, Threshold: factor, Opcodes: mispriced(stat, factor)}
+	if surface.Opcodes == nil {
+		surface.Opcodes = []surfaceOpcode{}
+	}
+	data, err := json.MarshalIndent(surface, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("attack surface: %v", err)
+	}
+	fmt.Fprintln(w, path)
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+var (
+	sysMetricsFlag = flag.String("sysmetrics", "", "Comma-separated CSV files of system metrics by block number, e.g. disk IOPS or cache hit ratio")
+	overlayFlag    = flag.String("overlay", "", "System metric to overlay on the secondary Y axis of every line chart")
+)
+
+// sysMetrics are the system metrics loaded with --sysmetrics, by column name.
+var sysMetrics map[string]*sysSeries
+
+// sysSeries is a system metric, sampled at increasing block numbers.
+type sysSeries struct {
+	blocks []float64
+	values []float64
+	steps  bool // Whether the value holds until the next sample, like the gas limit
+}
+
+// setSysMetrics loads the system metrics of all files in the comma-separated
+// list. A metric may only be defined in one of them.
+func setSysMetrics(list string) error {
+	all := make(map[string]*sysSeries)
+	for _, path := range strings.Split(list, ",") {
+		metrics, err := loadSysMetrics(path)
+		if err != nil {
+			return err
+		}
+		for name, s := range metrics {
+			if all[name] != nil {
+				return fmt.Errorf("system metric %q is defined twice", name)
+			}
+			all[name] = s
+		}
+	}
+	sysMetrics = all
+	return nil
+}
+
+// loadSysMetrics reads a CSV file of system metrics, with a header naming the
+// columns. The first column is the block number, the others are the metrics
+// sampled at that block:
+//
+//	block,iops,cachehit,ram_mb
+//	4000000,1200,0.91,7800
+//	...
+//
+// Empty fields are skipped, so metrics may be sampled at different blocks.
+func loadSysMetrics(path string) (map[string]*sysSeries, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty system metrics %v", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid system metrics %v: %v", path, err)
+	}
+	if len(header) < 2 || strings.TrimSpace(header[0]) != "block" {
+		return nil, fmt.Errorf("invalid system metrics %v: expected a block column followed by metrics", path)
+	}
+	var (
+		columns = make([]*sysSeries, len(header))
+		metrics = make(map[string]*sysSeries)
+	)
+	for i, name := range header[1:] {
+		name = strings.TrimSpace(name)
+		if name == "" || metrics[name] != nil {
+			return nil, fmt.Errorf("invalid system metrics %v: empty or duplicate column %q", path, name)
+		}
+		columns[i+1] = new(sysSeries)
+		metrics[name] = columns[i+1]
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid system metrics %v: %v", path, err)
+		}
+		block, err := strconv.ParseUint(strings.TrimSpace(rec[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid system metrics %v: block %q: %v", path, rec[0], err)
+		}
+		for i, field := range rec[1:] {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid system metrics %v: %v at block %d: %v", path, header[i+1], block, err)
+			}
+			s := columns[i+1]
+			s.blocks = append(s.blocks, float64(block))
+			s.values = append(s.values, v)
+		}
+	}
+	// Samples may be collected out of order, e.g. from several log files
+	for _, s := range metrics {
+		sort.Sort(s)
+	}
+	return metrics, nil
+}
+
+func (s *sysSeries) Len() int           { return len(s.blocks) }
+func (s *sysSeries) Less(i, j int) bool { return s.blocks[i] < s.blocks[j] }
+func (s *sysSeries) Swap(i, j int) {
+	s.blocks[i], s.blocks[j] = s.blocks[j], s.blocks[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+
+// sysMetricNames returns the names of the loaded system metrics, sorted.
+func sysMetricNames() []string {
+	var names []string
+	for name := range sysMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overlaySeries returns the named system metric over the blocks in stat from
+// fromBlock on, drawn on the secondary Y axis.
+func overlaySeries(name string, stat statCollection, fromBlock, maxPoints int) (chart.ContinuousSeries, error) {
+	s, ok := sysMetrics[name]
+	if !ok {
+		if len(sysMetrics) == 0 {
+			return chart.ContinuousSeries{}, fmt.Errorf("overlay %q needs --sysmetrics or --gas-used", name)
+		}
+		return chart.ContinuousSeries{}, fmt.Errorf("unknown system metric %q (available: %v)", name, strings.Join(sysMetricNames(), ", "))
+	}
+	numbers := stat.numbers()
+	if len(numbers) == 0 {
+		return chart.ContinuousSeries{}, fmt.Errorf("no data to plot")
+	}
+	from, to := float64(numbers[0]), float64(numbers[len(numbers)-1])
+	if float64(fromBlock) > from {
+		from = float64(fromBlock)
+	}
+	var xvals, yvals []float64
+	if s.steps {
+		xvals, yvals = s.stepped(from, to)
+	} else {
+		for i, block := range s.blocks {
+			if block >= from && block <= to {
+				xvals = append(xvals, block)
+				yvals = append(yvals, s.values[i])
+			}
+		}
+	}
+	if len(xvals) == 0 {
+		return chart.ContinuousSeries{}, fmt.Errorf("no samples of system metric %q in blocks %.0f-%.0f", name, from, to)
+	}
+	if maxPoints > 0 {
+		xvals, yvals = lttb(xvals, yvals, maxPoints)
+	}
+	return chart.ContinuousSeries{
+		Name:    name,
+		XValues: xvals,
+		YValues: yvals,
+		YAxis:   chart.YAxisSecondary,
+		Style: chart.Style{
+			Show:        true,
+			StrokeColor: drawing.ColorRed,
+		},
+	}, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// chartVars are the values available to title and filename templates.
+type chartVars struct {
+	Op     string  // Opcode name, comma-separated if there are several
+	Run    string  // Name of the run
+	Meta   runMeta // Setup of the run, e.g. {{.Meta.Instance}}
+	From   int     // First block of the chart
+	To     int     // Last block of the chart
+	Metric string  // Metric name, comma-separated for composite charts
+}
+
+func newChartVars(stat statCollection, run runMeta, ops []vm.OpCode, metric string, from int) chartVars {
+	vars := chartVars{
+		Op:     strings.Join(opNames(ops), ","),
+		Run:    run.Name,
+		Meta:   run,
+		From:   from,
+		Metric: metric,
+	}
+	if numbers := stat.numbers(); len(numbers) > 0 {
+		if numbers[0] > from {
+			vars.From = numbers[0]
+		}
+		vars.To = numbers[len(numbers)-1]
+	}
+	return vars
+}
+
+// expand executes the given text as a template, e.g. "{{.Op}}-{{.Run}}.png".
+func expand(text string, vars chartVars) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
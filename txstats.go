@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/wcharczuk/go-chart"
+)
+
+var (
+	perTxFlag = flag.Bool("per-tx", false, "Load, or collect, the meters of the individual transactions (schema v3)")
+	txOpsFlag = flag.String("tx-ops", "SLOAD,SSTORE,BALANCE,CALL", "Comma-separated opcodes or groups to chart the per-transaction distribution of")
+)
+
+// txStat is the cost of the opcodes executed by one transaction.
+type txStat struct {
+	block, index int
+	hash         string
+	meters       map[vm.OpCode]opMeter
+	contracts    map[string]map[vm.OpCode]opMeter // By executing contract, if known
+}
+
+// collectTxs adds the transactions of the interval ending at the snapshot at
+// blnum, replacing any added before with the same snapshot.
+func (stats *statCollection) collectTxs(blnum int, txs []txMeters) {
+	if stats.txs == nil {
+		stats.txs = make(map[int][]txStat)
+	}
+	list := make([]txStat, 0, len(txs))
+	for _, tx := range txs {
+		ts := txStat{block: tx.Block, index: tx.Index, hash: tx.Hash, meters: namedMeters(tx.Meters)}
+		if len(tx.Contracts) > 0 {
+			ts.contracts = make(map[string]map[vm.OpCode]opMeter, len(tx.Contracts))
+			for addr, meters := range tx.Contracts {
+				ts.contracts[strings.ToLower(addr)] = namedMeters(meters)
+			}
+		}
+		list = append(list, ts)
+	}
+	stats.txs[blnum] = list
+}
+
+// namedMeters resolves meters keyed by opcode name. Opcodes which go-ethereum
+// doesn't know are ignored, like in meterOp.
+func namedMeters(named map[string]opMeter) map[vm.OpCode]opMeter {
+	meters := make(map[vm.OpCode]opMeter, len(named))
+	for name, m := range named {
+		if op, ok := lookupOp(strings.ToUpper(name)); ok {
+			meters[op] = m
+		}
+	}
+	return meters
+}
+
+// allTxs returns the loaded transactions, in block order.
+func (stats *statCollection) allTxs() []txStat {
+	var all []txStat
+	for _, number := range stats.numbers() {
+		all = append(all, stats.txs[number]...)
+	}
+	return all
+}
+
+// txCost measures the cost of transactions by the time spent if any of them
+// is timed, or else by the measured gas, or else by the number of executed
+// opcodes, as the RPC collector has neither.
+type txCost int
+
+const (
+	costByCount txCost = iota
+	costByGas
+	costByTime
+)
+
+func txCostOf(txs []txStat) txCost {
+	cost := costByCount
+	for _, tx := range txs {
+		for _, m := range tx.meters {
+			if m.Time > 0 {
+				return costByTime
+			}
+			if m.Gas > 0 {
+				cost = costByGas
+			}
+		}
+	}
+	return cost
+}
+
+// of returns the cost of the meter.
+func (c txCost) of(m opMeter) float64 {
+	switch c {
+	case costByTime:
+		return float64(m.Time)
+	case costByGas:
+		return float64(m.Gas)
+	}
+	return float64(m.Num)
+}
+
+// format renders a cost, e.g. for a histogram label.
+func (c txCost) format(v float64) string {
+	if c == costByTime {
+		return time.Duration(v).String()
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+func (c txCost) String() string {
+	switch c {
+	case costByTime:
+		return "time"
+	case costByGas:
+		return "gas"
+	}
+	return "executions"
+}
+
+// total returns the cost of the whole transaction, and its costliest opcode.
+func (c txCost) total(tx txStat) (float64, vm.OpCode) {
+	var (
+		sum, peak float64
+		top       vm.OpCode
+	)
+	for op, m := range tx.meters {
+		v := c.of(m)
+		sum += v
+		if v > peak || (v == peak && op < top) {
+			peak, top = v, op
+		}
+	}
+	return sum, top
+}
+
+// printWorstTxs writes a table of the n costliest transactions.
+func printWorstTxs(w io.Writer, txs []txStat, n int) {
+	cost := txCostOf(txs)
+	type ranked struct {
+		tx    txStat
+		total float64
+		top   vm.OpCode
+	}
+	list := make([]ranked, len(txs))
+	for i, tx := range txs {
+		total, top := cost.total(tx)
+		list[i] = ranked{tx, total, top}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].total > list[j].total
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\nCostliest transactions by %v\n", cost)
+	fmt.Fprintf(tw, "BLOCK\tINDEX\tHASH\t%v\tTOP OPCODE\tSHARE%%\t\n", strings.ToUpper(cost.String()))
+	for _, r := range list {
+		share := float64(0)
+		if r.total > 0 {
+			share = 100 * cost.of(r.tx.meters[r.top]) / r.total
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%v\t%v\t%v\t%.1f\t\n", r.tx.block, r.tx.index, r.tx.hash,
+			cost.format(r.total), opName(r.top), share)
+	}
+	tw.Flush()
+}
+
+// plotTxDistribution renders a histogram of the per-transaction cost of op,
+// over the transactions which executed it. The bins grow by powers of two, as
+// the costs span orders of magnitude.
+func plotTxDistribution(op vm.OpCode, txs []txStat, filename string) (string, error) {
+	var (
+		cost     = txCostOf(txs)
+		bins     = make(map[int]int)
+		lo, hi   = math.MaxInt32, math.MinInt32
+		executed int
+	)
+	for _, tx := range txs {
+		m, ok := tx.meters[op]
+		if !ok || m.Num == 0 {
+			continue
+		}
+		executed++
+		bin := 0
+		if v := cost.of(m); v >= 1 {
+			bin = int(math.Log2(v))
+		}
+		bins[bin]++
+		if bin < lo {
+			lo = bin
+		}
+		if bin > hi {
+			hi = bin
+		}
+	}
+	if executed == 0 {
+		return "", fmt.Errorf("%v: no transaction executed %v", filename, opName(op))
+	}
+	var vals []chart.Value
+	for bin := lo; bin <= hi; bin++ {
+		vals = append(vals, chart.Value{
+			Value: float64(bins[bin]),
+			Label: cost.format(math.Pow(2, float64(bin))),
+		})
+	}
+	width, height := layout.size(1000, 0)
+	g := chart.BarChart{
+		Title:        fmt.Sprintf("Per-transaction %v of %v - %d transactions", cost, opName(op), executed),
+		TitleStyle:   chart.StyleShow(),
+		Width:        width,
+		Height:       height,
+		DPI:          layout.DPI,
+		ColorPalette: colors,
+		XAxis: chart.Style{
+			Show:                true,
+			TextRotationDegrees: 90.0,
+		},
+		Background: chart.Style{
+			Padding: layout.padding(chart.Box{
+				Top:    40,
+				Bottom: 80,
+			}),
+		},
+		BarWidth: layout.barWidth(20),
+		YAxis: chart.YAxis{
+			Style: chart.StyleShow(),
+		},
+		Bars: vals,
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := g.Render(chart.PNG, buffer); err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("./charts/%s", filename)
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return path, err
+	}
+	return path, writeSidecar(path, valuesSidecar(g.Title, "Transactions", vals, map[string]interface{}{
+		"op": opName(op), "cost": cost.String(), "bins": "log2",
+	}))
+}
+
+// txAnalysis lists the costliest transactions, and charts the distribution of
+// the per-transaction cost of the opcodes in --tx-ops.
+func txAnalysis(ctx context.Context, w io.Writer, stat statCollection) error {
+	txs := stat.allTxs()
+	if len(txs) == 0 {
+		return fmt.Errorf("no per-transaction meters loaded, which need metrics files of schema v%d", schemaV3)
+	}
+	ops, err := parseOps(strings.Split(*txOpsFlag, ","))
+	if err != nil {
+		return err
+	}
+	printWorstTxs(w, txs, *top)
+	if hasContracts(txs) {
+		if err := printHotspots(w, txs, *top); err != nil {
+			return err
+		}
+	}
+
+	var fails failures
+	for _, op := range withoutExcluded(ops) {
+		if err := ctx.Err(); err != nil {
+			fails.add(err)
+			break
+		}
+		path, err := plotTxDistribution(op, txs, fmt.Sprintf("txdist-%v.png", opName(op)))
+		if err == nil {
+			fmt.Fprintln(w, path)
+		}
+		fails.add(err)
+	}
+	return fails.err()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	minOpTimeFlag = flag.Duration("min-op-time", time.Nanosecond, "Warn about intervals where an opcode averaged less time per execution")
+	maxOpTimeFlag = flag.Duration("max-op-time", 100*time.Millisecond, "Warn about intervals where an opcode averaged more time per execution")
+)
+
+// dataWarning is an inconsistency found in the interval between two snapshots.
+type dataWarning struct {
+	from, to int
+	op       vm.OpCode
+	problem  string
+}
+
+func (w dataWarning) String() string {
+	return fmt.Sprintf("blocks %d-%d %v: %v", w.from, w.to, w.op, w.problem)
+}
+
+// validate checks every interval for decreasing counters and implausible
+// execution times. It should be run after fixResets, since a reset also
+// decreases the counters. Metrics without any timings, such as those collected
+// over RPC, are only checked for decreasing counters.
+func (stats *statCollection) validate(minTime, maxTime time.Duration) []dataWarning {
+	var (
+		warnings []dataWarning
+		numbers  = stats.numbers()
+		timed    bool
+	)
+	for _, points := range stats.data {
+		for _, dp := range points {
+			timed = timed || dp.execTime > 0
+		}
+	}
+	for i := 1; i < len(numbers); i++ {
+		if stats.resets[numbers[i]] {
+			continue
+		}
+		for op := vm.OpCode(0); op < 255; op++ {
+			if stats.data[numbers[i]][op] == nil && stats.data[numbers[i-1]][op] == nil {
+				continue // Not executed so far
+			}
+			a, b := stats.point(numbers[i-1], op), stats.point(numbers[i], op)
+			warn := func(format string, args ...interface{}) {
+				warnings = append(warnings, dataWarning{numbers[i-1], numbers[i], op, fmt.Sprintf(format, args...)})
+			}
+			switch {
+			case b.count < a.count:
+				warn("count decreased from %d to %d", a.count, b.count)
+			case b.execTime < a.execTime:
+				warn("time decreased from %v to %v", a.execTime, b.execTime)
+			case b.count == a.count && b.execTime != a.execTime:
+				warn("time increased by %v without executions", b.execTime-a.execTime)
+			case b.count > a.count && timed:
+				perOp := (b.execTime - a.execTime) / time.Duration(b.count-a.count)
+				if perOp < minTime {
+					warn("implausibly fast, %v per execution", perOp)
+				} else if perOp > maxTime {
+					warn("implausibly slow, %v per execution", perOp)
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// reportWarnings logs the warnings, listing the first maxListed of them unless
+// running verbosely.
+func reportWarnings(warnings []dataWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	log.Warn("Found data inconsistencies", "count", len(warnings))
+	for i, w := range warnings {
+		listed(i)("Data inconsistency", "from", w.from, "to", w.to, "op", w.op, "problem", w.problem)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var weightFlag = flag.String("weight", "pooled", "Aggregation of the intervals in a bucket or bar: pooled (the metric of their sums), or count or time (the average of their metrics, weighted by executions or by time)")
+
+// Weightings of the intervals aggregated into a bucket or a bar.
+const (
+	weightPooled = "pooled" // The metric of the summed meters
+	weightCount  = "count"  // The average of the metrics, weighted by executions
+	weightTime   = "time"   // The average of the metrics, weighted by time
+)
+
+// checkWeight validates the weighting.
+func checkWeight(kind string) error {
+	switch kind {
+	case weightPooled, weightCount, weightTime:
+		return nil
+	}
+	return fmt.Errorf("unknown weighting %q, expected %v, %v or %v", kind, weightPooled, weightCount, weightTime)
+}
+
+// weightLabel is added to the titles of the charts aggregating intervals with
+// the given weighting. The pooled metric is the usual one, and has none.
+func weightLabel(kind string) string {
+	switch kind {
+	case weightCount:
+		return ", count-weighted"
+	case weightTime:
+		return ", time-weighted"
+	}
+	return ""
+}
+
+// weighted returns the average of the metric of op over the intervals between
+// the snapshots from start to end, weighted by the executions or the time of
+// every interval. It returns false if op was not executed in the range. For
+// bursty opcodes, this differs from the metric of the whole range, in which
+// the intervals count by their gas.
+func (stats *statCollection) weighted(op vm.OpCode, start, end int, kind string, pick func(dp *dataPoint) *dataPoint, yFunc func(point *dataPoint) float64) (float64, bool) {
+	var (
+		numbers   = stats.numbers()
+		sum, wsum float64
+		prev      = start
+	)
+	for i := sort.SearchInts(numbers, start+1); i < len(numbers) && numbers[i] <= end; i++ {
+		number := numbers[i]
+		if stats.resets[number] {
+			prev = number
+			continue
+		}
+		dp := pick(stats.point(number, op)).Sub(pick(stats.point(prev, op)))
+		prev = number
+		if dp.count == 0 {
+			continue
+		}
+		w := float64(dp.count)
+		if kind == weightTime {
+			w = float64(dp.execTime)
+		}
+		sum += w * yFunc(dp)
+		wsum += w
+	}
+	if wsum == 0 {
+		return 0, false
+	}
+	return sum / wsum, true
+}